@@ -41,6 +41,13 @@ func initFlags() {
 	flag.StringVar(&opts.HealthProbeAddr, "health-probe-bind-address", opts.HealthProbeAddr, "The address the probe endpoint binds to.")
 	flag.StringVar(&opts.ClusterName, "k8s-cluster-name", opts.ClusterName, "k8s cluster name")
 
+	flag.BoolVar(&opts.LeaderElection, "leader-elect", opts.LeaderElection, "Enable leader election. Only the leader writes status, annotations and events of ingress.")
+	flag.StringVar(&opts.LeaderElectionNamespace, "leader-election-namespace", opts.LeaderElectionNamespace, "Namespace of leader election lease. Default to namespace of controller pod.")
+	flag.StringVar(&opts.LeaderElectionID, "leader-election-id", opts.LeaderElectionID, "Name of leader election lease.")
+	flag.DurationVar(&opts.LeaseDuration, "leader-election-lease-duration", opts.LeaseDuration, "Duration that non-leader replicas wait before forcing to acquire leadership.")
+	flag.DurationVar(&opts.RenewDeadline, "leader-election-renew-deadline", opts.RenewDeadline, "Duration that the leader retries refreshing leadership before giving up.")
+	flag.DurationVar(&opts.RetryPeriod, "leader-election-retry-period", opts.RetryPeriod, "Duration that replicas wait between tries of actions.")
+
 	flag.StringVar(&opts.Ingress.ConfigPath, "bfe-config-path", opts.Ingress.ConfigPath, "Root directory of bfe configuration files.")
 	flag.StringVar(&opts.Ingress.ConfigPath, "c", opts.Ingress.ConfigPath, "Root directory of bfe configuration files.")
 	flag.StringVar(&opts.Ingress.BfeBinary, "bfe-binary", opts.Ingress.BfeBinary, "Absolute path of BFE binary. If set, <bfe-config-path> is overwritten by <bfe-binary>/../conf")
@@ -48,5 +55,13 @@ func initFlags() {
 	flag.StringVar(&opts.Ingress.ReloadAddr, "bfe-reload-address", opts.Ingress.ReloadAddr, "Address of bfe config reloading.")
 	flag.StringVar(&opts.Ingress.IngressClass, "ingress-class", opts.Ingress.IngressClass, "Class name of bfe ingress controller.")
 	flag.StringVar(&opts.Ingress.DefaultBackend, "default-backend", opts.Ingress.DefaultBackend, "set default backend name, default backend is used if no any ingress rule matched, format namespace/name.")
+	flag.StringVar(&opts.Ingress.DefaultSSLCertificate, "default-ssl-certificate", opts.Ingress.DefaultSSLCertificate, "Secret of default certificate, used if no certificate matches server name of tls handshake, format namespace/name.")
+	flag.StringVar(&opts.Ingress.PublishService, "publish-service", opts.Ingress.PublishService, "Service fronting the bfe ingress controller, its address is written to status of ingress, format namespace/name.")
+	flag.StringVar(&opts.Ingress.PublishStatusAddress, "publish-status-address", opts.Ingress.PublishStatusAddress, "Addresses written to status of ingress, delimited by ','. If set, <publish-service> is ignored.")
+	flag.DurationVar(&opts.Ingress.DrainTimeout, "drain-timeout", opts.Ingress.DrainTimeout, "Duration that terminating endpoints are kept with weight 0 before removed. 0 means removing them at once.")
+	flag.BoolVar(&opts.Ingress.NotReadyFallback, "not-ready-fallback", opts.Ingress.NotReadyFallback, "Route to not ready endpoints of a service if none of its endpoints is ready.")
+	flag.BoolVar(&opts.Ingress.ZoneAwareRouting, "zone-aware-routing", opts.Ingress.ZoneAwareRouting, "Split endpoints of a service into sub-clusters by zone, endpoints in zone of the controller are preferred and others are used as failover.")
+	flag.StringVar(&opts.Ingress.Zone, "zone", opts.Ingress.Zone, "Zone of the controller, used by zone aware routing. If not set, it is read from label topology.kubernetes.io/zone of node <NODE_NAME>.")
+	flag.StringVar(&opts.Ingress.TrustedProxies, "trusted-proxies", opts.Ingress.TrustedProxies, "CIDRs of trusted proxies in front of bfe, delimited by ','. Client ip is read from X-Real-Ip or X-Forwarded-For only for requests from trusted proxies.")
 
 }
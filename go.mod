@@ -5,10 +5,11 @@ go 1.16
 require (
 	github.com/bfenetworks/bfe v1.3.0
 	github.com/jwangsadinata/go-multimap v0.0.0-20190620162914-c29f3d7f33b6
+	github.com/prometheus/client_golang v1.11.0
 	honnef.co/go/tools v0.2.1 // indirect
-	k8s.io/api v0.21.2
-	k8s.io/apimachinery v0.21.2
-	k8s.io/client-go v0.21.2
-	k8s.io/klog/v2 v2.9.0 //indirect
-	sigs.k8s.io/controller-runtime v0.9.2
+	k8s.io/api v0.22.1
+	k8s.io/apimachinery v0.22.1
+	k8s.io/client-go v0.22.1
+	sigs.k8s.io/controller-runtime v0.9.6
+	sigs.k8s.io/gateway-api v0.4.0
 )
@@ -0,0 +1,58 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package annotations
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	WhitelistSourceRangeKey = "whitelist-source-range"
+	DenylistSourceRangeKey  = "denylist-source-range"
+
+	WhitelistSourceRangeAnnotation = BfeAnnotationPrefix + WhitelistSourceRangeKey
+	DenylistSourceRangeAnnotation  = BfeAnnotationPrefix + DenylistSourceRangeKey
+)
+
+// GetBlockCondition parse annotations "whitelist-source-range" and "denylist-source-range",
+// returns bfe condition matching clients to be blocked, or empty string if no annotation is set.
+// Clients out of whitelist, or in denylist are blocked.
+func GetBlockCondition(annotations map[string]string) (string, error) {
+	var statement []string
+
+	if cidrs, ok := annotations[WhitelistSourceRangeAnnotation]; ok {
+		if len(strings.TrimSpace(cidrs)) == 0 {
+			return "", fmt.Errorf("annotation %s is empty", WhitelistSourceRangeAnnotation)
+		}
+		primitive, err := cidrPrimitive(cidrs)
+		if err != nil {
+			return "", fmt.Errorf("annotation %s is illegal: %s", WhitelistSourceRangeAnnotation, err)
+		}
+		statement = append(statement, "!"+primitive)
+	}
+
+	if cidrs, ok := annotations[DenylistSourceRangeAnnotation]; ok {
+		if len(strings.TrimSpace(cidrs)) == 0 {
+			return "", fmt.Errorf("annotation %s is empty", DenylistSourceRangeAnnotation)
+		}
+		primitive, err := cidrPrimitive(cidrs)
+		if err != nil {
+			return "", fmt.Errorf("annotation %s is illegal: %s", DenylistSourceRangeAnnotation, err)
+		}
+		statement = append(statement, primitive)
+	}
+
+	return strings.Join(statement, "||"), nil
+}
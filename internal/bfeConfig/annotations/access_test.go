@@ -0,0 +1,85 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package annotations
+
+import (
+	"testing"
+
+	"github.com/bfenetworks/bfe/bfe_basic/condition"
+)
+
+func TestGetBlockCondition(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        string
+		wantErr     bool
+	}{
+		{
+			name:        "no annotation",
+			annotations: map[string]string{},
+			want:        "",
+		},
+		{
+			name:        "whitelist",
+			annotations: map[string]string{WhitelistSourceRangeAnnotation: "10.0.0.0/8"},
+			want:        "!req_cip_range(\"10.0.0.0\", \"10.255.255.255\")",
+		},
+		{
+			name:        "whitelist with multiple cidrs",
+			annotations: map[string]string{WhitelistSourceRangeAnnotation: "10.0.0.0/8, 192.168.1.1/32"},
+			want:        "!(req_cip_range(\"10.0.0.0\", \"10.255.255.255\")||req_cip_range(\"192.168.1.1\", \"192.168.1.1\"))",
+		},
+		{
+			name:        "denylist",
+			annotations: map[string]string{DenylistSourceRangeAnnotation: "2001:db8::/64"},
+			want:        "req_cip_range(\"2001:db8::\", \"2001:db8::ffff:ffff:ffff:ffff\")",
+		},
+		{
+			name: "whitelist and denylist",
+			annotations: map[string]string{
+				WhitelistSourceRangeAnnotation: "10.0.0.0/8",
+				DenylistSourceRangeAnnotation:  "10.1.0.0/16",
+			},
+			want: "!req_cip_range(\"10.0.0.0\", \"10.255.255.255\")||req_cip_range(\"10.1.0.0\", \"10.1.255.255\")",
+		},
+		{
+			name:        "illegal cidr",
+			annotations: map[string]string{WhitelistSourceRangeAnnotation: "10.0.0.1"},
+			wantErr:     true,
+		},
+		{
+			name:        "empty denylist",
+			annotations: map[string]string{DenylistSourceRangeAnnotation: " "},
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GetBlockCondition(tt.annotations)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetBlockCondition() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("GetBlockCondition() = %v, want %v", got, tt.want)
+			}
+			if len(got) > 0 {
+				if _, err := condition.Build(got); err != nil {
+					t.Errorf("GetBlockCondition() = %v, illegal condition: %s", got, err)
+				}
+			}
+		})
+	}
+}
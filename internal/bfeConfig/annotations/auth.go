@@ -0,0 +1,75 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package annotations
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	AuthTypeKey   = "auth-type"
+	AuthSecretKey = "auth-secret"
+	AuthRealmKey  = "auth-realm"
+
+	AuthTypeAnnotation   = BfeAnnotationPrefix + AuthTypeKey
+	AuthSecretAnnotation = BfeAnnotationPrefix + AuthSecretKey
+	AuthRealmAnnotation  = BfeAnnotationPrefix + AuthRealmKey
+
+	AuthTypeBasic = "basic"
+)
+
+// AuthBasic defines basic authentication of ingress, users are read from htpasswd data in secret
+type AuthBasic struct {
+	// name of secret in namespace of ingress
+	Secret string
+	// realm in challenge of unauthorized response, "Restricted" if empty
+	Realm string
+}
+
+// GetAuthBasic parse annotations "auth-type", "auth-secret" and "auth-realm", returns nil if auth-type is not set
+func GetAuthBasic(annotations map[string]string) (*AuthBasic, error) {
+	authType, ok := annotations[AuthTypeAnnotation]
+	if !ok {
+		if _, ok := annotations[AuthSecretAnnotation]; ok {
+			return nil, fmt.Errorf("annotation %s should be used with %s", AuthSecretAnnotation, AuthTypeAnnotation)
+		}
+		if _, ok := annotations[AuthRealmAnnotation]; ok {
+			return nil, fmt.Errorf("annotation %s should be used with %s", AuthRealmAnnotation, AuthTypeAnnotation)
+		}
+		return nil, nil
+	}
+	if authType != AuthTypeBasic {
+		return nil, fmt.Errorf("annotation %s is illegal, should be %s", AuthTypeAnnotation, AuthTypeBasic)
+	}
+
+	secret := annotations[AuthSecretAnnotation]
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("annotation %s is not set", AuthSecretAnnotation)
+	}
+	if errs := validation.IsDNS1123Subdomain(secret); len(errs) > 0 {
+		return nil, fmt.Errorf("annotation %s is illegal, should be name of secret in namespace of ingress: %s", AuthSecretAnnotation, strings.Join(errs, ", "))
+	}
+
+	realm := annotations[AuthRealmAnnotation]
+	for _, c := range realm {
+		if c == '"' || c == '\\' || c < ' ' || c == 0x7f {
+			return nil, fmt.Errorf("annotation %s is illegal, should not contain quote, backslash or control characters", AuthRealmAnnotation)
+		}
+	}
+
+	return &AuthBasic{Secret: secret, Realm: realm}, nil
+}
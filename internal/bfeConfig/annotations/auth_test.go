@@ -0,0 +1,92 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package annotations
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetAuthBasic(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        *AuthBasic
+		wantErr     bool
+	}{
+		{
+			name:        "no annotation",
+			annotations: map[string]string{},
+			want:        nil,
+		},
+		{
+			name: "basic auth",
+			annotations: map[string]string{
+				AuthTypeAnnotation:   "basic",
+				AuthSecretAnnotation: "basic-auth",
+				AuthRealmAnnotation:  "Authentication Required",
+			},
+			want: &AuthBasic{Secret: "basic-auth", Realm: "Authentication Required"},
+		},
+		{
+			name: "default realm",
+			annotations: map[string]string{
+				AuthTypeAnnotation:   "basic",
+				AuthSecretAnnotation: "basic-auth",
+			},
+			want: &AuthBasic{Secret: "basic-auth"},
+		},
+		{
+			name:        "unsupported type",
+			annotations: map[string]string{AuthTypeAnnotation: "digest", AuthSecretAnnotation: "basic-auth"},
+			wantErr:     true,
+		},
+		{
+			name:        "no secret",
+			annotations: map[string]string{AuthTypeAnnotation: "basic"},
+			wantErr:     true,
+		},
+		{
+			name:        "secret in other namespace",
+			annotations: map[string]string{AuthTypeAnnotation: "basic", AuthSecretAnnotation: "default/basic-auth"},
+			wantErr:     true,
+		},
+		{
+			name:        "secret without type",
+			annotations: map[string]string{AuthSecretAnnotation: "basic-auth"},
+			wantErr:     true,
+		},
+		{
+			name: "illegal realm",
+			annotations: map[string]string{
+				AuthTypeAnnotation:   "basic",
+				AuthSecretAnnotation: "basic-auth",
+				AuthRealmAnnotation:  `say "hi"`,
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GetAuthBasic(tt.annotations)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetAuthBasic() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetAuthBasic() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
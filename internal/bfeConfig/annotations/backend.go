@@ -0,0 +1,139 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package annotations
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const (
+	ConnectTimeoutKey       = "backend.connect-timeout"
+	ReadTimeoutKey          = "backend.read-timeout"
+	WriteTimeoutKey         = "backend.write-timeout"
+	RetriesKey              = "backend.retries"
+	CrossRetriesKey         = "backend.cross-retries"
+	MaxIdleConnsKey         = "backend.max-idle-conns"
+	RequestBufferSizeKey    = "backend.request-buffer-size"
+	RequestFlushIntervalKey = "backend.request-flush-interval"
+	BackendWeightKey        = "backend-weight"
+
+	ConnectTimeoutAnnotation       = BfeAnnotationPrefix + ConnectTimeoutKey
+	ReadTimeoutAnnotation          = BfeAnnotationPrefix + ReadTimeoutKey
+	WriteTimeoutAnnotation         = BfeAnnotationPrefix + WriteTimeoutKey
+	RetriesAnnotation              = BfeAnnotationPrefix + RetriesKey
+	CrossRetriesAnnotation         = BfeAnnotationPrefix + CrossRetriesKey
+	MaxIdleConnsAnnotation         = BfeAnnotationPrefix + MaxIdleConnsKey
+	RequestBufferSizeAnnotation    = BfeAnnotationPrefix + RequestBufferSizeKey
+	RequestFlushIntervalAnnotation = BfeAnnotationPrefix + RequestFlushIntervalKey
+
+	// annotation of pod, not ingress
+	BackendWeightAnnotation = BfeAnnotationPrefix + BackendWeightKey
+)
+
+// Backend defines connection settings of backends, nil field means not configured
+type Backend struct {
+	// timeout for connecting backend
+	ConnectTimeout *time.Duration
+	// timeout for reading response header from backend
+	ReadTimeout *time.Duration
+	// timeout for writing response to client
+	WriteTimeout *time.Duration
+	// max retries in the same sub-cluster
+	Retries *int
+	// max retries in other sub-clusters, after retries in the same sub-cluster fail
+	CrossRetries *int
+	// max idle connections to each backend
+	MaxIdleConns *int
+	// size of buffer for writing request to backend, in byte
+	RequestBufferSize *int
+	// interval to flush request to backend, 0 means flushing only when buffer is full
+	RequestFlushInterval *time.Duration
+}
+
+// GetBackend parse annotations "backend.*", returns nil if no backend annotation
+func GetBackend(annotations map[string]string) (*Backend, error) {
+	var backend Backend
+	var err error
+
+	for _, d := range []struct {
+		key   string
+		min   time.Duration
+		value **time.Duration
+	}{
+		{ConnectTimeoutAnnotation, time.Millisecond, &backend.ConnectTimeout},
+		{ReadTimeoutAnnotation, time.Millisecond, &backend.ReadTimeout},
+		{WriteTimeoutAnnotation, time.Millisecond, &backend.WriteTimeout},
+		{RequestFlushIntervalAnnotation, 0, &backend.RequestFlushInterval},
+	} {
+		if *d.value, err = getDuration(annotations, d.key, d.min); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, n := range []struct {
+		key   string
+		min   int
+		value **int
+	}{
+		{RetriesAnnotation, 0, &backend.Retries},
+		{CrossRetriesAnnotation, 0, &backend.CrossRetries},
+		{MaxIdleConnsAnnotation, 0, &backend.MaxIdleConns},
+		{RequestBufferSizeAnnotation, 1, &backend.RequestBufferSize},
+	} {
+		if *n.value, err = getInt(annotations, n.key, n.min); err != nil {
+			return nil, err
+		}
+	}
+
+	if backend == (Backend{}) {
+		return nil, nil
+	}
+	return &backend, nil
+}
+
+// GetBackendWeight parse pod annotation "backend-weight", returns nil if annotation not exist.
+// Weight 0 means the pod receives no request.
+func GetBackendWeight(annotations map[string]string) (*int, error) {
+	return getInt(annotations, BackendWeightAnnotation, 0)
+}
+
+// getDuration parse annotation of duration value, e.g. "3s", nil if annotation not exist
+func getDuration(annotations map[string]string, key string, min time.Duration) (*time.Duration, error) {
+	value, ok := annotations[key]
+	if !ok {
+		return nil, nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < min {
+		return nil, fmt.Errorf("annotation %s is illegal, should be a duration not less than %s", key, min)
+	}
+	return &duration, nil
+}
+
+// getInt parse annotation of integer value, nil if annotation not exist
+func getInt(annotations map[string]string, key string, min int) (*int, error) {
+	value, ok := annotations[key]
+	if !ok {
+		return nil, nil
+	}
+
+	num, err := strconv.Atoi(value)
+	if err != nil || num < min {
+		return nil, fmt.Errorf("annotation %s is illegal, should be an integer not less than %d", key, min)
+	}
+	return &num, nil
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package annotations
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetBackend(t *testing.T) {
+	backend, err := GetBackend(map[string]string{
+		ConnectTimeoutAnnotation:       "500ms",
+		ReadTimeoutAnnotation:          "5m",
+		RetriesAnnotation:              "0",
+		CrossRetriesAnnotation:         "1",
+		MaxIdleConnsAnnotation:         "64",
+		RequestFlushIntervalAnnotation: "0s",
+	})
+	if err != nil {
+		t.Fatalf("GetBackend() error: %s", err)
+	}
+	if *backend.ConnectTimeout != 500*time.Millisecond || *backend.ReadTimeout != 5*time.Minute ||
+		*backend.Retries != 0 || *backend.CrossRetries != 1 || *backend.MaxIdleConns != 64 ||
+		*backend.RequestFlushInterval != 0 || backend.WriteTimeout != nil || backend.RequestBufferSize != nil {
+		t.Errorf("GetBackend() = %+v", backend)
+	}
+
+	if backend, err := GetBackend(nil); backend != nil || err != nil {
+		t.Errorf("GetBackend() should return nil without annotation")
+	}
+
+	illegals := []map[string]string{
+		{ConnectTimeoutAnnotation: "0s"},
+		{ReadTimeoutAnnotation: "60"},
+		{WriteTimeoutAnnotation: "-1s"},
+		{RetriesAnnotation: "-1"},
+		{MaxIdleConnsAnnotation: "many"},
+		{RequestBufferSizeAnnotation: "0"},
+	}
+	for _, annotations := range illegals {
+		if _, err := GetBackend(annotations); err == nil {
+			t.Errorf("GetBackend(%v) should fail", annotations)
+		}
+	}
+}
+
+func TestGetBackendWeight(t *testing.T) {
+	if weight, err := GetBackendWeight(map[string]string{BackendWeightAnnotation: "20"}); err != nil || *weight != 20 {
+		t.Errorf("GetBackendWeight() = %v, %v, want 20", weight, err)
+	}
+	if weight, err := GetBackendWeight(nil); weight != nil || err != nil {
+		t.Errorf("GetBackendWeight() should return nil without annotation")
+	}
+	for _, value := range []string{"-1", "1.5", ""} {
+		if _, err := GetBackendWeight(map[string]string{BackendWeightAnnotation: value}); err == nil {
+			t.Errorf("GetBackendWeight(%q) should fail", value)
+		}
+	}
+}
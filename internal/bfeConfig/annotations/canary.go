@@ -0,0 +1,142 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package annotations
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	CanaryKey              = "canary"
+	CanaryWeightKey        = "canary-weight"
+	CanaryByHeaderKey      = "canary-by-header"
+	CanaryByHeaderValueKey = "canary-by-header-value"
+	CanaryByCookieKey      = "canary-by-cookie"
+
+	CanaryAnnotation              = BfeAnnotationPrefix + CanaryKey
+	CanaryWeightAnnotation        = BfeAnnotationPrefix + CanaryWeightKey
+	CanaryByHeaderAnnotation      = BfeAnnotationPrefix + CanaryByHeaderKey
+	CanaryByHeaderValueAnnotation = BfeAnnotationPrefix + CanaryByHeaderValueKey
+	CanaryByCookieAnnotation      = BfeAnnotationPrefix + CanaryByCookieKey
+
+	// canary annotations of ingress-nginx are also accepted, for tools like Flagger
+	NginxAnnotationPrefix = "nginx.ingress.kubernetes.io/"
+)
+
+const (
+	// value of canary header or cookie
+	CanaryAlways = "always"
+	CanaryNever  = "never"
+)
+
+// Canary defines how requests are split between canary ingress and primary ingress of the same host and path
+type Canary struct {
+	// percentage of requests routed to canary, 0 to 100
+	Weight int
+	// requests with header of value HeaderValue, or "always" if HeaderValue is empty, are routed to canary.
+	// If HeaderValue is empty, requests with header of value "never" are routed to primary.
+	Header      string
+	HeaderValue string
+	// requests with cookie of value "always" are routed to canary, and "never" are routed to primary
+	Cookie string
+}
+
+// IsCanary returns true if annotation "canary" is "true"
+func IsCanary(annotations map[string]string) bool {
+	value, _ := canaryValue(annotations, CanaryKey)
+	return value == "true"
+}
+
+// GetCanary parse annotations "canary" and "canary-*", returns nil if ingress is not canary.
+// Header and cookie take precedence over weight.
+func GetCanary(annotations map[string]string) (*Canary, error) {
+	if value, ok := canaryValue(annotations, CanaryKey); !ok || value == "false" {
+		return nil, nil
+	} else if value != "true" {
+		return nil, fmt.Errorf("annotation %s is illegal, should be true or false", CanaryAnnotation)
+	}
+
+	if HasRouter(annotations) {
+		return nil, fmt.Errorf("annotation %s can not be used with %srouter.* annotations", CanaryAnnotation, BfeAnnotationPrefix)
+	}
+
+	canary := &Canary{}
+	if value, ok := canaryValue(annotations, CanaryWeightKey); ok {
+		weight, err := strconv.Atoi(value)
+		if err != nil || weight < 0 || weight > 100 {
+			return nil, fmt.Errorf("annotation %s is illegal, should be an integer between 0 and 100", CanaryWeightAnnotation)
+		}
+		canary.Weight = weight
+	}
+
+	canary.Header, _ = canaryValue(annotations, CanaryByHeaderKey)
+	canary.HeaderValue, _ = canaryValue(annotations, CanaryByHeaderValueKey)
+	canary.Cookie, _ = canaryValue(annotations, CanaryByCookieKey)
+
+	if len(canary.Header) > 0 {
+		if errs := validation.IsHTTPHeaderName(canary.Header); len(errs) > 0 {
+			return nil, fmt.Errorf("annotation %s is illegal, header name [%s] is invalid: %s",
+				CanaryByHeaderAnnotation, canary.Header, strings.Join(errs, ", "))
+		}
+	} else if len(canary.HeaderValue) > 0 {
+		return nil, fmt.Errorf("annotation %s requires %s", CanaryByHeaderValueAnnotation, CanaryByHeaderAnnotation)
+	}
+	if strings.ContainsAny(canary.HeaderValue, "\"\\|") {
+		return nil, fmt.Errorf("annotation %s is illegal, header value should not contain quote, backslash or |", CanaryByHeaderValueAnnotation)
+	}
+
+	// cookie name is token, same as header name
+	if len(canary.Cookie) > 0 {
+		if errs := validation.IsHTTPHeaderName(canary.Cookie); len(errs) > 0 {
+			return nil, fmt.Errorf("annotation %s is illegal, cookie name [%s] is invalid: %s",
+				CanaryByCookieAnnotation, canary.Cookie, strings.Join(errs, ", "))
+		}
+	}
+
+	return canary, nil
+}
+
+// HeaderConditions returns bfe conditions of requests routed to canary and primary by header, empty if not configured
+func (c *Canary) HeaderConditions() (canary, primary string) {
+	if len(c.Header) == 0 {
+		return "", ""
+	}
+	if len(c.HeaderValue) > 0 {
+		return fmt.Sprintf("req_header_value_in(\"%s\", \"%s\", false)", c.Header, c.HeaderValue), ""
+	}
+	return fmt.Sprintf("req_header_value_in(\"%s\", \"%s\", false)", c.Header, CanaryAlways),
+		fmt.Sprintf("req_header_value_in(\"%s\", \"%s\", false)", c.Header, CanaryNever)
+}
+
+// CookieConditions returns bfe conditions of requests routed to canary and primary by cookie, empty if not configured
+func (c *Canary) CookieConditions() (canary, primary string) {
+	if len(c.Cookie) == 0 {
+		return "", ""
+	}
+	return fmt.Sprintf("req_cookie_value_in(\"%s\", \"%s\", false)", c.Cookie, CanaryAlways),
+		fmt.Sprintf("req_cookie_value_in(\"%s\", \"%s\", false)", c.Cookie, CanaryNever)
+}
+
+// canaryValue returns value of canary annotation, annotation of bfe takes precedence over that of ingress-nginx
+func canaryValue(annotations map[string]string, key string) (string, bool) {
+	if value, ok := annotations[BfeAnnotationPrefix+key]; ok {
+		return value, true
+	}
+	value, ok := annotations[NginxAnnotationPrefix+key]
+	return value, ok
+}
@@ -0,0 +1,117 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package annotations
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetCanary(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        *Canary
+		wantErr     bool
+	}{
+		{
+			name:        "not canary",
+			annotations: map[string]string{CanaryWeightAnnotation: "10"},
+		},
+		{
+			name:        "canary false",
+			annotations: map[string]string{CanaryAnnotation: "false"},
+		},
+		{
+			name: "canary",
+			annotations: map[string]string{
+				CanaryAnnotation:              "true",
+				CanaryWeightAnnotation:        "20",
+				CanaryByHeaderAnnotation:      "X-Canary",
+				CanaryByHeaderValueAnnotation: "yes",
+				CanaryByCookieAnnotation:      "canary",
+			},
+			want: &Canary{Weight: 20, Header: "X-Canary", HeaderValue: "yes", Cookie: "canary"},
+		},
+		{
+			name: "annotations of ingress-nginx",
+			annotations: map[string]string{
+				NginxAnnotationPrefix + CanaryKey:         "true",
+				NginxAnnotationPrefix + CanaryWeightKey:   "5",
+				NginxAnnotationPrefix + CanaryByHeaderKey: "X-Canary",
+				CanaryWeightAnnotation:                    "10",
+			},
+			want: &Canary{Weight: 10, Header: "X-Canary"},
+		},
+		{
+			name:        "illegal canary",
+			annotations: map[string]string{CanaryAnnotation: "yes"},
+			wantErr:     true,
+		},
+		{
+			name:        "illegal weight",
+			annotations: map[string]string{CanaryAnnotation: "true", CanaryWeightAnnotation: "101"},
+			wantErr:     true,
+		},
+		{
+			name:        "header value without header",
+			annotations: map[string]string{CanaryAnnotation: "true", CanaryByHeaderValueAnnotation: "yes"},
+			wantErr:     true,
+		},
+		{
+			name:        "illegal header value",
+			annotations: map[string]string{CanaryAnnotation: "true", CanaryByHeaderAnnotation: "X-Canary", CanaryByHeaderValueAnnotation: "a|b"},
+			wantErr:     true,
+		},
+		{
+			name:        "illegal cookie",
+			annotations: map[string]string{CanaryAnnotation: "true", CanaryByCookieAnnotation: "a b"},
+			wantErr:     true,
+		},
+		{
+			name:        "with router annotation",
+			annotations: map[string]string{CanaryAnnotation: "true", HeaderAnnotation: "X-Canary: always"},
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GetCanary(tt.annotations)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetCanary() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetCanary() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanary_Conditions(t *testing.T) {
+	canary := &Canary{Header: "X-Canary", Cookie: "canary"}
+	if c, p := canary.HeaderConditions(); c != `req_header_value_in("X-Canary", "always", false)` ||
+		p != `req_header_value_in("X-Canary", "never", false)` {
+		t.Errorf("HeaderConditions() = %s, %s", c, p)
+	}
+	if c, p := canary.CookieConditions(); c != `req_cookie_value_in("canary", "always", false)` ||
+		p != `req_cookie_value_in("canary", "never", false)` {
+		t.Errorf("CookieConditions() = %s, %s", c, p)
+	}
+
+	canary.HeaderValue = "yes"
+	if c, p := canary.HeaderConditions(); c != `req_header_value_in("X-Canary", "yes", false)` || p != "" {
+		t.Errorf("HeaderConditions() = %s, %s", c, p)
+	}
+}
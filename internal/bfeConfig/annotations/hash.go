@@ -0,0 +1,90 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package annotations
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	HashStrategyKey  = "balance.hash-strategy"
+	HashKeyKey       = "balance.hash-key"
+	SessionStickyKey = "balance.session-sticky"
+
+	HashStrategyAnnotation  = BfeAnnotationPrefix + HashStrategyKey
+	HashKeyAnnotation       = BfeAnnotationPrefix + HashKeyKey
+	SessionStickyAnnotation = BfeAnnotationPrefix + SessionStickyKey
+)
+
+const (
+	HashStrategyClientIP = "client-ip"
+	HashStrategyHeader   = "header"
+	HashStrategyCookie   = "cookie"
+)
+
+// Hash defines how requests are hashed to sub-clusters and backends
+type Hash struct {
+	// client-ip, header or cookie
+	Strategy string
+	// name of header or cookie, empty for client-ip
+	Key           string
+	SessionSticky bool
+}
+
+// GetHash parse annotations "balance.hash-strategy", "balance.hash-key" and "balance.session-sticky",
+// returns nil if no hash annotation
+func GetHash(annotations map[string]string) (*Hash, error) {
+	strategy, strategyOk := annotations[HashStrategyAnnotation]
+	key, keyOk := annotations[HashKeyAnnotation]
+	_, stickyOk := annotations[SessionStickyAnnotation]
+	if !strategyOk && !keyOk && !stickyOk {
+		return nil, nil
+	}
+
+	sticky, err := getBool(annotations, SessionStickyAnnotation)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strategyOk {
+		strategy = HashStrategyClientIP
+	}
+	switch strategy {
+	case HashStrategyClientIP:
+		if keyOk {
+			return nil, fmt.Errorf("annotation %s is illegal, hash key is not used by strategy %s", HashKeyAnnotation, strategy)
+		}
+	case HashStrategyHeader, HashStrategyCookie:
+		if len(key) == 0 {
+			return nil, fmt.Errorf("annotation %s is illegal, hash key is required by strategy %s", HashKeyAnnotation, strategy)
+		}
+		// cookie name is token, same as header name
+		if errs := validation.IsHTTPHeaderName(key); len(errs) > 0 {
+			return nil, fmt.Errorf("annotation %s is illegal, %s name [%s] is invalid: %s",
+				HashKeyAnnotation, strategy, key, strings.Join(errs, ", "))
+		}
+	default:
+		return nil, fmt.Errorf("annotation %s is illegal, strategy should be %s, %s or %s",
+			HashStrategyAnnotation, HashStrategyClientIP, HashStrategyHeader, HashStrategyCookie)
+	}
+
+	return &Hash{
+		Strategy:      strategy,
+		Key:           key,
+		SessionSticky: sticky,
+	}, nil
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package annotations
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetHash(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        *Hash
+		wantErr     bool
+	}{
+		{
+			name:        "no annotation",
+			annotations: nil,
+		},
+		{
+			name:        "session sticky with default strategy",
+			annotations: map[string]string{SessionStickyAnnotation: "true"},
+			want:        &Hash{Strategy: HashStrategyClientIP, SessionSticky: true},
+		},
+		{
+			name:        "cookie",
+			annotations: map[string]string{HashStrategyAnnotation: "cookie", HashKeyAnnotation: "SESSIONID", SessionStickyAnnotation: "true"},
+			want:        &Hash{Strategy: HashStrategyCookie, Key: "SESSIONID", SessionSticky: true},
+		},
+		{
+			name:        "header",
+			annotations: map[string]string{HashStrategyAnnotation: "header", HashKeyAnnotation: "X-User-Id"},
+			want:        &Hash{Strategy: HashStrategyHeader, Key: "X-User-Id"},
+		},
+		{
+			name:        "header without key",
+			annotations: map[string]string{HashStrategyAnnotation: "header"},
+			wantErr:     true,
+		},
+		{
+			name:        "invalid key",
+			annotations: map[string]string{HashStrategyAnnotation: "cookie", HashKeyAnnotation: "a:b"},
+			wantErr:     true,
+		},
+		{
+			name:        "key with client ip",
+			annotations: map[string]string{HashStrategyAnnotation: "client-ip", HashKeyAnnotation: "X-User-Id"},
+			wantErr:     true,
+		},
+		{
+			name:        "unknown strategy",
+			annotations: map[string]string{HashStrategyAnnotation: "uri"},
+			wantErr:     true,
+		},
+		{
+			name:        "invalid session sticky",
+			annotations: map[string]string{SessionStickyAnnotation: "yes"},
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GetHash(tt.annotations)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetHash() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetHash() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package annotations
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	RequestHeaderSetKey     = "header.request.set"
+	RequestHeaderAddKey     = "header.request.add"
+	RequestHeaderDeleteKey  = "header.request.delete"
+	ResponseHeaderSetKey    = "header.response.set"
+	ResponseHeaderAddKey    = "header.response.add"
+	ResponseHeaderDeleteKey = "header.response.delete"
+
+	RequestHeaderSetAnnotation     = BfeAnnotationPrefix + RequestHeaderSetKey
+	RequestHeaderAddAnnotation     = BfeAnnotationPrefix + RequestHeaderAddKey
+	RequestHeaderDeleteAnnotation  = BfeAnnotationPrefix + RequestHeaderDeleteKey
+	ResponseHeaderSetAnnotation    = BfeAnnotationPrefix + ResponseHeaderSetKey
+	ResponseHeaderAddAnnotation    = BfeAnnotationPrefix + ResponseHeaderAddKey
+	ResponseHeaderDeleteAnnotation = BfeAnnotationPrefix + ResponseHeaderDeleteKey
+)
+
+// HeaderActions defines headers to be modified
+// set/add example: {"X-Forwarded-Prefix": "/api"}
+// delete example: "Server, X-Powered-By"
+type HeaderActions struct {
+	Set    map[string]string
+	Add    map[string]string
+	Delete []string
+}
+
+type Header struct {
+	Request  HeaderActions
+	Response HeaderActions
+}
+
+// GetHeader parse annotations "header.*", returns nil if no header annotation
+func GetHeader(annotations map[string]string) (*Header, error) {
+	var header Header
+	var err error
+
+	if header.Request, err = getHeaderActions(annotations,
+		RequestHeaderSetAnnotation, RequestHeaderAddAnnotation, RequestHeaderDeleteAnnotation); err != nil {
+		return nil, err
+	}
+	if header.Response, err = getHeaderActions(annotations,
+		ResponseHeaderSetAnnotation, ResponseHeaderAddAnnotation, ResponseHeaderDeleteAnnotation); err != nil {
+		return nil, err
+	}
+
+	if header.Request.empty() && header.Response.empty() {
+		return nil, nil
+	}
+	return &header, nil
+}
+
+func (h *HeaderActions) empty() bool {
+	return len(h.Set) == 0 && len(h.Add) == 0 && len(h.Delete) == 0
+}
+
+func getHeaderActions(annotations map[string]string, setKey, addKey, deleteKey string) (HeaderActions, error) {
+	var actions HeaderActions
+	var err error
+
+	if actions.Set, err = getHeaderValues(annotations, setKey); err != nil {
+		return actions, err
+	}
+	if actions.Add, err = getHeaderValues(annotations, addKey); err != nil {
+		return actions, err
+	}
+
+	value, ok := annotations[deleteKey]
+	if !ok {
+		return actions, nil
+	}
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if len(name) == 0 {
+			continue
+		}
+		if err := checkHeaderName(name); err != nil {
+			return actions, fmt.Errorf("annotation %s is illegal, error: %s", deleteKey, err)
+		}
+		actions.Delete = append(actions.Delete, name)
+	}
+	return actions, nil
+}
+
+func getHeaderValues(annotations map[string]string, key string) (map[string]string, error) {
+	value, ok := annotations[key]
+	if !ok {
+		return nil, nil
+	}
+
+	headers := make(map[string]string)
+	if err := json.Unmarshal([]byte(value), &headers); err != nil {
+		return nil, fmt.Errorf("annotation %s is illegal, error: %s", key, err)
+	}
+	for name, value := range headers {
+		if err := checkHeaderName(name); err != nil {
+			return nil, fmt.Errorf("annotation %s is illegal, error: %s", key, err)
+		}
+		if len(value) == 0 {
+			return nil, fmt.Errorf("annotation %s is illegal, value of header [%s] is empty", key, name)
+		}
+	}
+	return headers, nil
+}
+
+func checkHeaderName(name string) error {
+	if errs := validation.IsHTTPHeaderName(name); len(errs) > 0 {
+		return fmt.Errorf("header [%s] is invalid: %s", name, strings.Join(errs, ", "))
+	}
+	return nil
+}
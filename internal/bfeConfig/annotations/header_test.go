@@ -0,0 +1,76 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package annotations
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetHeader(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        *Header
+		wantErr     bool
+	}{
+		{
+			name:        "no annotation",
+			annotations: map[string]string{RequestHeaderDeleteAnnotation: " "},
+			want:        nil,
+		},
+		{
+			name: "request and response",
+			annotations: map[string]string{
+				RequestHeaderSetAnnotation:     `{"X-Forwarded-Prefix": "/api"}`,
+				ResponseHeaderAddAnnotation:    `{"Strict-Transport-Security": "max-age=31536000"}`,
+				ResponseHeaderDeleteAnnotation: "Server, X-Powered-By",
+			},
+			want: &Header{
+				Request: HeaderActions{Set: map[string]string{"X-Forwarded-Prefix": "/api"}},
+				Response: HeaderActions{
+					Add:    map[string]string{"Strict-Transport-Security": "max-age=31536000"},
+					Delete: []string{"Server", "X-Powered-By"},
+				},
+			},
+		},
+		{
+			name:        "illegal json",
+			annotations: map[string]string{RequestHeaderAddAnnotation: `{"X-Foo": 1}`},
+			wantErr:     true,
+		},
+		{
+			name:        "illegal header name",
+			annotations: map[string]string{ResponseHeaderDeleteAnnotation: "X Foo"},
+			wantErr:     true,
+		},
+		{
+			name:        "empty value",
+			annotations: map[string]string{ResponseHeaderSetAnnotation: `{"X-Foo": ""}`},
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GetHeader(tt.annotations)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetHeader() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetHeader() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package annotations
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	HealthCheckSchemeKey           = "health-check.scheme"
+	HealthCheckURIKey              = "health-check.uri"
+	HealthCheckHostKey             = "health-check.host"
+	HealthCheckStatusCodeKey       = "health-check.status-code"
+	HealthCheckIntervalKey         = "health-check.interval"
+	HealthCheckTimeoutKey          = "health-check.timeout"
+	HealthCheckFailureThresholdKey = "health-check.failure-threshold"
+	HealthCheckSuccessThresholdKey = "health-check.success-threshold"
+
+	HealthCheckSchemeAnnotation           = BfeAnnotationPrefix + HealthCheckSchemeKey
+	HealthCheckURIAnnotation              = BfeAnnotationPrefix + HealthCheckURIKey
+	HealthCheckHostAnnotation             = BfeAnnotationPrefix + HealthCheckHostKey
+	HealthCheckStatusCodeAnnotation       = BfeAnnotationPrefix + HealthCheckStatusCodeKey
+	HealthCheckIntervalAnnotation         = BfeAnnotationPrefix + HealthCheckIntervalKey
+	HealthCheckTimeoutAnnotation          = BfeAnnotationPrefix + HealthCheckTimeoutKey
+	HealthCheckFailureThresholdAnnotation = BfeAnnotationPrefix + HealthCheckFailureThresholdKey
+	HealthCheckSuccessThresholdAnnotation = BfeAnnotationPrefix + HealthCheckSuccessThresholdKey
+)
+
+const (
+	HealthCheckSchemeHTTP  = "http"
+	HealthCheckSchemeHTTPS = "https"
+	HealthCheckSchemeTCP   = "tcp"
+)
+
+// HealthCheck defines health check of backends, nil field means not configured
+type HealthCheck struct {
+	Scheme *string
+	URI    *string
+	Host   *string
+	// status code in bfe format, 100~599 for exact status code, bitmask 0~31 for status code classes
+	StatusCode       *int
+	Interval         *time.Duration
+	Timeout          *time.Duration
+	FailureThreshold *int
+	SuccessThreshold *int
+}
+
+// GetHealthCheck parse annotations "health-check.*", returns nil if no health check annotation
+func GetHealthCheck(annotations map[string]string) (*HealthCheck, error) {
+	var check HealthCheck
+	found := false
+
+	if value, ok := annotations[HealthCheckSchemeAnnotation]; ok {
+		found = true
+		switch value {
+		case HealthCheckSchemeHTTP, HealthCheckSchemeTCP:
+		case HealthCheckSchemeHTTPS:
+			return nil, fmt.Errorf("annotation %s is illegal, https health check is not supported by bfe yet", HealthCheckSchemeAnnotation)
+		default:
+			return nil, fmt.Errorf("annotation %s is illegal, scheme should be http or tcp", HealthCheckSchemeAnnotation)
+		}
+		check.Scheme = &value
+	}
+
+	if value, ok := annotations[HealthCheckURIAnnotation]; ok {
+		found = true
+		if !strings.HasPrefix(value, "/") {
+			return nil, fmt.Errorf("annotation %s is illegal, uri should start with /", HealthCheckURIAnnotation)
+		}
+		check.URI = &value
+	}
+
+	if value, ok := annotations[HealthCheckHostAnnotation]; ok {
+		found = true
+		check.Host = &value
+	}
+
+	if value, ok := annotations[HealthCheckStatusCodeAnnotation]; ok {
+		found = true
+		code, err := parseStatusCode(value)
+		if err != nil {
+			return nil, fmt.Errorf("annotation %s is illegal, error: %s", HealthCheckStatusCodeAnnotation, err)
+		}
+		check.StatusCode = &code
+	}
+
+	var err error
+	for _, d := range []struct {
+		key   string
+		value **time.Duration
+	}{
+		{HealthCheckIntervalAnnotation, &check.Interval},
+		{HealthCheckTimeoutAnnotation, &check.Timeout},
+	} {
+		if *d.value, err = getDuration(annotations, d.key, time.Millisecond); err != nil {
+			return nil, err
+		}
+		found = found || *d.value != nil
+	}
+
+	for _, n := range []struct {
+		key   string
+		value **int
+	}{
+		{HealthCheckFailureThresholdAnnotation, &check.FailureThreshold},
+		{HealthCheckSuccessThresholdAnnotation, &check.SuccessThreshold},
+	} {
+		if *n.value, err = getInt(annotations, n.key, 1); err != nil {
+			return nil, err
+		}
+		found = found || *n.value != nil
+	}
+
+	if !found {
+		return nil, nil
+	}
+	return &check, nil
+}
+
+// parseStatusCode parses status code, e.g. "200", or status code classes, e.g. "2xx,3xx"
+func parseStatusCode(value string) (int, error) {
+	if code, err := strconv.Atoi(value); err == nil {
+		if code < 100 || code > 599 {
+			return 0, fmt.Errorf("status code [%d] should be in 100~599", code)
+		}
+		return code, nil
+	}
+
+	code := 0
+	for _, class := range strings.Split(value, ",") {
+		class = strings.ToLower(strings.TrimSpace(class))
+		if len(class) != 3 || !strings.HasSuffix(class, "xx") || class[0] < '1' || class[0] > '5' {
+			return 0, fmt.Errorf("status code [%s] should be like 200 or 2xx,3xx", value)
+		}
+		// 0b00001 for 1xx, 0b00010 for 2xx, ...
+		code |= 1 << (class[0] - '1')
+	}
+	return code, nil
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package annotations
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetHealthCheck(t *testing.T) {
+	check, err := GetHealthCheck(map[string]string{
+		HealthCheckSchemeAnnotation:           "http",
+		HealthCheckURIAnnotation:              "/healthz",
+		HealthCheckStatusCodeAnnotation:       "2xx,3xx",
+		HealthCheckIntervalAnnotation:         "3s",
+		HealthCheckFailureThresholdAnnotation: "2",
+	})
+	if err != nil {
+		t.Fatalf("GetHealthCheck() error: %s", err)
+	}
+	if *check.Scheme != "http" || *check.URI != "/healthz" || *check.StatusCode != 0b00110 ||
+		*check.Interval != 3*time.Second || *check.FailureThreshold != 2 || check.Host != nil || check.SuccessThreshold != nil {
+		t.Errorf("GetHealthCheck() = %+v", check)
+	}
+
+	if check, err := GetHealthCheck(nil); check != nil || err != nil {
+		t.Errorf("GetHealthCheck() should return nil without annotation")
+	}
+
+	illegals := []map[string]string{
+		{HealthCheckSchemeAnnotation: "https"},
+		{HealthCheckSchemeAnnotation: "grpc"},
+		{HealthCheckURIAnnotation: "healthz"},
+		{HealthCheckStatusCodeAnnotation: "600"},
+		{HealthCheckStatusCodeAnnotation: "2xx,6xx"},
+		{HealthCheckIntervalAnnotation: "3"},
+		{HealthCheckSuccessThresholdAnnotation: "0"},
+	}
+	for _, annotations := range illegals {
+		if _, err := GetHealthCheck(annotations); err == nil {
+			t.Errorf("GetHealthCheck(%v) should fail", annotations)
+		}
+	}
+}
@@ -14,25 +14,30 @@
 package annotations
 
 const (
-	PriorityBasic        = 10
-	PriorityHeader       = 20
-	PriorityCookie       = 30
-	PriorityCookieHeader = 40
+	PriorityBasic = 10
+	// rules generated for canary are matched before the primary rule, and after other rules with router annotations
+	PriorityCanaryCookie = 12
+	PriorityCanaryHeader = 14
+	// base priority of rules with router annotations
+	PriorityRouter = 20
 )
 
+// Priority returns priority of rule by its router annotations.
+// Rule with more router conditions has higher priority; for the same number of conditions,
+// rule whose conditions have higher precedence (see routerConditions) has higher priority.
 func Priority(annotations map[string]string) int {
-	_, ok1 := annotations[CookieAnnotation]
-	_, ok2 := annotations[HeaderAnnotation]
+	count, mask := 0, 0
+	for i, c := range routerConditions {
+		if _, ok := annotations[c.annotation]; ok {
+			count++
+			mask |= 1 << i
+		}
+	}
 
-	if ok1 && ok2 {
-		return PriorityCookieHeader
-	} else if ok1 {
-		return PriorityCookie
-	} else if ok2 {
-		return PriorityHeader
-	} else {
+	if count == 0 {
 		return PriorityBasic
 	}
+	return PriorityRouter + count<<len(routerConditions) + mask
 }
 
 func Equal(annotations1, annotations2 map[string]string) bool {
@@ -40,6 +45,10 @@ func Equal(annotations1, annotations2 map[string]string) bool {
 		return true
 	}
 
-	return annotations1[CookieAnnotation] == annotations2[CookieAnnotation] &&
-		annotations1[HeaderAnnotation] == annotations2[HeaderAnnotation]
+	for _, c := range routerConditions {
+		if annotations1[c.annotation] != annotations2[c.annotation] {
+			return false
+		}
+	}
+	return IsCanary(annotations1) == IsCanary(annotations2)
 }
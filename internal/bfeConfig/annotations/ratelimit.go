@@ -0,0 +1,108 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package annotations
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	RateLimitRPSKey           = "rate-limit.rps"
+	RateLimitBurstKey         = "rate-limit.burst"
+	RateLimitBlockDurationKey = "rate-limit.block-duration"
+	RateLimitKeyKey           = "rate-limit.key"
+
+	RateLimitRPSAnnotation           = BfeAnnotationPrefix + RateLimitRPSKey
+	RateLimitBurstAnnotation         = BfeAnnotationPrefix + RateLimitBurstKey
+	RateLimitBlockDurationAnnotation = BfeAnnotationPrefix + RateLimitBlockDurationKey
+	RateLimitKeyAnnotation           = BfeAnnotationPrefix + RateLimitKeyKey
+
+	RateLimitKeyClientIP     = "client-ip"
+	RateLimitKeyHeaderPrefix = "header:"
+	RateLimitKeyCookiePrefix = "cookie:"
+)
+
+// RateLimit defines requests per second allowed for each client of ingress
+type RateLimit struct {
+	// requests allowed in one second
+	RPS int
+	// requests allowed in one second beyond RPS
+	Burst int
+	// duration that clients are blocked after exceeding limit, in addition to the rest of the second
+	BlockDuration time.Duration
+
+	// clients are identified by client ip, or value of Header or Cookie if set
+	Header string
+	Cookie string
+}
+
+// GetRateLimit parse annotations "rate-limit.*", returns nil if rate-limit.rps is not set
+func GetRateLimit(annotations map[string]string) (*RateLimit, error) {
+	rps, err := getInt(annotations, RateLimitRPSAnnotation, 1)
+	if err != nil {
+		return nil, err
+	}
+	if rps == nil {
+		for _, key := range []string{RateLimitBurstAnnotation, RateLimitBlockDurationAnnotation, RateLimitKeyAnnotation} {
+			if _, ok := annotations[key]; ok {
+				return nil, fmt.Errorf("annotation %s should be used with %s", key, RateLimitRPSAnnotation)
+			}
+		}
+		return nil, nil
+	}
+
+	rateLimit := &RateLimit{RPS: *rps}
+	burst, err := getInt(annotations, RateLimitBurstAnnotation, 0)
+	if err != nil {
+		return nil, err
+	}
+	if burst != nil {
+		rateLimit.Burst = *burst
+	}
+
+	duration, err := getDuration(annotations, RateLimitBlockDurationAnnotation, 0)
+	if err != nil {
+		return nil, err
+	}
+	if duration != nil {
+		if *duration%time.Second != 0 {
+			return nil, fmt.Errorf("annotation %s is illegal, should be in whole seconds", RateLimitBlockDurationAnnotation)
+		}
+		rateLimit.BlockDuration = *duration
+	}
+
+	key := strings.TrimSpace(annotations[RateLimitKeyAnnotation])
+	switch {
+	case len(key) == 0 || key == RateLimitKeyClientIP:
+	case strings.HasPrefix(key, RateLimitKeyHeaderPrefix):
+		rateLimit.Header = strings.TrimSpace(strings.TrimPrefix(key, RateLimitKeyHeaderPrefix))
+		if errs := validation.IsHTTPHeaderName(rateLimit.Header); len(errs) > 0 {
+			return nil, fmt.Errorf("annotation %s is illegal: %s", RateLimitKeyAnnotation, strings.Join(errs, ", "))
+		}
+	case strings.HasPrefix(key, RateLimitKeyCookiePrefix):
+		rateLimit.Cookie = strings.TrimSpace(strings.TrimPrefix(key, RateLimitKeyCookiePrefix))
+		if len(rateLimit.Cookie) == 0 || strings.ContainsAny(rateLimit.Cookie, " \t;=,\"") {
+			return nil, fmt.Errorf("annotation %s is illegal, cookie name is empty or contains illegal characters", RateLimitKeyAnnotation)
+		}
+	default:
+		return nil, fmt.Errorf("annotation %s is illegal, should be %s, %s<name> or %s<name>",
+			RateLimitKeyAnnotation, RateLimitKeyClientIP, RateLimitKeyHeaderPrefix, RateLimitKeyCookiePrefix)
+	}
+
+	return rateLimit, nil
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package annotations
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGetRateLimit(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        *RateLimit
+		wantErr     bool
+	}{
+		{
+			name:        "no annotation",
+			annotations: map[string]string{},
+			want:        nil,
+		},
+		{
+			name:        "rps only",
+			annotations: map[string]string{RateLimitRPSAnnotation: "10"},
+			want:        &RateLimit{RPS: 10},
+		},
+		{
+			name: "limit by client ip",
+			annotations: map[string]string{
+				RateLimitRPSAnnotation:           "10",
+				RateLimitBurstAnnotation:         "5",
+				RateLimitBlockDurationAnnotation: "1m",
+				RateLimitKeyAnnotation:           "client-ip",
+			},
+			want: &RateLimit{RPS: 10, Burst: 5, BlockDuration: time.Minute},
+		},
+		{
+			name:        "limit by header",
+			annotations: map[string]string{RateLimitRPSAnnotation: "10", RateLimitKeyAnnotation: "header:X-Api-Key"},
+			want:        &RateLimit{RPS: 10, Header: "X-Api-Key"},
+		},
+		{
+			name:        "limit by cookie",
+			annotations: map[string]string{RateLimitRPSAnnotation: "10", RateLimitKeyAnnotation: "cookie:session"},
+			want:        &RateLimit{RPS: 10, Cookie: "session"},
+		},
+		{
+			name:        "illegal rps",
+			annotations: map[string]string{RateLimitRPSAnnotation: "0"},
+			wantErr:     true,
+		},
+		{
+			name:        "burst without rps",
+			annotations: map[string]string{RateLimitBurstAnnotation: "5"},
+			wantErr:     true,
+		},
+		{
+			name:        "block duration not in seconds",
+			annotations: map[string]string{RateLimitRPSAnnotation: "10", RateLimitBlockDurationAnnotation: "1500ms"},
+			wantErr:     true,
+		},
+		{
+			name:        "illegal header",
+			annotations: map[string]string{RateLimitRPSAnnotation: "10", RateLimitKeyAnnotation: "header:X Api"},
+			wantErr:     true,
+		},
+		{
+			name:        "unknown key",
+			annotations: map[string]string{RateLimitRPSAnnotation: "10", RateLimitKeyAnnotation: "query:id"},
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GetRateLimit(tt.annotations)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetRateLimit() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetRateLimit() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package annotations
+
+import (
+	"fmt"
+	"strconv"
+)
+
+const (
+	SSLRedirectKey      = "ssl-redirect"
+	ForceSSLRedirectKey = "force-ssl-redirect"
+
+	SSLRedirectAnnotation      = BfeAnnotationPrefix + SSLRedirectKey
+	ForceSSLRedirectAnnotation = BfeAnnotationPrefix + ForceSSLRedirectKey
+)
+
+// GetSSLRedirect parse annotation "ssl-redirect" and "force-ssl-redirect"
+// ssl-redirect: redirect http requests to https for hosts in spec.tls
+// force-ssl-redirect: redirect http requests to https for all hosts
+func GetSSLRedirect(annotations map[string]string) (redirect bool, force bool, err error) {
+	if redirect, err = getBool(annotations, SSLRedirectAnnotation); err != nil {
+		return false, false, err
+	}
+	if force, err = getBool(annotations, ForceSSLRedirectAnnotation); err != nil {
+		return false, false, err
+	}
+	return redirect, force, nil
+}
+
+// getBool parse annotation of bool value, false if annotation not exist
+func getBool(annotations map[string]string, key string) (bool, error) {
+	value, ok := annotations[key]
+	if !ok {
+		return false, nil
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("annotation %s is illegal, error: %s", key, err)
+	}
+	return b, nil
+}
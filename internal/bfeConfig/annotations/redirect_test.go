@@ -0,0 +1,60 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package annotations
+
+import (
+	"testing"
+)
+
+func TestGetSSLRedirect(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		redirect    bool
+		force       bool
+		wantErr     bool
+	}{
+		{
+			name:        "no annotation",
+			annotations: nil,
+		},
+		{
+			name:        "ssl redirect",
+			annotations: map[string]string{SSLRedirectAnnotation: "true"},
+			redirect:    true,
+		},
+		{
+			name:        "force ssl redirect",
+			annotations: map[string]string{SSLRedirectAnnotation: "false", ForceSSLRedirectAnnotation: "true"},
+			force:       true,
+		},
+		{
+			name:        "illegal value",
+			annotations: map[string]string{ForceSSLRedirectAnnotation: "yes"},
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			redirect, force, err := GetSSLRedirect(tt.annotations)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetSSLRedirect() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if redirect != tt.redirect || force != tt.force {
+				t.Errorf("GetSSLRedirect() = %v, %v, want %v, %v", redirect, force, tt.redirect, tt.force)
+			}
+		})
+	}
+}
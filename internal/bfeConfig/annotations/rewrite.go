@@ -0,0 +1,122 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package annotations
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	RewritePrefixStripKey   = "rewrite.prefix-strip"
+	RewritePrefixReplaceKey = "rewrite.prefix-replace"
+	RewriteRegexKey         = "rewrite.regex"
+	RewriteHostKey          = "rewrite.host"
+
+	RewritePrefixStripAnnotation   = BfeAnnotationPrefix + RewritePrefixStripKey
+	RewritePrefixReplaceAnnotation = BfeAnnotationPrefix + RewritePrefixReplaceKey
+	RewriteRegexAnnotation         = BfeAnnotationPrefix + RewriteRegexKey
+	RewriteHostAnnotation          = BfeAnnotationPrefix + RewriteHostKey
+)
+
+// RewriteRegex define struct of annotation "rewrite.regex"
+// example: {"pattern": "^/static/.*\\.png$", "replacement": "/static/default.png"}
+type RewriteRegex struct {
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"`
+}
+
+// Rewrite defines how request is rewritten before forwarded to backend
+type Rewrite struct {
+	// strip path of matched rule
+	PrefixStrip bool
+	// replace path of matched rule with given prefix
+	PrefixReplace string
+	// set path if path matches pattern
+	Regex *RewriteRegex
+	// set host
+	Host string
+}
+
+// GetRewrite parse annotations "rewrite.*", returns nil if no rewrite annotation
+func GetRewrite(annotations map[string]string) (*Rewrite, error) {
+	var rewrite Rewrite
+	var err error
+
+	if rewrite.PrefixStrip, err = getBool(annotations, RewritePrefixStripAnnotation); err != nil {
+		return nil, err
+	}
+
+	if value, ok := annotations[RewritePrefixReplaceAnnotation]; ok {
+		if !strings.HasPrefix(value, "/") {
+			return nil, fmt.Errorf("annotation %s is illegal, prefix should start with /", RewritePrefixReplaceAnnotation)
+		}
+		rewrite.PrefixReplace = value
+	}
+
+	if value, ok := annotations[RewriteRegexAnnotation]; ok {
+		if rewrite.Regex, err = parseRewriteRegex(value); err != nil {
+			return nil, fmt.Errorf("annotation %s is illegal, error: %s", RewriteRegexAnnotation, err)
+		}
+	}
+
+	if value, ok := annotations[RewriteHostAnnotation]; ok {
+		if len(value) == 0 || strings.ContainsAny(value, "/*` \t") {
+			return nil, fmt.Errorf("annotation %s is illegal, host [%s] is invalid", RewriteHostAnnotation, value)
+		}
+		rewrite.Host = value
+	}
+
+	// path can only be rewritten in one way
+	var pathRewrites []string
+	if rewrite.PrefixStrip {
+		pathRewrites = append(pathRewrites, RewritePrefixStripAnnotation)
+	}
+	if len(rewrite.PrefixReplace) > 0 {
+		pathRewrites = append(pathRewrites, RewritePrefixReplaceAnnotation)
+	}
+	if rewrite.Regex != nil {
+		pathRewrites = append(pathRewrites, RewriteRegexAnnotation)
+	}
+	if len(pathRewrites) > 1 {
+		return nil, fmt.Errorf("annotations %s can not be used together", strings.Join(pathRewrites, ", "))
+	}
+
+	if len(pathRewrites) == 0 && len(rewrite.Host) == 0 {
+		return nil, nil
+	}
+	return &rewrite, nil
+}
+
+func parseRewriteRegex(value string) (*RewriteRegex, error) {
+	var regex RewriteRegex
+	if err := json.Unmarshal([]byte(value), &regex); err != nil {
+		return nil, err
+	}
+
+	if len(regex.Pattern) == 0 || strings.Contains(regex.Pattern, "`") {
+		return nil, fmt.Errorf("pattern [%s] is invalid", regex.Pattern)
+	}
+	if _, err := regexp.Compile(regex.Pattern); err != nil {
+		return nil, err
+	}
+
+	// bfe only sets path with fixed value
+	if !strings.HasPrefix(regex.Replacement, "/") || strings.Contains(regex.Replacement, "$") {
+		return nil, fmt.Errorf("replacement [%s] should be a path, capture group is not supported", regex.Replacement)
+	}
+	return &regex, nil
+}
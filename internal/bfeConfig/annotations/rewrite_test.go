@@ -0,0 +1,82 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package annotations
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetRewrite(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        *Rewrite
+		wantErr     bool
+	}{
+		{
+			name:        "no annotation",
+			annotations: map[string]string{RewritePrefixStripAnnotation: "false"},
+			want:        nil,
+		},
+		{
+			name: "prefix replace and host",
+			annotations: map[string]string{
+				RewritePrefixReplaceAnnotation: "/v2",
+				RewriteHostAnnotation:          "backend.example.com",
+			},
+			want: &Rewrite{PrefixReplace: "/v2", Host: "backend.example.com"},
+		},
+		{
+			name:        "regex",
+			annotations: map[string]string{RewriteRegexAnnotation: `{"pattern": "^/img/.*\\.png$", "replacement": "/img/default.png"}`},
+			want:        &Rewrite{Regex: &RewriteRegex{Pattern: `^/img/.*\.png$`, Replacement: "/img/default.png"}},
+		},
+		{
+			name:        "regex with capture group",
+			annotations: map[string]string{RewriteRegexAnnotation: `{"pattern": "^/img/(.*)$", "replacement": "/$1"}`},
+			wantErr:     true,
+		},
+		{
+			name:        "illegal regex",
+			annotations: map[string]string{RewriteRegexAnnotation: `{"pattern": "^/img/(", "replacement": "/img"}`},
+			wantErr:     true,
+		},
+		{
+			name:        "illegal prefix",
+			annotations: map[string]string{RewritePrefixReplaceAnnotation: "v2"},
+			wantErr:     true,
+		},
+		{
+			name: "multiple path rewrites",
+			annotations: map[string]string{
+				RewritePrefixStripAnnotation:   "true",
+				RewritePrefixReplaceAnnotation: "/v2",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GetRewrite(tt.annotations)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetRewrite() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetRewrite() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
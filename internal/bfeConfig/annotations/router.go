@@ -15,39 +15,109 @@ package annotations
 
 import (
 	"fmt"
+	"net"
+	"regexp"
 	"strings"
+
+	"github.com/bfenetworks/bfe/bfe_basic/condition"
+
+	"github.com/bfenetworks/ingress-bfe/internal/bfeConfig/util"
 )
 
 const (
-	CookieKey = "router.cookie"
-	HeaderKey = "router.header"
+	CookieKey       = "router.cookie"
+	CookiePrefixKey = "router.cookie-prefix"
+	HeaderKey       = "router.header"
+	HeaderPrefixKey = "router.header-prefix"
+	HeaderRegexKey  = "router.header-regex"
+	QueryKey        = "router.query"
+	MethodKey       = "router.method"
+	SourceCIDRKey   = "router.source-cidr"
+	ConditionKey    = "router.condition"
 
-	CookieAnnotation = BfeAnnotationPrefix + CookieKey
-	HeaderAnnotation = BfeAnnotationPrefix + HeaderKey
+	CookieAnnotation       = BfeAnnotationPrefix + CookieKey
+	CookiePrefixAnnotation = BfeAnnotationPrefix + CookiePrefixKey
+	HeaderAnnotation       = BfeAnnotationPrefix + HeaderKey
+	HeaderPrefixAnnotation = BfeAnnotationPrefix + HeaderPrefixKey
+	HeaderRegexAnnotation  = BfeAnnotationPrefix + HeaderRegexKey
+	QueryAnnotation        = BfeAnnotationPrefix + QueryKey
+	MethodAnnotation       = BfeAnnotationPrefix + MethodKey
+	SourceCIDRAnnotation   = BfeAnnotationPrefix + SourceCIDRKey
+	ConditionAnnotation    = BfeAnnotationPrefix + ConditionKey
 )
 
+// routerConditions are router annotations in ascending order of precedence,
+// rule with condition of higher precedence has higher priority, see Priority.
+var routerConditions = []struct {
+	annotation string
+	primitive  func(value string) (string, error)
+}{
+	{ConditionAnnotation, conditionExpression},
+	{MethodAnnotation, methodPrimitive},
+	{SourceCIDRAnnotation, sourceCIDRPrimitive},
+	{QueryAnnotation, queryPrimitive},
+	{HeaderRegexAnnotation, headerRegexPrimitive},
+	{HeaderPrefixAnnotation, headerPrefixPrimitive},
+	{HeaderAnnotation, headerPrimitive},
+	{CookiePrefixAnnotation, cookiePrefixPrimitive},
+	{CookieAnnotation, cookiePrimitive},
+}
+
+var validMethods = map[string]bool{
+	"GET": true, "HEAD": true, "POST": true, "PUT": true, "PATCH": true,
+	"DELETE": true, "CONNECT": true, "OPTIONS": true, "TRACE": true,
+}
+
+// GetRouteExpression generates bfe condition from router annotations,
+// primitives are joined with "&&" in descending order of precedence.
 func GetRouteExpression(annotations map[string]string) (string, error) {
-	var primitive1 string
-	var err error
-	if primitive1, err = cookiePrimitive(annotations[CookieAnnotation]); err != nil {
-		return "", err
+	var primitives []string
+	for i := len(routerConditions) - 1; i >= 0; i-- {
+		primitive, err := routerConditions[i].primitive(annotations[routerConditions[i].annotation])
+		if err != nil {
+			return "", err
+		}
+		if len(primitive) > 0 {
+			primitives = append(primitives, primitive)
+		}
 	}
 
-	var primitive2 string
-	if primitive2, err = headerPrimitive(annotations[HeaderAnnotation]); err != nil {
-		return "", err
+	return strings.Join(primitives, "&&"), nil
+}
+
+// HasRouter returns true if any router annotation is set
+func HasRouter(annotations map[string]string) bool {
+	for _, c := range routerConditions {
+		if _, ok := annotations[c.annotation]; ok {
+			return true
+		}
 	}
+	return false
+}
 
-	if len(primitive1) > 0 && len(primitive2) > 0 {
-		return primitive1 + "&&" + primitive2, nil
+// splitKeyValue splits annotation value in format "key: value"
+func splitKeyValue(name, value string) (string, string, error) {
+	index := strings.Index(value, ":")
+	if index == -1 || index == len(value)-1 {
+		return "", "", fmt.Errorf("%s annotation[%s] is illegal", name, value)
 	}
-	if len(primitive1) > 0 {
-		return primitive1, nil
+	return strings.TrimSpace(value[:index]), strings.TrimSpace(value[index+1:]), nil
+}
+
+// keyValuePrimitive generates bfe condition primitive like fn("key", "value", false)
+func keyValuePrimitive(fn, name, value string) (string, error) {
+	if len(value) == 0 {
+		return "", nil
 	}
-	if len(primitive2) > 0 {
-		return primitive2, nil
+	k, v, err := splitKeyValue(name, value)
+	if err != nil {
+		return "", err
 	}
-	return "", nil
+	if strings.ContainsAny(k+v, "\"\\") {
+		return "", fmt.Errorf("%s annotation[%s] is illegal, should not contain '\"' or '\\'", name, value)
+	}
+
+	return fmt.Sprintf("%s(\"%s\", \"%v\", false)", fn, k, v), nil
 }
 
 // cookiePrimitive generates bfe condition primitive for cookie match
@@ -55,26 +125,120 @@ func cookiePrimitive(cookie string) (string, error) {
 	if len(cookie) == 0 {
 		return "", nil
 	}
-	index := strings.Index(cookie, ":")
-	if index == -1 || index == len(cookie)-1 {
-		return "", fmt.Errorf("cookie annotation[%s] is illegal", cookie)
+	k, v, err := splitKeyValue("cookie", cookie)
+	if err != nil {
+		return "", err
 	}
 
-	con := fmt.Sprintf("req_cookie_value_in(\"%s\", \"%v\", false)", strings.TrimSpace(cookie[:index]), strings.TrimSpace(cookie[index+1:]))
+	con := fmt.Sprintf("req_cookie_value_in(\"%s\", \"%v\", false)", k, v)
 	return con, nil
 
 }
 
-// cookiePrimitive generates bfe condition primitive for header match
+// cookiePrefixPrimitive generates bfe condition primitive for cookie prefix match
+func cookiePrefixPrimitive(cookie string) (string, error) {
+	return keyValuePrimitive("req_cookie_value_prefix_in", "cookie-prefix", cookie)
+}
+
+// headerPrimitive generates bfe condition primitive for header match
 func headerPrimitive(header string) (string, error) {
 	if len(header) == 0 {
 		return "", nil
 	}
-	index := strings.Index(header, ":")
-	if index == -1 || index == len(header)-1 {
-		return "", fmt.Errorf("header annotation[%s] is illegal", header)
+	k, v, err := splitKeyValue("header", header)
+	if err != nil {
+		return "", err
 	}
 
-	con := fmt.Sprintf("req_header_value_in(\"%s\", \"%v\", false)", strings.TrimSpace(header[:index]), strings.TrimSpace(header[index+1:]))
+	con := fmt.Sprintf("req_header_value_in(\"%s\", \"%v\", false)", k, v)
 	return con, nil
 }
+
+// headerPrefixPrimitive generates bfe condition primitive for header prefix match
+func headerPrefixPrimitive(header string) (string, error) {
+	return keyValuePrimitive("req_header_value_prefix_in", "header-prefix", header)
+}
+
+// headerRegexPrimitive generates bfe condition primitive for header regex match
+func headerRegexPrimitive(header string) (string, error) {
+	if len(header) == 0 {
+		return "", nil
+	}
+	k, v, err := splitKeyValue("header-regex", header)
+	if err != nil {
+		return "", err
+	}
+	if strings.ContainsAny(k, "\"\\") || strings.Contains(v, "`") {
+		return "", fmt.Errorf("header-regex annotation[%s] is illegal, should not contain '\"', '\\' in key or '`' in regex", header)
+	}
+	if _, err := regexp.Compile(v); err != nil {
+		return "", fmt.Errorf("header-regex annotation[%s] is illegal: %s", header, err)
+	}
+
+	return fmt.Sprintf("req_header_value_regmatch(\"%s\", `%s`)", k, v), nil
+}
+
+// queryPrimitive generates bfe condition primitive for query match
+func queryPrimitive(query string) (string, error) {
+	return keyValuePrimitive("req_query_value_in", "query", query)
+}
+
+// methodPrimitive generates bfe condition primitive for method match, methods are separated by ","
+func methodPrimitive(method string) (string, error) {
+	if len(method) == 0 {
+		return "", nil
+	}
+	var methods []string
+	for _, m := range strings.Split(method, ",") {
+		m = strings.ToUpper(strings.TrimSpace(m))
+		if !validMethods[m] {
+			return "", fmt.Errorf("method annotation[%s] is illegal, method %q is not supported", method, m)
+		}
+		methods = append(methods, m)
+	}
+
+	return fmt.Sprintf("req_method_in(\"%s\")", strings.Join(methods, "|")), nil
+}
+
+// sourceCIDRPrimitive generates bfe condition primitive for client ip match, CIDRs are separated by ","
+func sourceCIDRPrimitive(cidrs string) (string, error) {
+	primitive, err := cidrPrimitive(cidrs)
+	if err != nil {
+		return "", fmt.Errorf("source-cidr annotation[%s] is illegal: %s", cidrs, err)
+	}
+	return primitive, nil
+}
+
+// cidrPrimitive generates bfe condition primitive matching client ip in any of CIDRs separated by ","
+func cidrPrimitive(cidrs string) (string, error) {
+	if len(cidrs) == 0 {
+		return "", nil
+	}
+	var primitives []string
+	for _, cidr := range strings.Split(cidrs, ",") {
+		_, ipNet, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return "", err
+		}
+		start, end := util.CIDRRange(ipNet)
+		primitives = append(primitives, fmt.Sprintf("req_cip_range(\"%s\", \"%s\")", start, end))
+	}
+
+	if len(primitives) == 1 {
+		return primitives[0], nil
+	}
+	return "(" + strings.Join(primitives, "||") + ")", nil
+}
+
+// conditionExpression checks raw bfe condition expression with bfe condition parser
+func conditionExpression(cond string) (string, error) {
+	cond = strings.TrimSpace(cond)
+	if len(cond) == 0 {
+		return "", nil
+	}
+	if _, err := condition.Build(cond); err != nil {
+		return "", fmt.Errorf("condition annotation[%s] is illegal: %s", cond, err)
+	}
+
+	return "(" + cond + ")", nil
+}
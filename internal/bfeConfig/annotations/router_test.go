@@ -184,3 +184,153 @@ func Test_headerAnnotation_Check(t *testing.T) {
 		})
 	}
 }
+
+func Test_routerAnnotation_Build(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		fields  map[string]string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "query",
+			fields: map[string]string{
+				QueryAnnotation: "version: v1|v2",
+			},
+			want: "req_query_value_in(\"version\", \"v1|v2\", false)",
+		},
+		{
+			name: "method",
+			fields: map[string]string{
+				MethodAnnotation: "get, POST",
+			},
+			want: "req_method_in(\"GET|POST\")",
+		},
+		{
+			name: "method illegal",
+			fields: map[string]string{
+				MethodAnnotation: "GET,FOO",
+			},
+			wantErr: true,
+		},
+		{
+			name: "header regex",
+			fields: map[string]string{
+				HeaderRegexAnnotation: "User-Agent: ^curl/7\\.\\d+",
+			},
+			want: "req_header_value_regmatch(\"User-Agent\", `^curl/7\\.\\d+`)",
+		},
+		{
+			name: "header regex illegal",
+			fields: map[string]string{
+				HeaderRegexAnnotation: "User-Agent: curl(",
+			},
+			wantErr: true,
+		},
+		{
+			name: "header regex with backquote",
+			fields: map[string]string{
+				HeaderRegexAnnotation: "User-Agent: `curl",
+			},
+			wantErr: true,
+		},
+		{
+			name: "header prefix",
+			fields: map[string]string{
+				HeaderPrefixAnnotation: "X-User: test-",
+			},
+			want: "req_header_value_prefix_in(\"X-User\", \"test-\", false)",
+		},
+		{
+			name: "cookie prefix",
+			fields: map[string]string{
+				CookiePrefixAnnotation: "uid: 100",
+			},
+			want: "req_cookie_value_prefix_in(\"uid\", \"100\", false)",
+		},
+		{
+			name: "cookie prefix with quote",
+			fields: map[string]string{
+				CookiePrefixAnnotation: "uid: \"100",
+			},
+			wantErr: true,
+		},
+		{
+			name: "source cidr",
+			fields: map[string]string{
+				SourceCIDRAnnotation: "10.0.0.0/8",
+			},
+			want: "req_cip_range(\"10.0.0.0\", \"10.255.255.255\")",
+		},
+		{
+			name: "multiple source cidr",
+			fields: map[string]string{
+				SourceCIDRAnnotation: "192.168.1.10/32, 2001:db8::/64",
+			},
+			want: "(req_cip_range(\"192.168.1.10\", \"192.168.1.10\")||req_cip_range(\"2001:db8::\", \"2001:db8::ffff:ffff:ffff:ffff\"))",
+		},
+		{
+			name: "source cidr illegal",
+			fields: map[string]string{
+				SourceCIDRAnnotation: "10.0.0.0",
+			},
+			wantErr: true,
+		},
+		{
+			name: "multiple conditions",
+			fields: map[string]string{
+				MethodAnnotation: "GET",
+				CookieAnnotation: "uid: 100",
+				QueryAnnotation:  "a: b",
+				HeaderAnnotation: "Key: value",
+			},
+			want: "req_cookie_value_in(\"uid\", \"100\", false)&&req_header_value_in(\"Key\", \"value\", false)&&" +
+				"req_query_value_in(\"a\", \"b\", false)&&req_method_in(\"GET\")",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GetRouteExpression(tt.fields)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetRouteExpression() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("GetRouteExpression() [%s] fail, got %v, want %v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPriority(t *testing.T) {
+	// in ascending order of priority
+	annotations := []map[string]string{
+		{},
+		{MethodAnnotation: "GET"},
+		{SourceCIDRAnnotation: "10.0.0.0/8"},
+		{QueryAnnotation: "a: b"},
+		{HeaderRegexAnnotation: "Key: .*"},
+		{HeaderPrefixAnnotation: "Key: v"},
+		{HeaderAnnotation: "Key: value"},
+		{CookiePrefixAnnotation: "Key: v"},
+		{CookieAnnotation: "Key: value"},
+		{MethodAnnotation: "GET", SourceCIDRAnnotation: "10.0.0.0/8"},
+		{MethodAnnotation: "GET", HeaderAnnotation: "Key: value"},
+		{HeaderAnnotation: "Key: value", CookieAnnotation: "Key: value"},
+		{MethodAnnotation: "GET", QueryAnnotation: "a: b", SourceCIDRAnnotation: "10.0.0.0/8"},
+	}
+
+	if Priority(annotations[0]) != PriorityBasic {
+		t.Errorf("Priority() = %d, want %d", Priority(annotations[0]), PriorityBasic)
+	}
+	if Priority(annotations[1]) <= PriorityCanaryHeader {
+		t.Errorf("Priority() = %d, should be higher than canary rules", Priority(annotations[1]))
+	}
+	for i := 1; i < len(annotations); i++ {
+		if Priority(annotations[i-1]) >= Priority(annotations[i]) {
+			t.Errorf("Priority(%v) = %d, should be lower than Priority(%v) = %d",
+				annotations[i-1], Priority(annotations[i-1]), annotations[i], Priority(annotations[i]))
+		}
+	}
+}
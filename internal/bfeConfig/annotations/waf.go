@@ -0,0 +1,66 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package annotations
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	WafKey       = "waf"
+	WafPolicyKey = "waf.policy"
+
+	WafAnnotation       = BfeAnnotationPrefix + WafKey
+	WafPolicyAnnotation = BfeAnnotationPrefix + WafPolicyKey
+
+	// requests hit by waf rules are blocked
+	WafModeBlock = "block"
+	// requests hit by waf rules are only counted and logged
+	WafModeDetect = "detect"
+)
+
+// Waf defines web application firewall of ingress
+type Waf struct {
+	// WafModeBlock or WafModeDetect
+	Mode string
+	// name of ConfigMap in namespace of ingress, which defines waf rules. Default rules are used if empty
+	Policy string
+}
+
+// GetWaf parse annotations "waf" and "waf.policy", returns nil if waf is not set
+func GetWaf(annotations map[string]string) (*Waf, error) {
+	mode, ok := annotations[WafAnnotation]
+	if !ok {
+		if _, ok := annotations[WafPolicyAnnotation]; ok {
+			return nil, fmt.Errorf("annotation %s should be used with %s", WafPolicyAnnotation, WafAnnotation)
+		}
+		return nil, nil
+	}
+	mode = strings.TrimSpace(mode)
+	if mode != WafModeBlock && mode != WafModeDetect {
+		return nil, fmt.Errorf("annotation %s is illegal, should be %s or %s", WafAnnotation, WafModeBlock, WafModeDetect)
+	}
+
+	policy, ok := annotations[WafPolicyAnnotation]
+	if ok {
+		if errs := validation.IsDNS1123Subdomain(policy); len(errs) > 0 {
+			return nil, fmt.Errorf("annotation %s is illegal, should be name of configmap in namespace of ingress: %s", WafPolicyAnnotation, strings.Join(errs, ", "))
+		}
+	}
+
+	return &Waf{Mode: mode, Policy: policy}, nil
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package annotations
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetWaf(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        *Waf
+		wantErr     bool
+	}{
+		{
+			name:        "no annotation",
+			annotations: map[string]string{},
+			want:        nil,
+		},
+		{
+			name:        "block",
+			annotations: map[string]string{WafAnnotation: "block"},
+			want:        &Waf{Mode: WafModeBlock},
+		},
+		{
+			name:        "detect with policy",
+			annotations: map[string]string{WafAnnotation: "detect", WafPolicyAnnotation: "waf-policy"},
+			want:        &Waf{Mode: WafModeDetect, Policy: "waf-policy"},
+		},
+		{
+			name:        "illegal mode",
+			annotations: map[string]string{WafAnnotation: "true"},
+			wantErr:     true,
+		},
+		{
+			name:        "illegal policy",
+			annotations: map[string]string{WafAnnotation: "block", WafPolicyAnnotation: "default/waf-policy"},
+			wantErr:     true,
+		},
+		{
+			name:        "policy without waf",
+			annotations: map[string]string{WafPolicyAnnotation: "waf-policy"},
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GetWaf(tt.annotations)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetWaf() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetWaf() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -20,10 +20,15 @@ import (
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	netv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	"github.com/bfenetworks/ingress-bfe/internal/bfeConfig/configs"
+	"github.com/bfenetworks/ingress-bfe/internal/bfeConfig/util"
 	"github.com/bfenetworks/ingress-bfe/internal/option"
 )
 
@@ -37,26 +42,117 @@ type ConfigBuilder struct {
 	serverDataConf *configs.ServerDataConfig
 	clusterConf    *configs.ClusterConfig
 	tlsConf        *configs.TLSConfig
+	redirectConf   *configs.RedirectConfig
+	rewriteConf    *configs.RewriteConfig
+	headerConf     *configs.HeaderConfig
+	authBasicConf  *configs.AuthBasicConfig
+	blockConf      *configs.BlockConfig
+	prisonConf     *configs.PrisonConfig
+	wafConf        *configs.WafConfig
+	trustIPConf    *configs.TrustIPConfig
+
+	// routes translated from Gateway API resources, keyed by namespaced config name of route.
+	// Routes failed to update are kept until deleted, so that they can be requeued.
+	routes map[string]*configs.Route
+
+	// ingresses to be reconciled again, shared by controllers of ingress
+	requeue       chan event.GenericEvent
+	requeueSource *source.Channel
+	// Gateway API resources to be reconciled again, shared by controllers of Gateway API
+	routeRequeue       chan event.GenericEvent
+	routeRequeueSource *source.Channel
 }
 
 func NewConfigBuilder() *ConfigBuilder {
 	version := "init"
+	requeue := make(chan event.GenericEvent)
+	routeRequeue := make(chan event.GenericEvent)
 	return &ConfigBuilder{
 		serverDataConf: configs.NewServerDataConfig(version),
 		clusterConf:    configs.NewClusterConfig(version),
 		tlsConf:        configs.NewTLSConfig(version),
+		redirectConf:   configs.NewRedirectConfig(version),
+		rewriteConf:    configs.NewRewriteConfig(version),
+		headerConf:     configs.NewHeaderConfig(version),
+		authBasicConf:  configs.NewAuthBasicConfig(version),
+		blockConf:      configs.NewBlockConfig(version),
+		prisonConf:     configs.NewPrisonConfig(version),
+		wafConf:        configs.NewWafConfig(version),
+		trustIPConf:    configs.NewTrustIPConfig(version),
+		routes:         make(map[string]*configs.Route),
+
+		requeue:            requeue,
+		requeueSource:      &source.Channel{Source: requeue},
+		routeRequeue:       routeRequeue,
+		routeRequeueSource: &source.Channel{Source: routeRequeue},
 	}
 }
 
-func (c *ConfigBuilder) UpdateIngress(ingress *netv1.Ingress, services map[string]*corev1.Service, endpoints map[string]*corev1.Endpoints, secrets []*corev1.Secret) error {
+// RequeueSource returns source of ingresses which should be reconciled again, as their tls hosts are
+// overwritten by elder ingresses, or released by conflict ingresses.
+func (c *ConfigBuilder) RequeueSource() source.Source {
+	return c.requeueSource
+}
+
+// RouteRequeueSource returns source of Gateway API resources which should be reconciled again, like RequeueSource.
+// Objects of source are *metav1.PartialObjectMetadata with kind, namespace and name of resources.
+func (c *ConfigBuilder) RouteRequeueSource() source.Source {
+	return c.routeRequeueSource
+}
+
+// requeueIngresses sends ingresses and routes to requeue sources, without blocking caller which holds the lock
+func (c *ConfigBuilder) requeueIngresses(ingresses []string) {
+	if len(ingresses) == 0 {
+		return
+	}
+
+	var events, routeEvents []event.GenericEvent
+	for _, ingress := range ingresses {
+		if route, ok := c.routes[ingress]; ok {
+			routeEvents = append(routeEvents, event.GenericEvent{Object: &metav1.PartialObjectMetadata{
+				TypeMeta:   metav1.TypeMeta{Kind: route.Kind},
+				ObjectMeta: metav1.ObjectMeta{Namespace: route.Namespace, Name: route.Name},
+			}})
+			continue
+		}
+		namespace, name := util.SplitNamespacedName(ingress)
+		events = append(events, event.GenericEvent{Object: &netv1.Ingress{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}})
+	}
+
+	go func() {
+		for _, e := range events {
+			c.requeue <- e
+		}
+		for _, e := range routeEvents {
+			c.routeRequeue <- e
+		}
+	}()
+}
+
+// evict deletes ingresses and routes whose tls hosts are overwritten by elder ones, and requeues them
+func (c *ConfigBuilder) evict() {
+	evicted := c.tlsConf.Evicted()
+	for _, name := range evicted {
+		if _, ok := c.routes[name]; ok {
+			c.deleteRoute(name)
+		} else {
+			c.deleteIngress(util.SplitNamespacedName(name))
+		}
+	}
+	c.requeueIngresses(evicted)
+}
+
+func (c *ConfigBuilder) UpdateIngress(ingress *netv1.Ingress, services map[string]*corev1.Service, endpoints map[string][]*discoveryv1.EndpointSlice, weights map[string]int, probes map[string]map[int32]*corev1.Probe, secrets []*corev1.Secret, configMaps []*corev1.ConfigMap) error {
 	c.lock.Lock()
 	defer c.lock.Unlock()
+	// conflict tls hosts may be released by this ingress
+	defer func() { c.requeueIngresses(c.tlsConf.Released()) }()
 
-	if err := c.serverDataConf.UpdateIngress(ingress); err != nil {
+	if err := c.serverDataConf.UpdateIngress(ingress, services, endpoints, probes); err != nil {
 		return err
 	}
 
-	if err := c.clusterConf.UpdateIngress(ingress, services, endpoints); err != nil {
+	if err := c.clusterConf.UpdateIngress(ingress, services, endpoints, weights); err != nil {
 		c.serverDataConf.DeleteIngress(ingress.Namespace, ingress.Name)
 		return err
 	}
@@ -68,23 +164,156 @@ func (c *ConfigBuilder) UpdateIngress(ingress *netv1.Ingress, services map[strin
 		return err
 	}
 
+	// younger ingresses claiming tls hosts of this ingress with different secrets are rejected
+	c.evict()
+
+	// update module configs, which are built from route rules of all ingresses
+	if err := c.blockConf.UpdateIngress(ingress, c.serverDataConf.RouteRules()); err != nil {
+		c.deleteIngress(ingress.Namespace, ingress.Name)
+		return err
+	}
+
+	if err := c.prisonConf.UpdateIngress(ingress, c.serverDataConf.RouteRules()); err != nil {
+		c.deleteIngress(ingress.Namespace, ingress.Name)
+		return err
+	}
+
+	if err := c.redirectConf.UpdateIngress(ingress, c.serverDataConf.RouteRules()); err != nil {
+		c.deleteIngress(ingress.Namespace, ingress.Name)
+		return err
+	}
+
+	if err := c.rewriteConf.UpdateIngress(ingress, c.serverDataConf.RouteRules()); err != nil {
+		c.deleteIngress(ingress.Namespace, ingress.Name)
+		return err
+	}
+
+	if err := c.headerConf.UpdateIngress(ingress, c.serverDataConf.RouteRules()); err != nil {
+		c.deleteIngress(ingress.Namespace, ingress.Name)
+		return err
+	}
+
+	if err := c.authBasicConf.UpdateIngress(ingress, secrets, c.serverDataConf.RouteRules()); err != nil {
+		c.deleteIngress(ingress.Namespace, ingress.Name)
+		return err
+	}
+
+	if err := c.wafConf.UpdateIngress(ingress, configMaps, c.serverDataConf.RouteRules()); err != nil {
+		c.deleteIngress(ingress.Namespace, ingress.Name)
+		return err
+	}
+
+	// canary weight may be changed by route rules of the ingress
+	c.clusterConf.UpdateCanary(c.serverDataConf.RouteRules())
+
 	return nil
 }
 
 func (c *ConfigBuilder) DeleteIngress(namespace, name string) {
 	c.lock.Lock()
 	defer c.lock.Unlock()
+	// conflict tls hosts may be released by this ingress
+	defer func() { c.requeueIngresses(c.tlsConf.Released()) }()
+
+	c.deleteIngress(namespace, name)
+}
 
+func (c *ConfigBuilder) deleteIngress(namespace, name string) {
 	c.serverDataConf.DeleteIngress(namespace, name)
 	c.clusterConf.DeleteIngress(namespace, name)
 	c.tlsConf.DeleteIngress(namespace, name)
+	c.blockConf.DeleteIngress(namespace, name, c.serverDataConf.RouteRules())
+	c.prisonConf.DeleteIngress(namespace, name, c.serverDataConf.RouteRules())
+	c.redirectConf.DeleteIngress(namespace, name, c.serverDataConf.RouteRules())
+	c.rewriteConf.DeleteIngress(namespace, name, c.serverDataConf.RouteRules())
+	c.headerConf.DeleteIngress(namespace, name, c.serverDataConf.RouteRules())
+	c.authBasicConf.DeleteIngress(namespace, name, c.serverDataConf.RouteRules())
+	c.wafConf.DeleteIngress(namespace, name, c.serverDataConf.RouteRules())
+	c.clusterConf.UpdateCanary(c.serverDataConf.RouteRules())
 }
 
-func (c *ConfigBuilder) UpdateService(service *corev1.Service, endpoint *corev1.Endpoints) {
+// UpdateRoute updates route translated from Gateway API resource, route is deleted as a whole on error
+func (c *ConfigBuilder) UpdateRoute(route *configs.Route, services map[string]*corev1.Service, endpoints map[string][]*discoveryv1.EndpointSlice, weights map[string]int, probes map[string]map[int32]*corev1.Probe, secrets []*corev1.Secret) error {
 	c.lock.Lock()
 	defer c.lock.Unlock()
+	// conflict tls hosts may be released by this route
+	defer func() { c.requeueIngresses(c.tlsConf.Released()) }()
+
+	key := util.NamespacedName(route.Namespace, route.ConfigName())
+	// delete rules removed from route
+	if old, ok := c.routes[key]; ok {
+		for i := len(route.Rules); i < len(old.Rules); i++ {
+			c.deleteIngress(old.Namespace, old.RuleName(i))
+		}
+	}
+	c.routes[key] = route
 
-	c.clusterConf.UpdateService(service, endpoint)
+	if err := c.updateRoute(route, services, endpoints, weights, probes, secrets); err != nil {
+		c.deleteRoute(key)
+		return err
+	}
+	return nil
+}
+
+func (c *ConfigBuilder) updateRoute(route *configs.Route, services map[string]*corev1.Service, endpoints map[string][]*discoveryv1.EndpointSlice, weights map[string]int, probes map[string]map[int32]*corev1.Probe, secrets []*corev1.Secret) error {
+	if err := c.serverDataConf.UpdateRoute(route, services, endpoints, probes); err != nil {
+		return err
+	}
+
+	if err := c.clusterConf.UpdateRoute(route, services, endpoints, weights); err != nil {
+		return err
+	}
+
+	if err := c.tlsConf.UpdateRoute(route, secrets); err != nil {
+		return err
+	}
+
+	// younger ingresses and routes claiming tls hosts of this route with different secrets are rejected
+	c.evict()
+
+	// update configs of modules supported by route rules
+	if err := c.redirectConf.UpdateRoute(route, c.serverDataConf.RouteRules()); err != nil {
+		return err
+	}
+
+	if err := c.headerConf.UpdateRoute(route, c.serverDataConf.RouteRules()); err != nil {
+		return err
+	}
+
+	c.clusterConf.UpdateCanary(c.serverDataConf.RouteRules())
+
+	return nil
+}
+
+// DeleteRoute deletes route translated from Gateway API resource of kind
+func (c *ConfigBuilder) DeleteRoute(kind, namespace, name string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	// conflict tls hosts may be released by this route
+	defer func() { c.requeueIngresses(c.tlsConf.Released()) }()
+
+	key := util.NamespacedName(namespace, configs.RouteConfigName(kind, name))
+	if _, ok := c.routes[key]; !ok {
+		return
+	}
+	c.deleteRoute(key)
+	delete(c.routes, key)
+}
+
+// deleteRoute deletes rules and tls of route from configs, route is kept for requeue
+func (c *ConfigBuilder) deleteRoute(key string) {
+	route := c.routes[key]
+	c.deleteIngress(route.Namespace, route.ConfigName())
+	for i := range route.Rules {
+		c.deleteIngress(route.Namespace, route.RuleName(i))
+	}
+}
+
+func (c *ConfigBuilder) UpdateService(service *corev1.Service, slices []*discoveryv1.EndpointSlice, weights map[string]int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.clusterConf.UpdateService(service, slices, weights)
 }
 
 func (c *ConfigBuilder) DeleteService(namespace, name string) {
@@ -101,6 +330,9 @@ func (c *ConfigBuilder) UpdateSecret(secret *corev1.Secret) error {
 	if err := c.tlsConf.UpdateSecret(secret); err != nil {
 		return err
 	}
+	if err := c.authBasicConf.UpdateSecret(secret); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -109,6 +341,21 @@ func (c *ConfigBuilder) DeleteSecret(namespace, name string) {
 	defer c.lock.Unlock()
 
 	c.tlsConf.DeleteSecret(namespace, name)
+	c.authBasicConf.DeleteSecret(namespace, name)
+}
+
+func (c *ConfigBuilder) UpdateConfigMap(configMap *corev1.ConfigMap) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.wafConf.UpdateConfigMap(configMap, c.serverDataConf.RouteRules())
+}
+
+func (c *ConfigBuilder) DeleteConfigMap(namespace, name string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.wafConf.DeleteConfigMap(namespace, name, c.serverDataConf.RouteRules())
 }
 
 func (c *ConfigBuilder) InitReload(ctx context.Context) {
@@ -135,6 +382,43 @@ func (c *ConfigBuilder) reload() error {
 	c.lock.Lock()
 	defer c.lock.Unlock()
 
+	// security modules are reloaded before route rules, so that new routes are never served without
+	// protection, even if reloading fails halfway
+	if err := c.trustIPConf.Reload(); err != nil {
+		log.Error(err, "Fail to reload config",
+			"trustIPConf",
+			c.trustIPConf)
+		return err
+	}
+
+	if err := c.blockConf.Reload(); err != nil {
+		log.Error(err, "Fail to reload config",
+			"blockConf",
+			c.blockConf)
+		return err
+	}
+
+	if err := c.prisonConf.Reload(); err != nil {
+		log.Error(err, "Fail to reload config",
+			"prisonConf",
+			c.prisonConf)
+		return err
+	}
+
+	if err := c.authBasicConf.Reload(); err != nil {
+		log.Error(err, "Fail to reload config",
+			"authBasicConf",
+			c.authBasicConf)
+		return err
+	}
+
+	if err := c.wafConf.Reload(); err != nil {
+		log.Error(err, "Fail to reload config",
+			"wafConf",
+			c.wafConf)
+		return err
+	}
+
 	if err := c.serverDataConf.Reload(); err != nil {
 		log.Error(err, "Fail to reload config",
 			"serverDataConf",
@@ -155,5 +439,26 @@ func (c *ConfigBuilder) reload() error {
 			c.tlsConf)
 		return err
 	}
+
+	if err := c.redirectConf.Reload(); err != nil {
+		log.Error(err, "Fail to reload config",
+			"redirectConf",
+			c.redirectConf)
+		return err
+	}
+
+	if err := c.rewriteConf.Reload(); err != nil {
+		log.Error(err, "Fail to reload config",
+			"rewriteConf",
+			c.rewriteConf)
+		return err
+	}
+
+	if err := c.headerConf.Reload(); err != nil {
+		log.Error(err, "Fail to reload config",
+			"headerConf",
+			c.headerConf)
+		return err
+	}
 	return nil
 }
@@ -15,11 +15,15 @@ package configs
 
 import (
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/bfenetworks/bfe/bfe_config/bfe_tls_conf/server_cert_conf"
 	"github.com/bfenetworks/bfe/bfe_config/bfe_tls_conf/tls_rule_conf"
 	"github.com/bfenetworks/bfe/bfe_tls"
 	"github.com/bfenetworks/ingress-bfe/internal/bfeConfig/util"
+	"github.com/bfenetworks/ingress-bfe/internal/option"
 	"github.com/jwangsadinata/go-multimap/setmultimap"
 	corev1 "k8s.io/api/core/v1"
 	netv1 "k8s.io/api/networking/v1"
@@ -32,6 +36,16 @@ const (
 type certConf struct {
 	cert []byte
 	key  []byte
+
+	// CN and SANs of certificate
+	names []string
+}
+
+// tlsHostRule records ingress which claims host in spec.tls with a secret
+type tlsHostRule struct {
+	ingress    string
+	secret     string
+	createTime time.Time
 }
 
 var (
@@ -51,6 +65,14 @@ type TLSConfig struct {
 
 	ingress2secret *setmultimap.MultiMap
 
+	// host -> rules, all rules of a host refer to the same secret
+	hostRules map[string][]*tlsHostRule
+	// host -> ingresses rejected for claiming host with different secret
+	conflicts map[string]map[string]bool
+	// ingresses overwritten by elder ingresses, and rejected ingresses whose conflict hosts are released
+	evicted  map[string]bool
+	released map[string]bool
+
 	serverCertConf *server_cert_conf.BfeServerCertConf
 	tlsRuleConf    *tls_rule_conf.BfeTlsRuleConf
 	certs          map[string]certConf
@@ -59,6 +81,10 @@ type TLSConfig struct {
 func NewTLSConfig(version string) *TLSConfig {
 	tlsConf := &TLSConfig{
 		ingress2secret: setmultimap.New(),
+		hostRules:      make(map[string][]*tlsHostRule),
+		conflicts:      make(map[string]map[string]bool),
+		evicted:        make(map[string]bool),
+		released:       make(map[string]bool),
 		serverCertConf: newServerCertConf(version),
 		tlsRuleConf:    newTlsRuleConf(version),
 		certs:          make(map[string]certConf),
@@ -102,8 +128,20 @@ func (c *TLSConfig) setVersion() {
 	c.tlsRuleConf.Version = version
 }
 
+// UpdateIngress updates certificates and tls rules of ingress.
+// Secrets not in spec.tls, e.g. secret of basic auth, are ignored.
 func (c *TLSConfig) UpdateIngress(ingress *netv1.Ingress, secrets []*corev1.Secret) error {
-	ingressName := util.NamespacedName(ingress.Namespace, ingress.Name)
+	return c.update(newIngressSource(ingress), secrets)
+}
+
+// UpdateRoute updates certificates and tls rules of route, which are named by ConfigName of route
+func (c *TLSConfig) UpdateRoute(route *Route, secrets []*corev1.Secret) error {
+	return c.update(route.tlsSource(), secrets)
+}
+
+func (c *TLSConfig) update(src *ruleSource, secrets []*corev1.Secret) error {
+	ingressName := util.NamespacedName(src.namespace, src.name)
+	secrets = tlsSecrets(src, secrets)
 	for _, secret := range secrets {
 		secretName := util.NamespacedName(secret.Namespace, secret.Name)
 		c.ingress2secret.Put(ingressName, secretName)
@@ -115,9 +153,200 @@ func (c *TLSConfig) UpdateIngress(ingress *netv1.Ingress, secrets []*corev1.Secr
 		}
 	}
 
+	if err := c.updateHostRules(src); err != nil {
+		c.DeleteIngress(src.namespace, src.name)
+		return err
+	}
+	c.deleteConflicts(ingressName)
+
 	return nil
 }
 
+// Evicted returns ingresses whose tls hosts are overwritten by elder ingresses since last call.
+// They should be deleted, and reconciled again to report the conflict.
+func (c *TLSConfig) Evicted() []string {
+	return popIngresses(c.evicted)
+}
+
+// Released returns ingresses rejected for conflict tls hosts, which are not claimed by others since last call.
+// They should be reconciled again.
+func (c *TLSConfig) Released() []string {
+	return popIngresses(c.released)
+}
+
+func popIngresses(ingresses map[string]bool) []string {
+	var result []string
+	for ingress := range ingresses {
+		result = append(result, ingress)
+		delete(ingresses, ingress)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// tlsSecrets returns secrets referred by spec.tls of ingress
+func tlsSecrets(src *ruleSource, secrets []*corev1.Secret) []*corev1.Secret {
+	var result []*corev1.Secret
+	for _, secret := range secrets {
+		for _, tls := range src.tls {
+			if secret.Namespace == src.namespace && secret.Name == tls.SecretName {
+				result = append(result, secret)
+				break
+			}
+		}
+	}
+	return result
+}
+
+// updateHostRules maps hosts in spec.tls of ingress to their secrets
+func (c *TLSConfig) updateHostRules(src *ruleSource) error {
+	ingressName := util.NamespacedName(src.namespace, src.name)
+	c.deleteHostRules(ingressName)
+
+	for _, tls := range src.tls {
+		secretName := util.NamespacedName(src.namespace, tls.SecretName)
+		for _, host := range tls.Hosts {
+			if err := checkHost(host); err != nil {
+				return err
+			}
+			host = strings.ToLower(host)
+
+			rule := &tlsHostRule{
+				ingress:    ingressName,
+				secret:     secretName,
+				createTime: src.createTime,
+			}
+			if err := c.putHostRule(host, rule); err != nil {
+				c.putConflict(host, ingressName)
+				return err
+			}
+
+			if cert, ok := c.certs[secretName]; ok && !matchCertNames(cert.names, host) {
+				log.V(0).Info("certificate does not match host, host is not served with the certificate", "ingress", ingressName, "host", host, "secret", secretName)
+			}
+		}
+	}
+
+	c.updateTlsRuleConf()
+	c.releaseConflicts()
+	return nil
+}
+
+func (c *TLSConfig) putHostRule(host string, rule *tlsHostRule) error {
+	rules := c.hostRules[host]
+	for _, r := range rules {
+		if r.ingress == rule.ingress && r.secret == rule.secret {
+			return nil
+		}
+	}
+
+	if len(rules) == 0 || rules[0].secret == rule.secret {
+		c.hostRules[host] = append(rules, rule)
+		return nil
+	}
+
+	// host is claimed with different secret, elder ingress is valid
+	for _, r := range rules {
+		if !rule.createTime.Before(r.createTime) {
+			return fmt.Errorf("ingress [%s] conflict with existing %s, tls host [%s] with different secret [%s]", rule.ingress, r.ingress, host, r.secret)
+		}
+	}
+	for _, r := range rules {
+		log.V(0).Info("tls host is overwritten by elder ingress", "ingress", rule.ingress, "host", host, "old-ingress", r.ingress)
+		c.putConflict(host, r.ingress)
+		c.evicted[r.ingress] = true
+	}
+	c.hostRules[host] = []*tlsHostRule{rule}
+	return nil
+}
+
+func (c *TLSConfig) putConflict(host string, ingressName string) {
+	if _, ok := c.conflicts[host]; !ok {
+		c.conflicts[host] = make(map[string]bool)
+	}
+	c.conflicts[host][ingressName] = true
+}
+
+// deleteConflicts removes ingress accepted with all its tls hosts
+func (c *TLSConfig) deleteConflicts(ingressName string) {
+	for host, ingresses := range c.conflicts {
+		delete(ingresses, ingressName)
+		if len(ingresses) == 0 {
+			delete(c.conflicts, host)
+		}
+	}
+}
+
+// releaseConflicts marks ingresses rejected for hosts not claimed anymore as released
+func (c *TLSConfig) releaseConflicts() {
+	for host, ingresses := range c.conflicts {
+		if _, ok := c.hostRules[host]; ok {
+			continue
+		}
+		for ingress := range ingresses {
+			c.released[ingress] = true
+		}
+		delete(c.conflicts, host)
+	}
+}
+
+func (c *TLSConfig) deleteHostRules(ingressName string) {
+	for host, rules := range c.hostRules {
+		var result []*tlsHostRule
+		for _, r := range rules {
+			if r.ingress != ingressName {
+				result = append(result, r)
+			}
+		}
+		if len(result) == 0 {
+			delete(c.hostRules, host)
+		} else {
+			c.hostRules[host] = result
+		}
+	}
+}
+
+// updateTlsRuleConf builds tls rule for each secret, with hosts using it as sni
+func (c *TLSConfig) updateTlsRuleConf() {
+	ruleMap := make(tls_rule_conf.TlsRuleMap)
+	for host, rules := range c.hostRules {
+		secretName := rules[0].secret
+
+		// certificate must exist for tls rule
+		if _, ok := c.serverCertConf.Config.CertConf[secretName]; !ok {
+			continue
+		}
+		// bfe rejects the whole tls conf if sni is not included in certificate
+		if !matchCertNames(c.certs[secretName].names, host) {
+			continue
+		}
+		rule, ok := ruleMap[secretName]
+		if !ok {
+			rule = &tls_rule_conf.TlsRuleConf{
+				CertName: secretName,
+				Grade:    bfe_tls.GradeC,
+			}
+			ruleMap[secretName] = rule
+		}
+
+		// certificate of wildcard host is selected by names of certificate, sni of tls rule only supports exact match
+		if !wildcardHost(host) {
+			rule.SniConf = append(rule.SniConf, host)
+		}
+	}
+
+	for _, rule := range ruleMap {
+		sort.Strings(rule.SniConf)
+	}
+
+	c.tlsRuleConf.Config = ruleMap
+}
+
+// matchCertNames returns true if host matches one of names of certificate, the same as bfe checks sni of tls rule
+func matchCertNames(names []string, host string) bool {
+	return tls_rule_conf.MatchCertNames(names, host)
+}
+
 func (c *TLSConfig) DeleteIngress(namespace, name string) {
 	ingressName := util.NamespacedName(namespace, name)
 	if !c.ingress2secret.ContainsKey(ingressName) {
@@ -125,9 +354,10 @@ func (c *TLSConfig) DeleteIngress(namespace, name string) {
 	}
 
 	c.ingress2secret.RemoveAll(ingressName)
+	c.deleteHostRules(ingressName)
+	c.releaseConflicts()
 
 	// check all certs to find which one should be deleted
-	updated := false
 	secrets := c.ingress2secret.Values()
 	for name := range c.certs {
 		found := false
@@ -138,15 +368,13 @@ func (c *TLSConfig) DeleteIngress(namespace, name string) {
 				found = true
 			}
 		}
-		if !found {
+		if !found && !isDefaultCert(name) {
 			// not used anymore, delete it
 			c.deleteCert(name)
-			updated = true
 		}
 	}
-	if updated {
-		c.setVersion()
-	}
+	c.updateTlsRuleConf()
+	c.setVersion()
 }
 
 func (c *TLSConfig) deleteCert(name string) {
@@ -160,15 +388,64 @@ func (c *TLSConfig) deleteCert(name string) {
 
 func (c *TLSConfig) UpdateSecret(secret *corev1.Secret) error {
 	name := util.NamespacedName(secret.Namespace, secret.Name)
+	if isDefaultCert(name) {
+		if err := c.updateDefaultCert(secret); err != nil {
+			return err
+		}
+	}
+
 	if !c.ingress2secret.ContainsValue(name) {
 		return nil
 	}
 
-	_, err := bfe_tls.X509KeyPair(secret.Data[SecretCrt], secret.Data[SecretKey])
+	cert, err := bfe_tls.X509KeyPair(secret.Data[SecretCrt], secret.Data[SecretKey])
 	if err != nil {
 		return err
 	}
 
+	c.putCert(name, secret, &cert)
+
+	c.updateTlsRuleConf()
+	c.setVersion()
+
+	return nil
+}
+
+// updateDefaultCert uses certificate in secret as default certificate,
+// built-in certificate is used if secret is invalid
+func (c *TLSConfig) updateDefaultCert(secret *corev1.Secret) error {
+	name := util.NamespacedName(secret.Namespace, secret.Name)
+
+	cert, err := bfe_tls.X509KeyPair(secret.Data[SecretCrt], secret.Data[SecretKey])
+	if err != nil {
+		c.resetDefaultCert()
+		return fmt.Errorf("invalid default ssl certificate [%s]: %s", name, err)
+	}
+
+	c.putCert(name, secret, &cert)
+	c.serverCertConf.Config.Default = name
+	c.setVersion()
+
+	return nil
+}
+
+// resetDefaultCert uses built-in certificate as default certificate
+func (c *TLSConfig) resetDefaultCert() {
+	name := option.Opts.Ingress.DefaultSSLCertificate
+	if c.serverCertConf.Config.Default == DefaultCNName {
+		return
+	}
+
+	c.serverCertConf.Config.Default = DefaultCNName
+	if !c.ingress2secret.ContainsValue(name) {
+		c.deleteCert(name)
+	}
+
+	c.updateTlsRuleConf()
+	c.setVersion()
+}
+
+func (c *TLSConfig) putCert(name string, secret *corev1.Secret, cert *bfe_tls.Certificate) {
 	serverCertConf := server_cert_conf.ServerCertConf{
 		ServerCertFile:   getCertFilePath(name),
 		ServerKeyFile:    getKeyFilePath(name),
@@ -177,17 +454,17 @@ func (c *TLSConfig) UpdateSecret(secret *corev1.Secret) error {
 
 	c.serverCertConf.Config.CertConf[name] = serverCertConf
 	c.certs[name] = certConf{
-		cert: secret.Data[SecretCrt],
-		key:  secret.Data[SecretKey],
+		cert:  secret.Data[SecretCrt],
+		key:   secret.Data[SecretKey],
+		names: server_cert_conf.GetNamesForCert(cert),
 	}
-
-	c.setVersion()
-
-	return nil
 }
 
 func (c *TLSConfig) DeleteSecret(namespace, name string) {
 	target := util.NamespacedName(namespace, name)
+	if isDefaultCert(target) {
+		c.resetDefaultCert()
+	}
 
 	if !c.ingress2secret.ContainsValue(target) {
 		return
@@ -195,6 +472,7 @@ func (c *TLSConfig) DeleteSecret(namespace, name string) {
 
 	c.deleteCert(target)
 
+	c.updateTlsRuleConf()
 	c.setVersion()
 }
 
@@ -239,6 +517,11 @@ func (c *TLSConfig) Reload() error {
 	return nil
 }
 
+// isDefaultCert returns true if secret is configured as default ssl certificate
+func isDefaultCert(name string) bool {
+	return len(option.Opts.Ingress.DefaultSSLCertificate) > 0 && option.Opts.Ingress.DefaultSSLCertificate == name
+}
+
 func getCertFilePath(name string) string {
 	return CertKeyFilePath + name + ".crt"
 }
@@ -0,0 +1,251 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package configs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bfenetworks/bfe/bfe_config/bfe_tls_conf/tls_rule_conf"
+	"github.com/bfenetworks/bfe/bfe_tls"
+	corev1 "k8s.io/api/core/v1"
+	netv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/bfenetworks/ingress-bfe/internal/option"
+)
+
+func setTestOptions(t *testing.T) {
+	opts := option.NewOptions()
+	opts.Ingress.BfeBinary = ""
+	opts.Ingress.ConfigPath = t.TempDir()
+	if err := option.SetOptions(opts); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTestSecret(t *testing.T, name string, hosts ...string) *corev1.Secret {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: hosts[0]},
+		DNSNames:     hosts,
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+		Data: map[string][]byte{
+			SecretCrt: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+			SecretKey: pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}),
+		},
+	}
+}
+
+func newTestTLSIngress(name string, createTime time.Time, secret string, hosts ...string) *netv1.Ingress {
+	return &netv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:         "default",
+			Name:              name,
+			CreationTimestamp: metav1.NewTime(createTime),
+		},
+		Spec: netv1.IngressSpec{
+			TLS: []netv1.IngressTLS{{Hosts: hosts, SecretName: secret}},
+		},
+	}
+}
+
+func TestTLSConfig_UpdateIngress(t *testing.T) {
+	setTestOptions(t)
+
+	now := time.Now()
+	secret1 := newTestSecret(t, "secret1", "foo.com", "*.foo.com")
+	secret2 := newTestSecret(t, "secret2", "foo.com")
+
+	c := NewTLSConfig("init")
+	ingress1 := newTestTLSIngress("ingress1", now, "secret1", "foo.com", "*.foo.com")
+	if err := c.UpdateIngress(ingress1, []*corev1.Secret{secret1}); err != nil {
+		t.Fatalf("UpdateIngress() error: %s", err)
+	}
+
+	rule, ok := c.tlsRuleConf.Config["default/secret1"]
+	if !ok {
+		t.Fatalf("tls rule of secret1 not found")
+	}
+	if rule.CertName != "default/secret1" || !reflect.DeepEqual(rule.SniConf, []string{"foo.com"}) {
+		t.Errorf("tls rule of secret1 = %+v", rule)
+	}
+
+	// same host with same secret is allowed
+	ingress2 := newTestTLSIngress("ingress2", now.Add(time.Second), "secret1", "foo.com")
+	if err := c.UpdateIngress(ingress2, []*corev1.Secret{secret1}); err != nil {
+		t.Errorf("UpdateIngress() with same secret error: %s", err)
+	}
+
+	// same host with different secret, younger ingress is invalid
+	ingress3 := newTestTLSIngress("ingress3", now.Add(time.Second), "secret2", "FOO.com")
+	if err := c.UpdateIngress(ingress3, []*corev1.Secret{secret2}); err == nil {
+		t.Errorf("UpdateIngress() should fail for conflict host")
+	}
+	if _, ok := c.tlsRuleConf.Config["default/secret2"]; ok {
+		t.Errorf("tls rule of secret2 should not exist")
+	}
+
+	// elder ingress overwrites host
+	ingress4 := newTestTLSIngress("ingress4", now.Add(-time.Second), "secret2", "foo.com")
+	if err := c.UpdateIngress(ingress4, []*corev1.Secret{secret2}); err != nil {
+		t.Errorf("UpdateIngress() of elder ingress error: %s", err)
+	}
+	if rule := c.tlsRuleConf.Config["default/secret2"]; rule == nil || !reflect.DeepEqual(rule.SniConf, []string{"foo.com"}) {
+		t.Errorf("tls rule of secret2 = %+v", rule)
+	}
+
+	// overwritten ingresses are evicted, and deleted by config builder
+	evicted := c.Evicted()
+	if want := []string{"default/ingress1", "default/ingress2"}; !reflect.DeepEqual(evicted, want) {
+		t.Errorf("Evicted() = %v, want %v", evicted, want)
+	}
+	if evicted := c.Evicted(); len(evicted) != 0 {
+		t.Errorf("Evicted() = %v, want empty after popped", evicted)
+	}
+	c.DeleteIngress("default", "ingress1")
+	c.DeleteIngress("default", "ingress2")
+	if released := c.Released(); len(released) != 0 {
+		t.Errorf("Released() = %v, want empty while host is claimed", released)
+	}
+
+	// rejected and evicted ingresses are released after elder ingress deleted
+	c.DeleteIngress("default", "ingress4")
+	if want, released := []string{"default/ingress1", "default/ingress2", "default/ingress3"}, c.Released(); !reflect.DeepEqual(released, want) {
+		t.Errorf("Released() = %v, want %v", released, want)
+	}
+	if len(c.hostRules) != 0 || len(c.tlsRuleConf.Config) != 0 || len(c.conflicts) != 0 {
+		t.Errorf("tls rules should be deleted, hosts: %v, rules: %v", c.hostRules, c.tlsRuleConf.Config)
+	}
+
+	// released ingress claims host again
+	if err := c.UpdateIngress(ingress1, []*corev1.Secret{secret1}); err != nil {
+		t.Errorf("UpdateIngress() of released ingress error: %s", err)
+	}
+	c.DeleteIngress("default", "ingress1")
+	if len(c.hostRules) != 0 || len(c.tlsRuleConf.Config) != 0 {
+		t.Errorf("tls rules should be deleted, hosts: %v, rules: %v", c.hostRules, c.tlsRuleConf.Config)
+	}
+}
+
+func TestTLSConfig_CertNotMatchHost(t *testing.T) {
+	setTestOptions(t)
+
+	secret := newTestSecret(t, "secret1", "foo.com")
+	c := NewTLSConfig("init")
+	ingress := newTestTLSIngress("ingress1", time.Now(), "secret1", "foo.com", "bar.com", "*.foo.com")
+	if err := c.UpdateIngress(ingress, []*corev1.Secret{secret}); err != nil {
+		t.Fatalf("UpdateIngress() error: %s", err)
+	}
+
+	// host not included in certificate is not used as sni, otherwise bfe rejects tls conf
+	rule := c.tlsRuleConf.Config["default/secret1"]
+	if rule == nil || !reflect.DeepEqual(rule.SniConf, []string{"foo.com"}) {
+		t.Fatalf("tls rule of secret1 = %+v", rule)
+	}
+	cert, err := bfe_tls.X509KeyPair(secret.Data[SecretCrt], secret.Data[SecretKey])
+	if err != nil {
+		t.Fatal(err)
+	}
+	certs := map[string]*bfe_tls.Certificate{"default/secret1": &cert}
+	if err := tls_rule_conf.CheckTlsConf(certs, c.tlsRuleConf.Config); err != nil {
+		t.Errorf("CheckTlsConf() error: %s", err)
+	}
+}
+
+func TestTLSConfig_DefaultCert(t *testing.T) {
+	setTestOptions(t)
+	option.Opts.Ingress.DefaultSSLCertificate = "default/default-cert"
+
+	c := NewTLSConfig("init")
+
+	// secret not used by ingress or default certificate is ignored
+	if err := c.UpdateSecret(newTestSecret(t, "other", "foo.com")); err != nil || len(c.certs) != 0 {
+		t.Errorf("UpdateSecret() should ignore unused secret")
+	}
+
+	secret := newTestSecret(t, "default-cert", "foo.com")
+	if err := c.UpdateSecret(secret); err != nil {
+		t.Fatalf("UpdateSecret() error: %s", err)
+	}
+	if c.serverCertConf.Config.Default != "default/default-cert" {
+		t.Errorf("default cert = %s, want secret", c.serverCertConf.Config.Default)
+	}
+
+	// fall back to built-in certificate if secret is invalid
+	invalid := secret.DeepCopy()
+	invalid.Data[SecretKey] = []byte("invalid")
+	if err := c.UpdateSecret(invalid); err == nil {
+		t.Errorf("UpdateSecret() should fail for invalid secret")
+	}
+	if c.serverCertConf.Config.Default != DefaultCNName {
+		t.Errorf("default cert = %s, want built-in", c.serverCertConf.Config.Default)
+	}
+	if _, ok := c.serverCertConf.Config.CertConf["default/default-cert"]; ok {
+		t.Errorf("invalid default cert should be deleted")
+	}
+
+	// fall back to built-in certificate if secret is deleted
+	if err := c.UpdateSecret(secret); err != nil {
+		t.Fatalf("UpdateSecret() error: %s", err)
+	}
+	c.DeleteSecret("default", "default-cert")
+	if c.serverCertConf.Config.Default != DefaultCNName {
+		t.Errorf("default cert = %s, want built-in", c.serverCertConf.Config.Default)
+	}
+}
+
+func Test_matchCertNames(t *testing.T) {
+	names := []string{"foo.com", "*.bar.com"}
+
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"foo.com", true},
+		{"a.bar.com", true},
+		{"*.bar.com", true},
+		{"a.foo.com", false},
+	}
+	for _, tt := range tests {
+		if got := matchCertNames(names, tt.host); got != tt.want {
+			t.Errorf("matchCertNames(%s) = %v, want %v", tt.host, got, tt.want)
+		}
+	}
+}
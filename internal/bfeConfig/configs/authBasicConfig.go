@@ -0,0 +1,245 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package configs
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/bfenetworks/bfe/bfe_modules/mod_auth_basic"
+	corev1 "k8s.io/api/core/v1"
+	netv1 "k8s.io/api/networking/v1"
+
+	"github.com/bfenetworks/ingress-bfe/internal/bfeConfig/annotations"
+	"github.com/bfenetworks/ingress-bfe/internal/bfeConfig/util"
+	"github.com/bfenetworks/ingress-bfe/internal/option"
+)
+
+const (
+	ConfigNameAuthBasic = "mod_auth_basic"
+)
+
+var (
+	AuthBasicData     = "mod_auth_basic/auth_basic_rule.data"
+	AuthBasicUserPath = "mod_auth_basic/users/"
+
+	// key of htpasswd data in secret of basic auth
+	SecretAuth = "auth"
+)
+
+type AuthBasicConfig struct {
+	moduleRule
+
+	// ingress -> basic auth
+	auths map[string]*annotations.AuthBasic
+	// secret -> users in htpasswd format, for secrets referred by auths.
+	// Users of deleted or invalid secret are empty, so all requests are rejected.
+	users map[string][]byte
+	// user files written to disk, which are deleted after not referred
+	userFiles map[string]bool
+}
+
+func NewAuthBasicConfig(version string) *AuthBasicConfig {
+	c := &AuthBasicConfig{
+		auths:     make(map[string]*annotations.AuthBasic),
+		users:     make(map[string][]byte),
+		userFiles: make(map[string]bool),
+	}
+	c.moduleRule = newModuleRule(ConfigNameAuthBasic, AuthBasicData, version, c)
+	return c
+}
+
+func newAuthBasicConfFile(version string) *mod_auth_basic.AuthBasicConfFile {
+	productRules := make(mod_auth_basic.ProductRulesFile)
+	productRules[DefaultProduct] = &mod_auth_basic.RuleFileList{}
+
+	return &mod_auth_basic.AuthBasicConfFile{
+		Version: &version,
+		Config:  &productRules,
+	}
+}
+
+// UpdateIngress updates basic auth rules of ingress, routes should contain rules of the ingress.
+// Secret of basic auth should be in secrets.
+func (c *AuthBasicConfig) UpdateIngress(ingress *netv1.Ingress, secrets []*corev1.Secret, routes *RouteRuleCache) error {
+	ingressName := util.NamespacedName(ingress.Namespace, ingress.Name)
+
+	auth, err := annotations.GetAuthBasic(ingress.Annotations)
+	if err != nil {
+		return err
+	}
+
+	var users []byte
+	if auth != nil {
+		secretName := util.NamespacedName(ingress.Namespace, auth.Secret)
+		secret := findSecret(secrets, ingress.Namespace, auth.Secret)
+		if secret == nil {
+			return fmt.Errorf("secret [%s] of basic auth not found", secretName)
+		}
+		if users, err = parseUsers(secret.Data[SecretAuth]); err != nil {
+			return fmt.Errorf("secret [%s] of basic auth is illegal: %s", secretName, err)
+		}
+	}
+
+	return c.updateIngress(ingressName, func() {
+		if auth != nil {
+			c.auths[ingressName] = auth
+			c.setUsers(util.NamespacedName(ingress.Namespace, auth.Secret), users)
+		}
+	}, routes)
+}
+
+// UpdateSecret updates users of basic auth, if secret is referred by ingresses
+func (c *AuthBasicConfig) UpdateSecret(secret *corev1.Secret) error {
+	name := util.NamespacedName(secret.Namespace, secret.Name)
+	if _, ok := c.users[name]; !ok {
+		return nil
+	}
+
+	users, err := parseUsers(secret.Data[SecretAuth])
+	if err != nil {
+		c.setUsers(name, []byte{})
+		return fmt.Errorf("secret [%s] of basic auth is illegal: %s", name, err)
+	}
+	c.setUsers(name, users)
+	return nil
+}
+
+// DeleteSecret removes users of basic auth, requests to ingresses referring the secret are rejected
+func (c *AuthBasicConfig) DeleteSecret(namespace, name string) {
+	secretName := util.NamespacedName(namespace, name)
+	if _, ok := c.users[secretName]; !ok {
+		return
+	}
+	c.setUsers(secretName, []byte{})
+}
+
+func (c *AuthBasicConfig) setUsers(secret string, users []byte) {
+	if old, ok := c.users[secret]; ok && bytes.Equal(old, users) {
+		return
+	}
+	c.users[secret] = users
+	c.renewVersion()
+}
+
+// cleanUsers removes users of secrets not referred by any ingress
+func (c *AuthBasicConfig) cleanUsers() {
+	referred := make(map[string]bool)
+	for ingress, auth := range c.auths {
+		namespace, _ := util.SplitNamespacedName(ingress)
+		referred[util.NamespacedName(namespace, auth.Secret)] = true
+	}
+	for secret := range c.users {
+		if !referred[secret] {
+			delete(c.users, secret)
+		}
+	}
+}
+
+func (c *AuthBasicConfig) hasRule(rule *httpRule) bool {
+	_, ok := c.auths[rule.ingress]
+	return ok
+}
+
+func (c *AuthBasicConfig) removeIngress(ingress string) {
+	delete(c.auths, ingress)
+}
+
+func (c *AuthBasicConfig) buildConf(version string, rules []ingressRule) (moduleConf, error) {
+	// secrets of removed ingresses may be no longer referred
+	c.cleanUsers()
+
+	authBasicConfFile := newAuthBasicConfFile(version)
+	ruleList := (*authBasicConfFile.Config)[DefaultProduct]
+	for _, rule := range rules {
+		auth := c.auths[rule.ingress]
+		namespace, _ := util.SplitNamespacedName(rule.ingress)
+		*ruleList = append(*ruleList, mod_auth_basic.AuthBasicRuleFile{
+			Cond:     rule.condition,
+			UserFile: getUserFilePath(util.NamespacedName(namespace, auth.Secret)),
+			Realm:    auth.Realm,
+		})
+	}
+
+	if err := mod_auth_basic.AuthBasicConfCheck(*authBasicConfFile); err != nil {
+		return moduleConf{}, fmt.Errorf("fail to check generated auth basic conf, err: %s", err)
+	}
+
+	return moduleConf{file: authBasicConfFile, version: authBasicConfFile.Version, rules: authBasicConfFile.Config}, nil
+}
+
+func (c *AuthBasicConfig) Reload() error {
+	if !c.changed() {
+		return nil
+	}
+
+	// user files are read by bfe when rules are reloaded
+	for secret, users := range c.users {
+		if err := util.DumpFile(AuthBasicUserPath+secret, users); err != nil {
+			return fmt.Errorf("dump user file of %s error: %v", secret, err)
+		}
+		c.userFiles[secret] = true
+	}
+	if err := c.moduleRule.Reload(); err != nil {
+		return err
+	}
+
+	for secret := range c.userFiles {
+		if _, ok := c.users[secret]; !ok {
+			util.DeleteFile(AuthBasicUserPath + secret)
+			delete(c.userFiles, secret)
+		}
+	}
+
+	return nil
+}
+
+// parseUsers checks htpasswd data, and returns users in format of "user:hashed-password[:comment]" per line.
+// Comment lines are dropped, as lines containing '#' are ignored by bfe.
+func parseUsers(data []byte) ([]byte, error) {
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.Contains(line, "#") {
+			return nil, fmt.Errorf("line [%s] should not contain '#'", line)
+		}
+		parts := strings.Split(line, ":")
+		if (len(parts) != 2 && len(parts) != 3) || len(strings.TrimSpace(parts[0])) == 0 || len(strings.TrimSpace(parts[1])) == 0 {
+			return nil, fmt.Errorf("line [%s] should be in format of user:hashed-password[:comment]", line)
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("no user found in key %s", SecretAuth)
+	}
+	return []byte(strings.Join(lines, "\n") + "\n"), nil
+}
+
+func findSecret(secrets []*corev1.Secret, namespace, name string) *corev1.Secret {
+	for _, secret := range secrets {
+		if secret.Namespace == namespace && secret.Name == name {
+			return secret
+		}
+	}
+	return nil
+}
+
+// getUserFilePath returns absolute path of user file, which is read by bfe directly
+func getUserFilePath(secret string) string {
+	return option.Opts.Ingress.ConfigPath + AuthBasicUserPath + secret
+}
@@ -0,0 +1,135 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package configs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bfenetworks/bfe/bfe_modules/mod_auth_basic"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/bfenetworks/ingress-bfe/internal/bfeConfig/annotations"
+)
+
+func newTestAuthSecret(name, users string) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+		Data:       map[string][]byte{SecretAuth: []byte(users)},
+	}
+}
+
+func TestAuthBasicConfig_UpdateIngress(t *testing.T) {
+	setTestOptions(t)
+
+	s := NewServerDataConfig("init")
+	c := NewAuthBasicConfig("init")
+
+	ingress := newTestIngress("ingress1", time.Now(), map[string]string{
+		annotations.AuthTypeAnnotation:   "basic",
+		annotations.AuthSecretAnnotation: "basic-auth",
+		annotations.AuthRealmAnnotation:  "dashboard",
+	}, "foo.com", "/")
+	secret := newTestAuthSecret("basic-auth", "# admin\nadmin:$apr1$mI7SilJz$CWwYJyYKbhVDNl26sdUSh/\n")
+	updateTestRoutes(t, s, ingress)
+
+	// secret not found
+	if err := c.UpdateIngress(ingress, nil, s.RouteRules()); err == nil {
+		t.Fatalf("UpdateIngress() should fail without secret")
+	}
+
+	if err := c.UpdateIngress(ingress, []*corev1.Secret{secret}, s.RouteRules()); err != nil {
+		t.Fatalf("UpdateIngress() error: %s", err)
+	}
+	rules := *(*c.conf.file.(*mod_auth_basic.AuthBasicConfFile).Config)[DefaultProduct]
+	if len(rules) != 1 {
+		t.Fatalf("auth basic rules = %d, want 1", len(rules))
+	}
+	if want := getUserFilePath("default/basic-auth"); rules[0].UserFile != want || rules[0].Realm != "dashboard" {
+		t.Errorf("auth basic rule = %+v, want user file %s", rules[0], want)
+	}
+	if got, want := string(c.users["default/basic-auth"]), "admin:$apr1$mI7SilJz$CWwYJyYKbhVDNl26sdUSh/\n"; got != want {
+		t.Errorf("users = %q, want %q", got, want)
+	}
+
+	// users are emptied if secret is deleted, so that requests are rejected
+	version := *c.conf.version
+	c.DeleteSecret("default", "basic-auth")
+	if len(c.users["default/basic-auth"]) != 0 || *c.conf.version == version {
+		t.Errorf("users should be emptied with new version after secret deleted")
+	}
+	if err := c.UpdateSecret(newTestAuthSecret("basic-auth", "admin")); err == nil {
+		t.Errorf("UpdateSecret() should fail for illegal users")
+	}
+	if err := c.UpdateSecret(secret); err != nil || len(c.users["default/basic-auth"]) == 0 {
+		t.Errorf("UpdateSecret() should restore users, error: %v", err)
+	}
+
+	deleteTestIngress(s, &c.moduleRule, "ingress1")
+	if len(*(*c.conf.file.(*mod_auth_basic.AuthBasicConfFile).Config)[DefaultProduct]) != 0 || len(c.users) != 0 {
+		t.Errorf("auth basic rules and users should be deleted with ingress")
+	}
+}
+
+func Test_parseUsers(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "htpasswd",
+			data: "user1:$apr1$mI7SilJz$CWwYJyYKbhVDNl26sdUSh/\r\n\n# comment\nuser2:{SHA}fEqNCco3Yq9h5ZUglD3CZJT4lBs=",
+			want: "user1:$apr1$mI7SilJz$CWwYJyYKbhVDNl26sdUSh/\nuser2:{SHA}fEqNCco3Yq9h5ZUglD3CZJT4lBs=\n",
+		},
+		{
+			name: "comment field",
+			data: "user1:{SHA}fEqNCco3Yq9h5ZUglD3CZJT4lBs=:admin of foo.com",
+			want: "user1:{SHA}fEqNCco3Yq9h5ZUglD3CZJT4lBs=:admin of foo.com\n",
+		},
+		{
+			name:    "too many fields",
+			data:    "user1:{SHA}fEqNCco3Yq9h5ZUglD3CZJT4lBs=:admin:foo.com",
+			wantErr: true,
+		},
+		{
+			name:    "empty",
+			data:    "# comment\n",
+			wantErr: true,
+		},
+		{
+			name:    "no password",
+			data:    "user1",
+			wantErr: true,
+		},
+		{
+			name:    "comment in line",
+			data:    "user1:{SHA}fEqNCco3Yq9h5ZUglD3CZJT4lBs= # comment",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseUsers([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseUsers() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if string(got) != tt.want {
+				t.Errorf("parseUsers() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
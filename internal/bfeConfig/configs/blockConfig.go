@@ -0,0 +1,128 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package configs
+
+import (
+	"fmt"
+
+	"github.com/bfenetworks/bfe/bfe_modules/mod_block"
+	netv1 "k8s.io/api/networking/v1"
+
+	"github.com/bfenetworks/ingress-bfe/internal/bfeConfig/annotations"
+	"github.com/bfenetworks/ingress-bfe/internal/bfeConfig/util"
+)
+
+const (
+	ConfigNameBlock = "mod_block.product_rule_table"
+
+	BlockActionClose = "CLOSE"
+)
+
+var (
+	BlockData = "mod_block/block_rules.data"
+)
+
+// BlockRuleFile is the same as block rule of mod_block, which is not exported
+type BlockRuleFile struct {
+	Cond   *string               // condition for block
+	Name   *string               // block rule name
+	Action *mod_block.ActionFile // action for block
+}
+
+type BlockRuleFileList []BlockRuleFile
+
+type BlockProductRulesFile map[string]*BlockRuleFileList
+
+type BlockConfFile struct {
+	Version *string
+	Config  *BlockProductRulesFile
+}
+
+type BlockConfig struct {
+	moduleRule
+
+	// ingress -> condition of clients to be blocked
+	blocks map[string]string
+}
+
+func NewBlockConfig(version string) *BlockConfig {
+	c := &BlockConfig{
+		blocks: make(map[string]string),
+	}
+	c.moduleRule = newModuleRule(ConfigNameBlock, BlockData, version, c)
+	return c
+}
+
+func newBlockConfFile(version string) *BlockConfFile {
+	productRules := make(BlockProductRulesFile)
+	productRules[DefaultProduct] = &BlockRuleFileList{}
+
+	return &BlockConfFile{
+		Version: &version,
+		Config:  &productRules,
+	}
+}
+
+// UpdateIngress updates block rules of ingress, routes should contain rules of the ingress
+func (c *BlockConfig) UpdateIngress(ingress *netv1.Ingress, routes *RouteRuleCache) error {
+	ingressName := util.NamespacedName(ingress.Namespace, ingress.Name)
+
+	block, err := annotations.GetBlockCondition(ingress.Annotations)
+	if err != nil {
+		return err
+	}
+
+	return c.updateIngress(ingressName, func() {
+		if len(block) > 0 {
+			c.blocks[ingressName] = block
+		}
+	}, routes)
+}
+
+func (c *BlockConfig) hasRule(rule *httpRule) bool {
+	_, ok := c.blocks[rule.ingress]
+	return ok
+}
+
+func (c *BlockConfig) removeIngress(ingress string) {
+	delete(c.blocks, ingress)
+}
+
+func (c *BlockConfig) buildConf(version string, rules []ingressRule) (moduleConf, error) {
+	blockConfFile := newBlockConfFile(version)
+	ruleList := (*blockConfFile.Config)[DefaultProduct]
+	for _, rule := range rules {
+		condition := fmt.Sprintf("%s&&(%s)", rule.condition, c.blocks[rule.ingress])
+		if err := checkCondition(condition); err != nil {
+			return moduleConf{}, err
+		}
+
+		// rule name should be unique in product
+		name := fmt.Sprintf("%s#%d", rule.ingress, len(*ruleList))
+		cmd := BlockActionClose
+		*ruleList = append(*ruleList, BlockRuleFile{
+			Cond:   &condition,
+			Name:   &name,
+			Action: &mod_block.ActionFile{Cmd: &cmd, Params: []string{}},
+		})
+	}
+
+	for _, rule := range *ruleList {
+		if err := mod_block.ActionFileCheck(rule.Action); err != nil {
+			return moduleConf{}, fmt.Errorf("fail to check generated block conf, err: %s", err)
+		}
+	}
+
+	return moduleConf{file: blockConfFile, version: blockConfFile.Version, rules: blockConfFile.Config}, nil
+}
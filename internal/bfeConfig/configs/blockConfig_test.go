@@ -0,0 +1,69 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configs
+
+import (
+	"testing"
+	"time"
+
+	netv1 "k8s.io/api/networking/v1"
+
+	"github.com/bfenetworks/ingress-bfe/internal/bfeConfig/annotations"
+)
+
+func TestBlockConfig_UpdateIngress(t *testing.T) {
+	setTestOptions(t)
+
+	s := NewServerDataConfig("init")
+	c := NewBlockConfig("init")
+
+	ingress1 := newTestIngress("ingress1", time.Now(), map[string]string{
+		annotations.WhitelistSourceRangeAnnotation: "10.0.0.0/8",
+	}, "foo.com", "/admin")
+	ingress2 := newTestIngress("ingress2", time.Now(), map[string]string{
+		annotations.DenylistSourceRangeAnnotation: "192.168.1.1/32",
+	}, "foo.com", "/")
+	for _, ingress := range []*netv1.Ingress{ingress1, ingress2} {
+		if err := updateTestIngress(t, s, c, ingress); err != nil {
+			t.Fatalf("UpdateIngress() error: %s", err)
+		}
+	}
+
+	rules := *(*c.conf.file.(*BlockConfFile).Config)[DefaultProduct]
+	if len(rules) != 2 {
+		t.Fatalf("block rules = %d, want 2", len(rules))
+	}
+	want := map[string]string{
+		"default/ingress1#0": `req_host_in("foo.com")&&req_path_element_prefix_in("/admin", false)&&(!req_cip_range("10.0.0.0", "10.255.255.255"))`,
+		"default/ingress2#1": `req_host_in("foo.com")&&req_path_element_prefix_in("/", false)&&!(req_host_in("foo.com")&&req_path_element_prefix_in("/admin", false))&&(req_cip_range("192.168.1.1", "192.168.1.1"))`,
+	}
+	for _, rule := range rules {
+		if *rule.Cond != want[*rule.Name] || *rule.Action.Cmd != BlockActionClose {
+			t.Errorf("block rule %s = %s, want %s", *rule.Name, *rule.Cond, want[*rule.Name])
+		}
+	}
+
+	// illegal annotation
+	ingress1.Annotations[annotations.WhitelistSourceRangeAnnotation] = "10.0.0.1"
+	if err := c.UpdateIngress(ingress1, s.RouteRules()); err == nil {
+		t.Errorf("UpdateIngress() should fail for illegal annotation")
+	}
+
+	deleteTestIngress(s, &c.moduleRule, "ingress1")
+	deleteTestIngress(s, &c.moduleRule, "ingress2")
+	if rules := *(*c.conf.file.(*BlockConfFile).Config)[DefaultProduct]; len(rules) != 0 {
+		t.Errorf("block rules = %d, want 0", len(rules))
+	}
+}
@@ -15,8 +15,13 @@ package configs
 
 import (
 	"fmt"
+	"net"
+	"reflect"
+	"strconv"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	netv1 "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -51,6 +56,15 @@ type ClusterConfig struct {
 	ingress2Cluster *setmultimap.MultiMap
 	service2Cluster *setmultimap.MultiMap
 
+	// cluster -> service -> weight, weights of sub-clusters are derived from it
+	clusterWeights map[string]gslb_conf.GslbClusterConf
+
+	// service -> address of terminating endpoint -> time when draining starts
+	draining map[string]map[string]time.Time
+
+	// cluster -> primary and canary clusters merged into it, see UpdateCanary
+	canaries map[string]canaryBackend
+
 	gslbConf         gslb_conf.GslbConf
 	clusterTableConf cluster_table_conf.ClusterTableConf
 }
@@ -64,6 +78,8 @@ func NewClusterConfig(version string) *ClusterConfig {
 	return &ClusterConfig{
 		ingress2Cluster: setmultimap.New(),
 		service2Cluster: setmultimap.New(),
+		clusterWeights:  make(map[string]gslb_conf.GslbClusterConf),
+		draining:        make(map[string]map[string]time.Time),
 		gslbConf: gslb_conf.GslbConf{
 			Clusters: &gslbCluster,
 			Hostname: &hostname,
@@ -83,28 +99,45 @@ func (c *ClusterConfig) setVersion() {
 	c.clusterTableConf.Version = &version
 }
 
-func (c *ClusterConfig) UpdateIngress(ingress *netv1.Ingress, services map[string]*corev1.Service, endpoints map[string]*corev1.Endpoints) error {
-	if len(ingress.Spec.Rules) == 0 {
+func (c *ClusterConfig) UpdateIngress(ingress *netv1.Ingress, services map[string]*corev1.Service, endpoints map[string][]*discoveryv1.EndpointSlice, weights map[string]int) error {
+	return c.update(newIngressSource(ingress), nil, services, endpoints, weights)
+}
+
+// UpdateRoute updates clusters of route rules, each rule of route is updated like an ingress named by RuleName.
+// Clusters updated are not removed on error, route should be deleted as a whole.
+func (c *ClusterConfig) UpdateRoute(route *Route, services map[string]*corev1.Service, endpoints map[string][]*discoveryv1.EndpointSlice, weights map[string]int) error {
+	unresolved := route.unresolvedBackends()
+	for i := range route.Rules {
+		if err := c.update(route.ruleSource(i), unresolved, services, endpoints, weights); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *ClusterConfig) update(src *ruleSource, unresolved map[string]bool, services map[string]*corev1.Service, endpoints map[string][]*discoveryv1.EndpointSlice, weights map[string]int) error {
+	if len(src.rules) == 0 {
 		return nil
 	}
 
-	balance, _ := annotations.GetBalance(ingress.Annotations)
+	balance, _ := annotations.GetBalance(src.annotations)
 
-	ingressName := util.NamespacedName(ingress.Namespace, ingress.Name)
-	for _, rule := range ingress.Spec.Rules {
+	ingressName := util.NamespacedName(src.namespace, src.name)
+	for _, rule := range src.rules {
 		for _, path := range rule.HTTP.Paths {
 			// create cluster && subcluster for each Service
 			clusterName := util.ClusterName(ingressName, path.Backend.Service)
 
 			// cluster config
-			(*c.clusterTableConf.Config)[clusterName] = c.newClusterBackend(ingress.Namespace, path.Backend.Service, balance, services, endpoints)
+			(*c.clusterTableConf.Config)[clusterName] = c.newClusterBackend(src.namespace, path.Backend.Service, balance, unresolved, services, endpoints, weights)
 
 			// gslb config
-			(*c.gslbConf.Clusters)[clusterName] = c.newGslbClusterConf(ingress.Namespace, path.Backend.Service.Name, balance)
+			c.clusterWeights[clusterName] = c.newGslbClusterConf(src.namespace, path.Backend.Service.Name, balance)
+			c.updateGslb(clusterName)
 
 			// put into map
 			c.ingress2Cluster.Put(ingressName, clusterName)
-			for service := range (*c.gslbConf.Clusters)[clusterName] {
+			for service := range c.clusterWeights[clusterName] {
 				c.service2Cluster.Put(service, clusterName)
 			}
 		}
@@ -115,7 +148,7 @@ func (c *ClusterConfig) UpdateIngress(ingress *netv1.Ingress, services map[strin
 	}
 
 	if err := cluster_table_conf.ClusterTableConfCheck(c.clusterTableConf); err != nil {
-		c.DeleteIngress(ingress.Namespace, ingress.Name)
+		c.DeleteIngress(src.namespace, src.name)
 		return err
 	}
 
@@ -123,8 +156,8 @@ func (c *ClusterConfig) UpdateIngress(ingress *netv1.Ingress, services map[strin
 	return nil
 }
 
-func (c *ClusterConfig) addDefautBackend(ep *corev1.Endpoints) {
-	if ep == nil {
+func (c *ClusterConfig) addDefautBackend(slices []*discoveryv1.EndpointSlice) {
+	if slices == nil {
 		return
 	}
 
@@ -133,20 +166,22 @@ func (c *ClusterConfig) addDefautBackend(ep *corev1.Endpoints) {
 		return
 	}
 
-	instanceList := c.newSubClusterBackend(ep, intstr.IntOrString{})
+	serviceName := option.Opts.Ingress.DefaultBackend
+
+	// default backend is not split by zone
+	instanceList := c.newSubClusterBackends(serviceName, slices, intstr.IntOrString{}, nil)[""]
 	if len(instanceList) == 0 {
 		return
 	}
 
-	serviceName := option.Opts.Ingress.DefaultBackend
-
 	subCluster := make(cluster_table_conf.ClusterBackend)
 	subCluster[serviceName] = instanceList
 	(*c.clusterTableConf.Config)[util.DefaultClusterName()] = subCluster
 
 	gslbConf := make(gslb_conf.GslbClusterConf)
 	gslbConf[serviceName] = defaultWeight
-	(*c.gslbConf.Clusters)[util.DefaultClusterName()] = gslbConf
+	c.clusterWeights[util.DefaultClusterName()] = gslbConf
+	c.updateGslb(util.DefaultClusterName())
 
 	c.service2Cluster.Put(serviceName, util.DefaultClusterName())
 }
@@ -161,12 +196,13 @@ func (c *ClusterConfig) DeleteIngress(namespace, name string) {
 	for _, cluster := range clusters {
 		clusterName := cluster.(string)
 
-		for serviceName := range (*c.clusterTableConf.Config)[clusterName] {
+		for serviceName := range c.clusterWeights[clusterName] {
 			c.service2Cluster.Remove(serviceName, clusterName)
 		}
 
 		delete(*c.clusterTableConf.Config, clusterName)
 		delete(*c.gslbConf.Clusters, clusterName)
+		delete(c.clusterWeights, clusterName)
 	}
 	c.ingress2Cluster.RemoveAll(ingressName)
 
@@ -182,10 +218,12 @@ func (c *ClusterConfig) delDefautBackend() {
 	c.service2Cluster.Remove(option.Opts.Ingress.DefaultBackend, util.DefaultClusterName())
 	delete(*c.clusterTableConf.Config, util.DefaultClusterName())
 	delete(*c.gslbConf.Clusters, util.DefaultClusterName())
+	delete(c.clusterWeights, util.DefaultClusterName())
 }
 
-// newClusterBackend makes cluster_table_conf.ClusterBackend configuration
-func (c *ClusterConfig) newClusterBackend(namespace string, backend *netv1.IngressServiceBackend, balance annotations.Balance, services map[string]*corev1.Service, endpoints map[string]*corev1.Endpoints) cluster_table_conf.ClusterBackend {
+// newClusterBackend makes cluster_table_conf.ClusterBackend configuration.
+// Unresolved services of route have no subcluster, and requests to them are responded with 500.
+func (c *ClusterConfig) newClusterBackend(namespace string, backend *netv1.IngressServiceBackend, balance annotations.Balance, unresolved map[string]bool, services map[string]*corev1.Service, endpoints map[string][]*discoveryv1.EndpointSlice, weights map[string]int) cluster_table_conf.ClusterBackend {
 
 	subClusters := make(cluster_table_conf.ClusterBackend)
 
@@ -195,49 +233,266 @@ func (c *ClusterConfig) newClusterBackend(namespace string, backend *netv1.Ingre
 	// check whether service exist in balance annotation
 	weights, ok := balance[backend.Name]
 	if !ok {
+		if unresolved[backend.Name] {
+			return subClusters
+		}
 		serviceName := util.NamespacedName(namespace, backend.Name)
 		port := getTargetPort(backend.Port, services[serviceName])
-		subClusters[serviceName] = c.newSubClusterBackend(endpoints[serviceName], port)
+		for zone, instanceList := range c.newSubClusterBackends(serviceName, endpoints[serviceName], port, weights) {
+			subClusters[util.SubClusterName(serviceName, zone)] = instanceList
+		}
 		return subClusters
 	}
 
 	for name := range weights {
+		if unresolved[name] {
+			continue
+		}
 		serviceName := util.NamespacedName(namespace, name)
 		port := getTargetPort(backend.Port, services[serviceName])
-		subClusters[serviceName] = c.newSubClusterBackend(endpoints[serviceName], port)
+		for zone, instanceList := range c.newSubClusterBackends(serviceName, endpoints[serviceName], port, weights) {
+			subClusters[util.SubClusterName(serviceName, zone)] = instanceList
+		}
 	}
 
 	return subClusters
 }
 
-// newSubClusterBackend converts k8s service to bfe subCluster/instanceList
-func (c *ClusterConfig) newSubClusterBackend(ep *corev1.Endpoints, port intstr.IntOrString) cluster_table_conf.SubClusterBackend {
-	if ep == nil {
-		return nil
+// newSubClusterBackends converts endpoint slices of k8s service to bfe subCluster/instanceList, keyed by zone.
+// Endpoints are split by zone if zone aware routing is enabled, otherwise they are all in zone "".
+// Weights of endpoints are got from weights by address, defaultWeight if not found, and endpoints of weight 0 are skipped.
+// Terminating endpoints are drained with weight 0, and not ready endpoints are used only if
+// no endpoint is ready and option NotReadyFallback is enabled.
+func (c *ClusterConfig) newSubClusterBackends(service string, slices []*discoveryv1.EndpointSlice, port intstr.IntOrString, weights map[string]int) map[string]cluster_table_conf.SubClusterBackend {
+	if slices == nil {
+		return map[string]cluster_table_conf.SubClusterBackend{"": nil}
 	}
-	instanceList := make([]*cluster_table_conf.BackendConf, 0)
+	slices = addressSlices(slices)
+	draining := c.updateDraining(service, slices, time.Now())
 
-	// if no port is specified, use the first port in endpoints
+	// if no port is specified, use the first ready endpoint and the first port in endpoint slices
 	if port.IntVal == 0 && len(port.StrVal) == 0 {
-		if len(ep.Subsets) > 0 && len(ep.Subsets[0].Ports) > 0 && len(ep.Subsets[0].Addresses) > 0 {
-			instanceList = append(instanceList, newBackendConf(ep.Subsets[0].Addresses[0].IP, int(ep.Subsets[0].Ports[0].Port), defaultWeight))
+		instanceList := make(cluster_table_conf.SubClusterBackend, 0)
+		for _, slice := range slices {
+			if len(slice.Ports) == 0 || slice.Ports[0].Port == nil {
+				continue
+			}
+			for _, ep := range slice.Endpoints {
+				if endpointReady(ep) {
+					instanceList = append(instanceList, newBackendConf(ep.Addresses[0], int(*slice.Ports[0].Port), defaultWeight))
+					return map[string]cluster_table_conf.SubClusterBackend{"": instanceList}
+				}
+			}
 		}
-		return instanceList
+		return map[string]cluster_table_conf.SubClusterBackend{"": instanceList}
 	}
 
-	// find endpoint in subset by port
-	for _, subset := range ep.Subsets {
-		for _, endpointPort := range subset.Ports {
-			if port.IntVal == endpointPort.Port || port.StrVal == endpointPort.Name {
-				// add to subCluster
-				for _, addr := range subset.Addresses {
-					instanceList = append(instanceList, newBackendConf(addr.IP, int(endpointPort.Port), defaultWeight))
+	// find endpoints in slices by port, endpoint may exist in multiple slices
+	zonesOf := endpointZones(slices)
+	readyList := make(map[string]cluster_table_conf.SubClusterBackend)
+	notReadyList := make(map[string]cluster_table_conf.SubClusterBackend)
+	drainingList := make(map[string]cluster_table_conf.SubClusterBackend)
+	found := make(map[string]bool)
+	for _, slice := range slices {
+		for _, endpointPort := range slice.Ports {
+			if !matchPort(port, endpointPort) {
+				continue
+			}
+
+			// add to subCluster
+			for _, ep := range slice.Endpoints {
+				if len(ep.Addresses) == 0 {
+					continue
+				}
+				key := net.JoinHostPort(ep.Addresses[0], strconv.Itoa(int(*endpointPort.Port)))
+				if found[key] {
+					continue
+				}
+				found[key] = true
+
+				weight, ok := weights[ep.Addresses[0]]
+				if !ok {
+					weight = defaultWeight
+				}
+				list := notReadyList
+				switch {
+				case endpointReady(ep):
+					list = readyList
+				case endpointTerminating(ep):
+					if _, ok := draining[ep.Addresses[0]]; !ok {
+						continue
+					}
+					list, weight = drainingList, 0
+				}
+				if weight == 0 && !endpointTerminating(ep) {
+					continue
+				}
+				for _, zone := range zonesOf(ep) {
+					list[zone] = append(list[zone], newBackendConf(ep.Addresses[0], int(*endpointPort.Port), weight))
 				}
 			}
 		}
 	}
 
-	return instanceList
+	if len(readyList) == 0 && option.Opts.Ingress.NotReadyFallback {
+		readyList = notReadyList
+	}
+	// sub cluster should have at least one backend with weight > 0, zones without such backend are dropped
+	if len(readyList) == 0 {
+		return map[string]cluster_table_conf.SubClusterBackend{"": {}}
+	}
+	for zone := range readyList {
+		readyList[zone] = append(readyList[zone], drainingList[zone]...)
+	}
+	return readyList
+}
+
+// endpointZones returns function to get zones of endpoint, by which endpoints are split into sub-clusters.
+// Topology hints are used if all ready endpoints have hints, otherwise zone of endpoint is used.
+func endpointZones(slices []*discoveryv1.EndpointSlice) func(ep discoveryv1.Endpoint) []string {
+	if !option.Opts.Ingress.ZoneAwareRouting {
+		return func(discoveryv1.Endpoint) []string {
+			return []string{""}
+		}
+	}
+
+	useHints := true
+	for _, slice := range slices {
+		for _, ep := range slice.Endpoints {
+			if endpointReady(ep) && (ep.Hints == nil || len(ep.Hints.ForZones) == 0) {
+				useHints = false
+			}
+		}
+	}
+
+	return func(ep discoveryv1.Endpoint) []string {
+		if useHints && ep.Hints != nil && len(ep.Hints.ForZones) > 0 {
+			zones := make([]string, 0, len(ep.Hints.ForZones))
+			for _, zone := range ep.Hints.ForZones {
+				zones = append(zones, zone.Name)
+			}
+			return zones
+		}
+		if ep.Zone != nil {
+			return []string{*ep.Zone}
+		}
+		return []string{""}
+	}
+}
+
+// updateDraining updates terminating endpoints of service, and returns those still in draining
+func (c *ClusterConfig) updateDraining(service string, slices []*discoveryv1.EndpointSlice, now time.Time) map[string]time.Time {
+	if option.Opts.Ingress.DrainTimeout <= 0 {
+		return nil
+	}
+
+	draining := make(map[string]time.Time)
+	for _, slice := range slices {
+		for _, ep := range slice.Endpoints {
+			if len(ep.Addresses) == 0 || !endpointTerminating(ep) {
+				continue
+			}
+			addr := ep.Addresses[0]
+			if start, ok := c.draining[service][addr]; ok {
+				draining[addr] = start
+			} else {
+				draining[addr] = now
+			}
+		}
+	}
+	if len(draining) == 0 {
+		delete(c.draining, service)
+		return nil
+	}
+	c.draining[service] = draining
+
+	result := make(map[string]time.Time)
+	for addr, start := range draining {
+		if now.Sub(start) < option.Opts.Ingress.DrainTimeout {
+			result[addr] = start
+		}
+	}
+	return result
+}
+
+// expireDraining removes backends which have been drained for DrainTimeout
+func (c *ClusterConfig) expireDraining(now time.Time) {
+	if len(c.draining) == 0 {
+		return
+	}
+
+	expired := false
+	for _, clusterBackend := range *c.clusterTableConf.Config {
+		for subCluster, backends := range clusterBackend {
+			instanceList := make(cluster_table_conf.SubClusterBackend, 0, len(backends))
+			for _, backend := range backends {
+				start, ok := c.draining[util.SubClusterService(subCluster)][*backend.Addr]
+				if ok && *backend.Weight == 0 && now.Sub(start) >= option.Opts.Ingress.DrainTimeout {
+					continue
+				}
+				instanceList = append(instanceList, backend)
+			}
+			if len(instanceList) < len(backends) {
+				clusterBackend[subCluster] = instanceList
+				expired = true
+			}
+		}
+	}
+
+	if expired {
+		c.setVersion()
+	}
+}
+
+// addressSlices returns slices of one address type, IPv4 is preferred for dual-stack service.
+// FQDN is not supported by bfe.
+func addressSlices(slices []*discoveryv1.EndpointSlice) []*discoveryv1.EndpointSlice {
+	addressType := discoveryv1.AddressTypeIPv6
+	for _, slice := range slices {
+		if slice.AddressType == discoveryv1.AddressTypeIPv4 {
+			addressType = discoveryv1.AddressTypeIPv4
+			break
+		}
+	}
+
+	var result []*discoveryv1.EndpointSlice
+	for _, slice := range slices {
+		if slice.AddressType == addressType {
+			result = append(result, slice)
+		}
+	}
+	return result
+}
+
+// matchPort checks whether endpoint port is the target port, which is from getTargetPort
+func matchPort(port intstr.IntOrString, endpointPort discoveryv1.EndpointPort) bool {
+	if endpointPort.Port == nil {
+		return false
+	}
+	if port.Type == intstr.Int {
+		return port.IntVal == *endpointPort.Port
+	}
+	return endpointPort.Name != nil && port.StrVal == *endpointPort.Name
+}
+
+// endpointTerminating checks whether endpoint is terminating, unknown state is interpreted as not terminating
+func endpointTerminating(ep discoveryv1.Endpoint) bool {
+	return ep.Conditions.Terminating != nil && *ep.Conditions.Terminating
+}
+
+// endpointReady checks whether endpoint is ready to receive traffic.
+// Unknown state of ready is interpreted as ready, and terminating endpoint is not ready.
+func endpointReady(ep discoveryv1.Endpoint) bool {
+	if len(ep.Addresses) == 0 {
+		return false
+	}
+	if endpointTerminating(ep) {
+		return false
+	}
+	if ep.Conditions.Ready != nil {
+		return *ep.Conditions.Ready
+	}
+	return ep.Conditions.Serving == nil || *ep.Conditions.Serving
 }
 
 // getTargetPort returns real targetport of backend pod
@@ -296,7 +551,7 @@ func (c *ClusterConfig) newGslbClusterConf(namespace, service string, balance an
 	return gslbConf
 }
 
-func (c *ClusterConfig) UpdateService(service *corev1.Service, endpoint *corev1.Endpoints) error {
+func (c *ClusterConfig) UpdateService(service *corev1.Service, slices []*discoveryv1.EndpointSlice, weights map[string]int) error {
 	serviceName := util.NamespacedName(service.Namespace, service.Name)
 
 	// find cluster by service, do nothing if not found
@@ -316,8 +571,8 @@ func (c *ClusterConfig) UpdateService(service *corev1.Service, endpoint *corev1.
 			log.V(0).Info("ingress backend port not found in service", "namespace", service.Namespace, "name", service.Name, "port", util.ParsePort(name))
 			return fmt.Errorf("cluster [%s] error, port can not found in service", name)
 		} else {
-			(*c.clusterTableConf.Config)[name][serviceName] = c.newSubClusterBackend(endpoint, targetPort)
-			(*c.gslbConf.Clusters)[name] = c.newGslbClusterConf(service.Namespace, service.Name, nil)
+			c.setSubClusters(name, serviceName, c.newSubClusterBackends(serviceName, slices, targetPort, weights))
+			c.updateGslb(name)
 		}
 	}
 
@@ -330,27 +585,197 @@ func (c *ClusterConfig) DeleteService(namespace, name string) {
 
 	// find cluster by service
 	clusters, _ := c.service2Cluster.Get(serviceName)
+	delete(c.draining, serviceName)
 
 	for _, cluster := range clusters {
 		name := cluster.(string)
 
-		// delete subcluster
-		delete((*c.clusterTableConf.Config)[name], serviceName)
+		// delete subclusters, and cluster of gslb if no subcluster left
+		c.deleteSubClusters(name, serviceName)
+		c.updateGslb(name)
+	}
+
+	c.setVersion()
+}
+
+// setSubClusters replaces subclusters of service in cluster, subClusters is keyed by zone
+func (c *ClusterConfig) setSubClusters(cluster, service string, subClusters map[string]cluster_table_conf.SubClusterBackend) {
+	c.deleteSubClusters(cluster, service)
+
+	clusterBackend, ok := (*c.clusterTableConf.Config)[cluster]
+	if !ok {
+		clusterBackend = make(cluster_table_conf.ClusterBackend)
+		(*c.clusterTableConf.Config)[cluster] = clusterBackend
+	}
+	for zone, instanceList := range subClusters {
+		clusterBackend[util.SubClusterName(service, zone)] = instanceList
+	}
+}
 
-		// delete subcluter and cluster, total weigth of cluster should > 0
-		delete((*c.gslbConf.Clusters)[name], serviceName)
-		if len((*c.gslbConf.Clusters)[name]) == 0 {
-			delete(*c.gslbConf.Clusters, name)
+// deleteSubClusters deletes subclusters of service in cluster
+func (c *ClusterConfig) deleteSubClusters(cluster, service string) {
+	clusterBackend := (*c.clusterTableConf.Config)[cluster]
+	for subCluster := range clusterBackend {
+		if util.SubClusterService(subCluster) == service {
+			delete(clusterBackend, subCluster)
 		}
 	}
+}
 
-	c.setVersion()
+// updateGslb sets weights of subclusters in cluster by weights of services.
+// The cluster is removed from gslb if it has no subcluster, as total weight of cluster should > 0.
+func (c *ClusterConfig) updateGslb(cluster string) {
+	// service -> subcluster -> total weight of backends
+	subClusters := make(map[string]map[string]int)
+	for subCluster, backends := range (*c.clusterTableConf.Config)[cluster] {
+		service := util.SubClusterService(subCluster)
+		if subClusters[service] == nil {
+			subClusters[service] = make(map[string]int)
+		}
+		subClusters[service][subCluster] = 0
+		for _, backend := range backends {
+			subClusters[service][subCluster] += *backend.Weight
+		}
+	}
+
+	gslbConf := make(gslb_conf.GslbClusterConf)
+	for service, weight := range c.clusterWeights[cluster] {
+		for subCluster, w := range zoneWeights(service, weight, subClusters[service]) {
+			gslbConf[subCluster] = w
+		}
+	}
+
+	if len(gslbConf) == 0 {
+		delete(*c.gslbConf.Clusters, cluster)
+		return
+	}
+	(*c.gslbConf.Clusters)[cluster] = gslbConf
+}
+
+// zoneWeights splits weight of service among its subclusters.
+// Subcluster in zone of the controller gets the whole weight, and subclusters in other zones
+// get weight 0, which are only used by cross retry. If service has no subcluster in zone of
+// the controller, weight is split by total weight of backends in each subcluster.
+func zoneWeights(service string, weight int, subClusters map[string]int) map[string]int {
+	weights := make(map[string]int)
+
+	zone := option.Opts.Ingress.Zone
+	if _, ok := subClusters[util.SubClusterName(service, zone)]; ok && len(zone) > 0 {
+		for subCluster := range subClusters {
+			weights[subCluster] = 0
+		}
+		weights[util.SubClusterName(service, zone)] = weight
+		return weights
+	}
+
+	total := 0
+	for _, n := range subClusters {
+		total += n
+	}
+	for subCluster, n := range subClusters {
+		if len(subClusters) == 1 || total == 0 || weight <= 0 {
+			weights[subCluster] = weight
+			continue
+		}
+		// weight of subcluster with available backends should > 0
+		weights[subCluster] = weight * n / total
+		if weights[subCluster] == 0 && n > 0 {
+			weights[subCluster] = 1
+		}
+	}
+	return weights
+}
+
+// UpdateCanary updates clusters merged from primary and canary clusters by canary weight, which are used by routes
+func (c *ClusterConfig) UpdateCanary(routes *RouteRuleCache) {
+	canaries := make(map[string]canaryBackend)
+	for _, rule := range routes.GetAllHttpRules() {
+		if rule.canary != nil {
+			canaries[rule.cluster] = *rule.canary
+		}
+	}
+
+	if !reflect.DeepEqual(canaries, c.canaries) {
+		c.canaries = canaries
+		c.setVersion()
+	}
+}
+
+// canaryConf returns gslb conf and cluster table conf with canary clusters.
+// Canary cluster contains subclusters of primary and canary clusters, whose weights are scaled by canary weight.
+func (c *ClusterConfig) canaryConf() (gslb_conf.GslbConf, cluster_table_conf.ClusterTableConf) {
+	if len(c.canaries) == 0 {
+		return c.gslbConf, c.clusterTableConf
+	}
+
+	gslbClusters := make(gslb_conf.GslbClustersConf)
+	for name, conf := range *c.gslbConf.Clusters {
+		gslbClusters[name] = conf
+	}
+	clusterBackends := make(cluster_table_conf.AllClusterBackend)
+	for name, backend := range *c.clusterTableConf.Config {
+		clusterBackends[name] = backend
+	}
+
+	for cluster, canary := range c.canaries {
+		primaryGslb, ok := gslbClusters[canary.primary]
+		if !ok {
+			continue
+		}
+		canaryGslb := gslbClusters[canary.canary]
+		primaryTotal, canaryTotal := totalWeight(primaryGslb), totalWeight(canaryGslb)
+
+		gslbConf := make(gslb_conf.GslbClusterConf)
+		clusterBackend := make(cluster_table_conf.ClusterBackend)
+		for subCluster, weight := range primaryGslb {
+			// all requests are routed to primary if canary is not available
+			if canaryTotal > 0 {
+				weight = weight * canaryTotal * (100 - canary.weight)
+			}
+			gslbConf[subCluster] = weight
+			clusterBackend[subCluster] = clusterBackends[canary.primary][subCluster]
+		}
+		for subCluster, weight := range canaryGslb {
+			if canaryTotal == 0 {
+				break
+			}
+			gslbConf[canarySubClusterName(subCluster)] = weight * primaryTotal * canary.weight
+			clusterBackend[canarySubClusterName(subCluster)] = clusterBackends[canary.canary][subCluster]
+		}
+
+		gslbClusters[cluster] = gslbConf
+		clusterBackends[cluster] = clusterBackend
+	}
+
+	gslbConf := c.gslbConf
+	gslbConf.Clusters = &gslbClusters
+	clusterTableConf := c.clusterTableConf
+	clusterTableConf.Config = &clusterBackends
+	return gslbConf, clusterTableConf
+}
+
+// canarySubClusterName returns name of subcluster of canary cluster in merged cluster
+func canarySubClusterName(subCluster string) string {
+	return "canary/" + subCluster
+}
+
+func totalWeight(conf gslb_conf.GslbClusterConf) int {
+	total := 0
+	for _, weight := range conf {
+		if weight > 0 {
+			total += weight
+		}
+	}
+	return total
 }
 
 func (c *ClusterConfig) Reload() error {
+	c.expireDraining(time.Now())
+	gslbConf, clusterTableConf := c.canaryConf()
+
 	reload := false
 	if *c.gslbConf.Ts != c.gslbVersion {
-		err := util.DumpBfeConf(GslbData, c.gslbConf)
+		err := util.DumpBfeConf(GslbData, gslbConf)
 		if err != nil {
 			return fmt.Errorf("dump gslb.data error: %v", err)
 		}
@@ -358,7 +783,7 @@ func (c *ClusterConfig) Reload() error {
 		reload = true
 	}
 	if *c.clusterTableConf.Version != c.clusterTableVersion {
-		err := util.DumpBfeConf(ClusterTableData, c.clusterTableConf)
+		err := util.DumpBfeConf(ClusterTableData, clusterTableConf)
 		if err != nil {
 			return fmt.Errorf("dump cluster_table.data error: %v", err)
 		}
@@ -0,0 +1,308 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package configs
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bfenetworks/bfe/bfe_config/bfe_cluster_conf/cluster_table_conf"
+	"github.com/bfenetworks/bfe/bfe_config/bfe_cluster_conf/gslb_conf"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"github.com/bfenetworks/ingress-bfe/internal/bfeConfig/util"
+	"github.com/bfenetworks/ingress-bfe/internal/option"
+)
+
+func newTestEndpoint(ip string, ready, serving, terminating *bool) discoveryv1.Endpoint {
+	return discoveryv1.Endpoint{
+		Addresses: []string{ip},
+		Conditions: discoveryv1.EndpointConditions{
+			Ready:       ready,
+			Serving:     serving,
+			Terminating: terminating,
+		},
+	}
+}
+
+func newTestSlice(addressType discoveryv1.AddressType, portName string, port int32, endpoints ...discoveryv1.Endpoint) *discoveryv1.EndpointSlice {
+	return &discoveryv1.EndpointSlice{
+		AddressType: addressType,
+		Ports:       []discoveryv1.EndpointPort{{Name: &portName, Port: &port}},
+		Endpoints:   endpoints,
+	}
+}
+
+func backendAddrs(instances []*cluster_table_conf.BackendConf) []string {
+	var addrs []string
+	for _, instance := range instances {
+		addrs = append(addrs, fmt.Sprintf("%s:%d", *instance.Addr, *instance.Port))
+	}
+	return addrs
+}
+
+func TestClusterConfig_newSubClusterBackends(t *testing.T) {
+	setTestOptions(t)
+
+	yes, no := true, false
+	slices := []*discoveryv1.EndpointSlice{
+		newTestSlice(discoveryv1.AddressTypeIPv4, "http", 8080,
+			newTestEndpoint("10.0.0.1", &yes, nil, nil),
+			newTestEndpoint("10.0.0.2", nil, nil, nil),
+			newTestEndpoint("10.0.0.3", &no, nil, nil),
+			newTestEndpoint("10.0.0.4", &no, &yes, &yes)),
+		newTestSlice(discoveryv1.AddressTypeIPv4, "http", 8080,
+			newTestEndpoint("10.0.0.1", &yes, nil, nil),
+			newTestEndpoint("10.0.0.5", &yes, nil, nil)),
+		newTestSlice(discoveryv1.AddressTypeIPv4, "metrics", 9090,
+			newTestEndpoint("10.0.0.1", &yes, nil, nil)),
+		newTestSlice(discoveryv1.AddressTypeIPv6, "http", 8080,
+			newTestEndpoint("fd00::1", &yes, nil, nil)),
+	}
+
+	c := NewClusterConfig("init")
+	tests := []struct {
+		name string
+		port intstr.IntOrString
+		want []string
+	}{
+		{"named port", intstr.FromString("http"), []string{"10.0.0.1:8080", "10.0.0.2:8080", "10.0.0.5:8080"}},
+		{"number port", intstr.FromInt(9090), []string{"10.0.0.1:9090"}},
+		{"no port", intstr.IntOrString{}, []string{"10.0.0.1:8080"}},
+		{"port not found", intstr.FromString("grpc"), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := backendAddrs(c.newSubClusterBackends("default/svc", slices, tt.port, nil)[""]); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("newSubClusterBackends() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// IPv6 slices are used if no IPv4 slice
+	got := backendAddrs(c.newSubClusterBackends("default/svc", slices[3:], intstr.FromString("http"), nil)[""])
+	if want := []string{"fd00::1:8080"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("newSubClusterBackends() = %v, want %v", got, want)
+	}
+}
+
+func TestClusterConfig_draining(t *testing.T) {
+	setTestOptions(t)
+	option.Opts.Ingress.DrainTimeout = time.Minute
+
+	yes, no := true, false
+	slices := []*discoveryv1.EndpointSlice{
+		newTestSlice(discoveryv1.AddressTypeIPv4, "http", 8080,
+			newTestEndpoint("10.0.0.1", &yes, nil, nil),
+			newTestEndpoint("10.0.0.2", &no, &yes, &yes)),
+	}
+
+	c := NewClusterConfig("init")
+	instances := c.newSubClusterBackends("default/svc", slices, intstr.FromString("http"), nil)[""]
+	if len(instances) != 2 || *instances[1].Addr != "10.0.0.2" || *instances[1].Weight != 0 {
+		t.Fatalf("terminating endpoint should be drained with weight 0, got %v", backendAddrs(instances))
+	}
+	(*c.clusterTableConf.Config)["cluster"] = cluster_table_conf.ClusterBackend{"default/svc": instances}
+
+	// not expired
+	c.expireDraining(time.Now())
+	if got := (*c.clusterTableConf.Config)["cluster"]["default/svc"]; len(got) != 2 {
+		t.Errorf("draining endpoint should not be removed before drain timeout, got %v", backendAddrs(got))
+	}
+
+	// expired
+	c.expireDraining(time.Now().Add(time.Minute))
+	if got := (*c.clusterTableConf.Config)["cluster"]["default/svc"]; len(got) != 1 || *got[0].Addr != "10.0.0.1" {
+		t.Errorf("draining endpoint should be removed after drain timeout, got %v", backendAddrs(got))
+	}
+
+	// draining endpoint is not used if no endpoint is ready
+	slices[0].Endpoints[0].Conditions.Ready = &no
+	if got := c.newSubClusterBackends("default/svc", slices, intstr.FromString("http"), nil)[""]; len(got) != 0 {
+		t.Errorf("newSubClusterBackends() = %v, want empty", backendAddrs(got))
+	}
+
+	// not ready endpoint is used if no endpoint is ready
+	option.Opts.Ingress.NotReadyFallback = true
+	if got := backendAddrs(c.newSubClusterBackends("default/svc", slices, intstr.FromString("http"), nil)[""]); !reflect.DeepEqual(got, []string{"10.0.0.1:8080", "10.0.0.2:8080"}) {
+		t.Errorf("newSubClusterBackends() = %v, want not ready and draining endpoints", got)
+	}
+}
+
+func newTestZoneEndpoint(ip, zone string) discoveryv1.Endpoint {
+	ready := true
+	ep := newTestEndpoint(ip, &ready, nil, nil)
+	ep.Zone = &zone
+	return ep
+}
+
+func TestClusterConfig_zoneAwareRouting(t *testing.T) {
+	setTestOptions(t)
+	option.Opts.Ingress.ZoneAwareRouting = true
+	option.Opts.Ingress.Zone = "zone-a"
+
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "svc"},
+		Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "http", Port: 80}}},
+	}
+	slices := []*discoveryv1.EndpointSlice{
+		newTestSlice(discoveryv1.AddressTypeIPv4, "http", 8080,
+			newTestZoneEndpoint("10.0.0.1", "zone-a"),
+			newTestZoneEndpoint("10.0.0.2", "zone-b"),
+			newTestZoneEndpoint("10.0.0.3", "zone-b"),
+			newTestZoneEndpoint("10.0.0.4", "zone-c")),
+	}
+
+	c := NewClusterConfig("init")
+	ingress := newTestIngress("ingress", time.Now(), nil, "foo.com", "/")
+	err := c.UpdateIngress(ingress,
+		map[string]*corev1.Service{"default/svc": service},
+		map[string][]*discoveryv1.EndpointSlice{"default/svc": slices}, nil)
+	if err != nil {
+		t.Fatalf("UpdateIngress() error: %s", err)
+	}
+
+	// sub-cluster in zone of controller is preferred
+	cluster := util.ClusterName("default/ingress", ingress.Spec.Rules[0].HTTP.Paths[0].Backend.Service)
+	want := gslb_conf.GslbClusterConf{"default/svc/zone-a": defaultWeight, "default/svc/zone-b": 0, "default/svc/zone-c": 0}
+	if got := (*c.gslbConf.Clusters)[cluster]; !reflect.DeepEqual(got, want) {
+		t.Errorf("gslb conf = %v, want %v", got, want)
+	}
+	if got := backendAddrs((*c.clusterTableConf.Config)[cluster]["default/svc/zone-b"]); !reflect.DeepEqual(got, []string{"10.0.0.2:8080", "10.0.0.3:8080"}) {
+		t.Errorf("backends of zone-b = %v", got)
+	}
+
+	// weight is split by number of backends if no endpoint in zone of controller
+	slices[0].Endpoints = slices[0].Endpoints[1:]
+	if err := c.UpdateService(service, slices, nil); err != nil {
+		t.Fatalf("UpdateService() error: %s", err)
+	}
+	want = gslb_conf.GslbClusterConf{"default/svc/zone-b": 6, "default/svc/zone-c": 3}
+	if got := (*c.gslbConf.Clusters)[cluster]; !reflect.DeepEqual(got, want) {
+		t.Errorf("gslb conf = %v, want %v", got, want)
+	}
+	if err := cluster_table_conf.ClusterTableConfCheck(c.clusterTableConf); err != nil {
+		t.Errorf("ClusterTableConfCheck() error: %s", err)
+	}
+
+	// topology hints are used if all endpoints have hints
+	for i := range slices[0].Endpoints {
+		slices[0].Endpoints[i].Hints = &discoveryv1.EndpointHints{ForZones: []discoveryv1.ForZone{{Name: "zone-a"}}}
+	}
+	if err := c.UpdateService(service, slices, nil); err != nil {
+		t.Fatalf("UpdateService() error: %s", err)
+	}
+	want = gslb_conf.GslbClusterConf{"default/svc/zone-a": defaultWeight}
+	if got := (*c.gslbConf.Clusters)[cluster]; !reflect.DeepEqual(got, want) {
+		t.Errorf("gslb conf = %v, want %v", got, want)
+	}
+
+	c.DeleteService("default", "svc")
+	if _, ok := (*c.gslbConf.Clusters)[cluster]; ok {
+		t.Errorf("gslb conf of cluster should be deleted with service")
+	}
+}
+
+func TestClusterConfig_weights(t *testing.T) {
+	setTestOptions(t)
+
+	yes := true
+	slices := []*discoveryv1.EndpointSlice{
+		newTestSlice(discoveryv1.AddressTypeIPv4, "http", 8080,
+			newTestEndpoint("10.0.0.1", &yes, nil, nil),
+			newTestEndpoint("10.0.0.2", &yes, nil, nil),
+			newTestEndpoint("10.0.0.3", &yes, nil, nil)),
+	}
+
+	c := NewClusterConfig("init")
+	weights := map[string]int{"10.0.0.2": 20, "10.0.0.3": 0}
+	instances := c.newSubClusterBackends("default/svc", slices, intstr.FromString("http"), weights)[""]
+	if got := backendAddrs(instances); !reflect.DeepEqual(got, []string{"10.0.0.1:8080", "10.0.0.2:8080"}) {
+		t.Fatalf("newSubClusterBackends() = %v, endpoint of weight 0 should be skipped", got)
+	}
+	if *instances[0].Weight != defaultWeight || *instances[1].Weight != 20 {
+		t.Errorf("weights = %d, %d, want %d, 20", *instances[0].Weight, *instances[1].Weight, defaultWeight)
+	}
+}
+
+func TestClusterConfig_unresolvedBackend(t *testing.T) {
+	setTestOptions(t)
+
+	// ingress with service without endpoints fails check of cluster table
+	c := NewClusterConfig("init")
+	ingress := newTestIngress("ingress", time.Now(), nil, "foo.com", "/")
+	if err := c.UpdateIngress(ingress, nil, nil, nil); err == nil {
+		t.Fatalf("UpdateIngress() should fail for service without endpoints")
+	}
+
+	// unresolved service of route has no subcluster
+	route := newTestRoute("route", time.Now(), "foo.com", "/")
+	service := route.Rules[0].Path.Backend.Service
+	route.UnresolvedBackends = []string{service.Name}
+	if err := c.UpdateRoute(route, nil, nil, nil); err != nil {
+		t.Fatalf("UpdateRoute() error: %s", err)
+	}
+
+	cluster := util.ClusterName("default/httproute:route:0", service)
+	if got, ok := (*c.clusterTableConf.Config)[cluster]; !ok || len(got) != 0 {
+		t.Errorf("cluster backend = %v, %v, want empty", got, ok)
+	}
+}
+
+func TestClusterConfig_canaryConf(t *testing.T) {
+	setTestOptions(t)
+
+	c := NewClusterConfig("init")
+	backend := func(ip string) cluster_table_conf.SubClusterBackend {
+		return cluster_table_conf.SubClusterBackend{newBackendConf(ip, 80, defaultWeight)}
+	}
+	(*c.clusterTableConf.Config)["primary"] = cluster_table_conf.ClusterBackend{"default/v1": backend("10.0.0.1"), "default/v2": backend("10.0.0.2")}
+	(*c.gslbConf.Clusters)["primary"] = gslb_conf.GslbClusterConf{"default/v1": 80, "default/v2": 20}
+	(*c.clusterTableConf.Config)["canary"] = cluster_table_conf.ClusterBackend{"default/v3": backend("10.0.0.3")}
+	(*c.gslbConf.Clusters)["canary"] = gslb_conf.GslbClusterConf{"default/v3": 10}
+
+	gslbConf, clusterTableConf := c.canaryConf()
+	if len(*gslbConf.Clusters) != 2 || len(*clusterTableConf.Config) != 2 {
+		t.Errorf("canaryConf() should not change conf without canary")
+	}
+
+	c.canaries = map[string]canaryBackend{"primary_canary": {primary: "primary", canary: "canary", weight: 30}}
+	gslbConf, clusterTableConf = c.canaryConf()
+	want := gslb_conf.GslbClusterConf{"default/v1": 80 * 10 * 70, "default/v2": 20 * 10 * 70, "canary/default/v3": 10 * 100 * 30}
+	if got := (*gslbConf.Clusters)["primary_canary"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("gslb conf = %v, want %v", got, want)
+	}
+	if got := backendAddrs((*clusterTableConf.Config)["primary_canary"]["canary/default/v3"]); !reflect.DeepEqual(got, []string{"10.0.0.3:80"}) {
+		t.Errorf("backends of canary = %v", got)
+	}
+	if _, ok := (*c.gslbConf.Clusters)["primary_canary"]; ok {
+		t.Errorf("canaryConf() should not change gslb conf of cluster config")
+	}
+	if err := cluster_table_conf.ClusterTableConfCheck(clusterTableConf); err != nil {
+		t.Errorf("ClusterTableConfCheck() error: %s", err)
+	}
+
+	// requests are routed to primary if canary cluster not exist
+	delete(*c.gslbConf.Clusters, "canary")
+	gslbConf, _ = c.canaryConf()
+	want = gslb_conf.GslbClusterConf{"default/v1": 80, "default/v2": 20}
+	if got := (*gslbConf.Clusters)["primary_canary"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("gslb conf = %v, want %v", got, want)
+	}
+}
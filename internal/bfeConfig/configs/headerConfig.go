@@ -0,0 +1,149 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package configs
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/bfenetworks/bfe/bfe_modules/mod_header"
+	netv1 "k8s.io/api/networking/v1"
+
+	"github.com/bfenetworks/ingress-bfe/internal/bfeConfig/annotations"
+	"github.com/bfenetworks/ingress-bfe/internal/bfeConfig/util"
+)
+
+const (
+	ConfigNameHeader = "mod_header"
+)
+
+var (
+	HeaderData = "mod_header/header_rule.data"
+)
+
+type HeaderConfig struct {
+	moduleRule
+
+	// ingress -> header
+	headers map[string]*annotations.Header
+}
+
+func NewHeaderConfig(version string) *HeaderConfig {
+	c := &HeaderConfig{
+		headers: make(map[string]*annotations.Header),
+	}
+	c.moduleRule = newModuleRule(ConfigNameHeader, HeaderData, version, c)
+	return c
+}
+
+func newHeaderConfFile(version string) *mod_header.HeaderConfFile {
+	productRules := make(mod_header.ProductRulesFile)
+	productRules[DefaultProduct] = &mod_header.RuleFileList{}
+
+	return &mod_header.HeaderConfFile{
+		Version: &version,
+		Config:  &productRules,
+	}
+}
+
+// UpdateIngress updates header rules of ingress, routes should contain rules of the ingress
+func (c *HeaderConfig) UpdateIngress(ingress *netv1.Ingress, routes *RouteRuleCache) error {
+	return c.update(newIngressSource(ingress), routes)
+}
+
+// UpdateRoute updates header rules of route rules, routes should contain rules of the route
+func (c *HeaderConfig) UpdateRoute(route *Route, routes *RouteRuleCache) error {
+	for i := range route.Rules {
+		if err := c.update(route.ruleSource(i), routes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *HeaderConfig) update(src *ruleSource, routes *RouteRuleCache) error {
+	ingressName := util.NamespacedName(src.namespace, src.name)
+
+	header, err := annotations.GetHeader(src.annotations)
+	if err != nil {
+		return err
+	}
+
+	return c.updateIngress(ingressName, func() {
+		if header != nil {
+			c.headers[ingressName] = header
+		}
+	}, routes)
+}
+
+func (c *HeaderConfig) hasRule(rule *httpRule) bool {
+	_, ok := c.headers[rule.ingress]
+	return ok
+}
+
+func (c *HeaderConfig) removeIngress(ingress string) {
+	delete(c.headers, ingress)
+}
+
+func (c *HeaderConfig) buildConf(version string, rules []ingressRule) (moduleConf, error) {
+	headerConfFile := newHeaderConfFile(version)
+	ruleList := (*headerConfFile.Config)[DefaultProduct]
+	for _, rule := range rules {
+		header := c.headers[rule.ingress]
+		condition := rule.condition
+		actions := newHeaderActions("REQ", header.Request)
+		actions = append(actions, newHeaderActions("RSP", header.Response)...)
+		last := true
+		*ruleList = append(*ruleList, mod_header.HeaderRuleFile{
+			Cond:    &condition,
+			Actions: &actions,
+			Last:    &last,
+		})
+	}
+
+	if err := mod_header.HeaderConfCheck(*headerConfFile); err != nil {
+		return moduleConf{}, fmt.Errorf("fail to check generated header conf, err: %s", err)
+	}
+
+	return moduleConf{file: headerConfFile, version: headerConfFile.Version, rules: headerConfFile.Config}, nil
+}
+
+// newHeaderActions builds actions of request or response headers, in order of delete, set and add
+func newHeaderActions(prefix string, headers annotations.HeaderActions) mod_header.ActionFileList {
+	var actions mod_header.ActionFileList
+	newAction := func(cmd string, params ...string) {
+		cmd = prefix + cmd
+		actions = append(actions, mod_header.ActionFile{Cmd: &cmd, Params: params})
+	}
+
+	for _, name := range headers.Delete {
+		newAction("_HEADER_DEL", name)
+	}
+	for _, name := range sortedKeys(headers.Set) {
+		newAction("_HEADER_SET", name, headers.Set[name])
+	}
+	for _, name := range sortedKeys(headers.Add) {
+		newAction("_HEADER_ADD", name, headers.Add[name])
+	}
+	return actions
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package configs
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bfenetworks/bfe/bfe_modules/mod_header"
+
+	"github.com/bfenetworks/ingress-bfe/internal/bfeConfig/annotations"
+)
+
+func TestHeaderConfig_UpdateIngress(t *testing.T) {
+	setTestOptions(t)
+
+	s := NewServerDataConfig("init")
+	c := NewHeaderConfig("init")
+
+	ingress := newTestIngress("ingress1", time.Now(), map[string]string{
+		annotations.RequestHeaderSetAnnotation:     `{"X-B": "b", "X-A": "a"}`,
+		annotations.ResponseHeaderDeleteAnnotation: "Server",
+	}, "foo.com", "/api")
+	if err := updateTestIngress(t, s, c, ingress); err != nil {
+		t.Fatalf("UpdateIngress() error: %s", err)
+	}
+
+	rules := *(*c.conf.file.(*mod_header.HeaderConfFile).Config)[DefaultProduct]
+	if len(rules) != 1 {
+		t.Fatalf("header rules = %d, want 1", len(rules))
+	}
+	var cmds []string
+	for _, action := range *rules[0].Actions {
+		cmds = append(cmds, *action.Cmd+":"+action.Params[0])
+	}
+	want := "REQ_HEADER_SET:X-A,REQ_HEADER_SET:X-B,RSP_HEADER_DEL:Server"
+	if got := strings.Join(cmds, ","); got != want {
+		t.Errorf("header actions = %s, want %s", got, want)
+	}
+
+	// illegal annotation
+	ingress.Annotations[annotations.RequestHeaderAddAnnotation] = "X-Foo: bar"
+	if err := c.UpdateIngress(ingress, s.RouteRules()); err == nil {
+		t.Errorf("UpdateIngress() should fail for illegal annotation")
+	}
+
+	deleteTestIngress(s, &c.moduleRule, "ingress1")
+	if rules := *(*c.conf.file.(*mod_header.HeaderConfFile).Config)[DefaultProduct]; len(rules) != 0 {
+		t.Errorf("header rules = %d, want 0", len(rules))
+	}
+}
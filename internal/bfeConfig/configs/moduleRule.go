@@ -0,0 +1,265 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package configs
+
+import (
+	"fmt"
+	"path"
+	"reflect"
+	"strings"
+
+	"github.com/bfenetworks/bfe/bfe_basic/condition"
+
+	"github.com/bfenetworks/ingress-bfe/internal/bfeConfig/util"
+)
+
+// ingressRule is route rule of ingress with module settings, and condition of module rule for it
+type ingressRule struct {
+	*httpRule
+	// condition built by routeCondition, checked by bfe condition parser
+	condition string
+}
+
+// moduleConf is conf file of bfe module
+type moduleConf struct {
+	// conf file dumped to data file of module
+	file interface{}
+	// version of conf file
+	version *string
+	// rules in conf file, version is kept if rules not changed
+	rules interface{}
+}
+
+// moduleRuleBuilder is implemented by configs of bfe modules, whose rules are built for route rules of ingresses
+type moduleRuleBuilder interface {
+	// hasRule returns true if module rule should be built for route rule
+	hasRule(rule *httpRule) bool
+	// buildConf builds conf of module from route rules, and checks it with bfe module
+	buildConf(version string, rules []ingressRule) (moduleConf, error)
+	// removeIngress removes module settings of ingress
+	removeIngress(ingress string)
+}
+
+// moduleRule keeps conf of bfe module built from all route rules, as conditions of module rules depend on them.
+// It is embedded in configs of bfe modules, which supply builder of module rules.
+type moduleRule struct {
+	// config name of module to reload bfe
+	configName string
+	dataFile   string
+	// version of conf reloaded
+	version string
+
+	builder moduleRuleBuilder
+	conf    moduleConf
+}
+
+func newModuleRule(configName, dataFile, version string, builder moduleRuleBuilder) moduleRule {
+	conf, _ := builder.buildConf(version, nil)
+	return moduleRule{
+		configName: configName,
+		dataFile:   dataFile,
+		builder:    builder,
+		conf:       conf,
+	}
+}
+
+// updateIngress updates module rules after module settings of ingress are set by set, routes should contain rules of the ingress.
+// Settings of ingress are removed if module rules are illegal.
+func (m *moduleRule) updateIngress(ingress string, set func(), routes *RouteRuleCache) error {
+	m.builder.removeIngress(ingress)
+	set()
+
+	if err := m.updateConf(routes); err != nil {
+		m.builder.removeIngress(ingress)
+		m.updateConf(routes)
+		return err
+	}
+	return nil
+}
+
+// DeleteIngress deletes module rules of ingress, routes should not contain rules of the ingress
+func (m *moduleRule) DeleteIngress(namespace, name string, routes *RouteRuleCache) {
+	m.builder.removeIngress(util.NamespacedName(namespace, name))
+
+	// conditions of other ingresses depend on all route rules
+	m.updateConf(routes)
+}
+
+func (m *moduleRule) updateConf(routes *RouteRuleCache) error {
+	rules := routes.GetAllHttpRules()
+
+	var ingressRules []ingressRule
+	for _, rule := range rules {
+		if !m.builder.hasRule(rule) {
+			continue
+		}
+
+		condition, err := routeCondition(rule, rules)
+		if err != nil {
+			return err
+		}
+		if err := checkCondition(condition); err != nil {
+			return err
+		}
+		ingressRules = append(ingressRules, ingressRule{httpRule: rule, condition: condition})
+	}
+
+	conf, err := m.builder.buildConf(util.NewVersion(), ingressRules)
+	if err != nil {
+		return err
+	}
+
+	// keep version if rules not changed
+	if reflect.DeepEqual(conf.rules, m.conf.rules) {
+		return nil
+	}
+	m.conf = conf
+
+	return nil
+}
+
+// renewVersion sets new version of conf, for files referred by module rules are changed
+func (m *moduleRule) renewVersion() {
+	*m.conf.version = util.NewVersion()
+}
+
+func (m *moduleRule) changed() bool {
+	return *m.conf.version != m.version
+}
+
+func (m *moduleRule) Reload() error {
+	if !m.changed() {
+		return nil
+	}
+
+	if err := util.DumpBfeConf(m.dataFile, m.conf.file); err != nil {
+		return fmt.Errorf("dump %s error: %v", path.Base(m.dataFile), err)
+	}
+	if err := util.ReloadBfe(m.configName); err != nil {
+		return err
+	}
+	m.version = *m.conf.version
+
+	return nil
+}
+
+// routeCondition builds condition of module rule for a route rule.
+// Module rules are not aware of route result, so route rules with higher priority,
+// which may overlap with given rule, are excluded from the condition.
+func routeCondition(rule *httpRule, rules []*httpRule) (string, error) {
+	cond, err := buildCondition(rule)
+	if err != nil {
+		return "", err
+	}
+
+	var statement []string
+	if len(cond) > 0 {
+		statement = append(statement, cond)
+	}
+
+	for _, r := range rules {
+		if r == rule || !higherPriority(r, rule) || !overlapRule(r, rule) {
+			continue
+		}
+		cond, err := buildCondition(r)
+		if err != nil {
+			return "", err
+		}
+		if len(cond) == 0 {
+			continue
+		}
+		statement = append(statement, "!("+cond+")")
+	}
+
+	if len(statement) == 0 {
+		return "default_t()", nil
+	}
+	return strings.Join(statement, "&&"), nil
+}
+
+// higherPriority returns true if rule1 is matched before rule2 in route table
+func higherPriority(rule1, rule2 *httpRule) bool {
+	// host: exact match over wildcard match over any host
+	if rank1, rank2 := hostRank(rule1.host), hostRank(rule2.host); rank1 != rank2 {
+		return rank1 > rank2
+	}
+	if result := comparePriority(rule1.host, rule2.host, wildcardHost); result != 0 {
+		return result > 0
+	}
+
+	// path: exact match over prefix match over regex match, long path over short path
+	if result := comparePath(rule1.path, rule2.path); result != 0 {
+		return result > 0
+	}
+
+	priority1 := rule1.getPriority()
+	priority2 := rule2.getPriority()
+	if priority1 != priority2 {
+		return priority1 > priority2
+	}
+
+	return rule1.createTime.Before(rule2.createTime)
+}
+
+func hostRank(host string) int {
+	if len(host) == 0 || host == "*" {
+		return 0
+	}
+	if wildcardHost(host) {
+		return 1
+	}
+	return 2
+}
+
+// overlapRule returns false if no request matches both rules
+func overlapRule(rule1, rule2 *httpRule) bool {
+	return overlapHost(rule1.host, rule2.host) && overlapPath(rule1.path, rule2.path)
+}
+
+func overlapHost(host1, host2 string) bool {
+	if hostRank(host1) == 0 || hostRank(host2) == 0 {
+		return true
+	}
+
+	host1, host2 = strings.ToLower(host1), strings.ToLower(host2)
+	if wildcardHost(host1) && strings.HasSuffix(host2, host1[1:]) {
+		return true
+	}
+	if wildcardHost(host2) && strings.HasSuffix(host1, host2[1:]) {
+		return true
+	}
+	return host1 == host2
+}
+
+func overlapPath(path1, path2 string) bool {
+	// regex path may overlap with any path
+	if regexPath(path1) || regexPath(path2) {
+		return true
+	}
+	if wildcardPath(path1) && strings.HasPrefix(path2, strings.TrimSuffix(path1, "*")) {
+		return true
+	}
+	if wildcardPath(path2) && strings.HasPrefix(path1, strings.TrimSuffix(path2, "*")) {
+		return true
+	}
+	return path1 == path2
+}
+
+// checkCondition checks generated condition with bfe condition parser
+func checkCondition(cond string) error {
+	if _, err := condition.Build(cond); err != nil {
+		return fmt.Errorf("condition [%s] is illegal, err: %s", cond, err)
+	}
+	return nil
+}
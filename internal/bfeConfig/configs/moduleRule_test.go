@@ -0,0 +1,136 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package configs
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	netv1 "k8s.io/api/networking/v1"
+)
+
+func newTestIngress(name string, createTime time.Time, annots map[string]string, host string, paths ...string) *netv1.Ingress {
+	pathType := netv1.PathTypePrefix
+	var httpPaths []netv1.HTTPIngressPath
+	for _, path := range paths {
+		httpPaths = append(httpPaths, netv1.HTTPIngressPath{
+			Path:     path,
+			PathType: &pathType,
+			Backend: netv1.IngressBackend{
+				Service: &netv1.IngressServiceBackend{Name: "svc", Port: netv1.ServiceBackendPort{Number: 80}},
+			},
+		})
+	}
+
+	ingress := newTestTLSIngress(name, createTime, "", host)
+	ingress.Spec.TLS = nil
+	ingress.Annotations = annots
+	ingress.Spec.Rules = []netv1.IngressRule{{
+		Host:             host,
+		IngressRuleValue: netv1.IngressRuleValue{HTTP: &netv1.HTTPIngressRuleValue{Paths: httpPaths}},
+	}}
+	return ingress
+}
+
+// updateTestRoutes updates ingresses to route config
+func updateTestRoutes(t *testing.T, s *ServerDataConfig, ingresses ...*netv1.Ingress) {
+	for _, ingress := range ingresses {
+		if err := s.UpdateIngress(ingress, nil, nil, nil); err != nil {
+			t.Fatalf("UpdateIngress() of route error: %s", err)
+		}
+	}
+}
+
+// updateTestIngress updates ingress to route config and module config
+func updateTestIngress(t *testing.T, s *ServerDataConfig, c interface {
+	UpdateIngress(*netv1.Ingress, *RouteRuleCache) error
+}, ingress *netv1.Ingress) error {
+	updateTestRoutes(t, s, ingress)
+	return c.UpdateIngress(ingress, s.RouteRules())
+}
+
+// deleteTestIngress deletes ingress from route config and module config
+func deleteTestIngress(s *ServerDataConfig, m *moduleRule, name string) {
+	s.DeleteIngress("default", name)
+	m.DeleteIngress("default", name, s.RouteRules())
+}
+
+// testModuleBuilder builds conditions of route rules as module rules, rules of ingress fail are illegal
+type testModuleBuilder struct {
+	ingresses map[string]bool
+	fail      string
+}
+
+func (b *testModuleBuilder) hasRule(rule *httpRule) bool {
+	return b.ingresses[rule.ingress]
+}
+
+func (b *testModuleBuilder) removeIngress(ingress string) {
+	delete(b.ingresses, ingress)
+}
+
+func (b *testModuleBuilder) buildConf(version string, rules []ingressRule) (moduleConf, error) {
+	conditions := []string{}
+	for _, rule := range rules {
+		if rule.ingress == b.fail {
+			return moduleConf{}, fmt.Errorf("rule of %s is illegal", rule.ingress)
+		}
+		conditions = append(conditions, rule.condition)
+	}
+	return moduleConf{file: conditions, version: &version, rules: conditions}, nil
+}
+
+func TestModuleRule_UpdateIngress(t *testing.T) {
+	setTestOptions(t)
+
+	s := NewServerDataConfig("init")
+	b := &testModuleBuilder{ingresses: make(map[string]bool), fail: "default/ingress2"}
+	m := newModuleRule("mod_test", "mod_test/test.data", "init", b)
+
+	ingress1 := newTestIngress("ingress1", time.Now(), nil, "foo.com", "/")
+	updateTestRoutes(t, s, ingress1)
+	set := func(ingress string) func() {
+		return func() { b.ingresses[ingress] = true }
+	}
+	if err := m.updateIngress("default/ingress1", set("default/ingress1"), s.RouteRules()); err != nil {
+		t.Fatalf("updateIngress() error: %s", err)
+	}
+	want := []string{`req_host_in("foo.com")&&req_path_element_prefix_in("/", false)`}
+	if !reflect.DeepEqual(m.conf.rules, want) || !m.changed() {
+		t.Errorf("module rules = %v, want %v", m.conf.rules, want)
+	}
+
+	// version is kept if rules not changed
+	version := *m.conf.version
+	if err := m.updateIngress("default/ingress1", set("default/ingress1"), s.RouteRules()); err != nil || *m.conf.version != version {
+		t.Errorf("updateIngress() should keep version, error: %v", err)
+	}
+
+	// settings of ingress are removed if its rules are illegal
+	ingress2 := newTestIngress("ingress2", time.Now(), nil, "bar.com", "/")
+	updateTestRoutes(t, s, ingress2)
+	if err := m.updateIngress("default/ingress2", set("default/ingress2"), s.RouteRules()); err == nil {
+		t.Errorf("updateIngress() should fail for illegal rules")
+	}
+	if b.ingresses["default/ingress2"] || !reflect.DeepEqual(m.conf.rules, want) {
+		t.Errorf("module rules = %v, want %v", m.conf.rules, want)
+	}
+
+	deleteTestIngress(s, &m, "ingress1")
+	if rules := m.conf.rules.([]string); len(rules) != 0 {
+		t.Errorf("module rules = %v, want none", rules)
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package configs
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bfenetworks/bfe/bfe_basic/action"
+	"github.com/bfenetworks/bfe/bfe_modules/mod_prison"
+	netv1 "k8s.io/api/networking/v1"
+
+	"github.com/bfenetworks/ingress-bfe/internal/bfeConfig/annotations"
+	"github.com/bfenetworks/ingress-bfe/internal/bfeConfig/util"
+)
+
+const (
+	ConfigNamePrison = "mod_prison"
+
+	// requests are counted in check period of one second
+	PrisonCheckPeriod = 1
+
+	// max number of clients counted and blocked for each ingress
+	PrisonAccessDictSize = 100000
+	PrisonPrisonDictSize = 10000
+)
+
+var (
+	PrisonData = "mod_prison/prison.data"
+)
+
+type PrisonConfig struct {
+	moduleRule
+
+	// ingress -> rate limit
+	rateLimits map[string]*annotations.RateLimit
+}
+
+func NewPrisonConfig(version string) *PrisonConfig {
+	c := &PrisonConfig{
+		rateLimits: make(map[string]*annotations.RateLimit),
+	}
+	c.moduleRule = newModuleRule(ConfigNamePrison, PrisonData, version, c)
+	return c
+}
+
+func newPrisonConfFile(version string) *mod_prison.ProductRuleConf {
+	productRules := make(map[string]*mod_prison.PrisonRuleConfList)
+	productRules[DefaultProduct] = &mod_prison.PrisonRuleConfList{}
+
+	return &mod_prison.ProductRuleConf{
+		Version: &version,
+		Config:  &productRules,
+	}
+}
+
+// UpdateIngress updates prison rules of ingress, routes should contain rules of the ingress
+func (c *PrisonConfig) UpdateIngress(ingress *netv1.Ingress, routes *RouteRuleCache) error {
+	ingressName := util.NamespacedName(ingress.Namespace, ingress.Name)
+
+	rateLimit, err := annotations.GetRateLimit(ingress.Annotations)
+	if err != nil {
+		return err
+	}
+
+	return c.updateIngress(ingressName, func() {
+		if rateLimit != nil {
+			c.rateLimits[ingressName] = rateLimit
+		}
+	}, routes)
+}
+
+func (c *PrisonConfig) hasRule(rule *httpRule) bool {
+	_, ok := c.rateLimits[rule.ingress]
+	return ok
+}
+
+func (c *PrisonConfig) removeIngress(ingress string) {
+	delete(c.rateLimits, ingress)
+}
+
+// buildConf builds one prison rule for each ingress, so requests routed to all rules of the ingress
+// are counted together. Prison rule is named by ingress, and its counters are kept while reloading.
+func (c *PrisonConfig) buildConf(version string, rules []ingressRule) (moduleConf, error) {
+	var ingresses []string
+	conditions := make(map[string][]string)
+	for _, rule := range rules {
+		if _, ok := conditions[rule.ingress]; !ok {
+			ingresses = append(ingresses, rule.ingress)
+		}
+		conditions[rule.ingress] = append(conditions[rule.ingress], "("+rule.condition+")")
+	}
+
+	prisonConfFile := newPrisonConfFile(version)
+	ruleList := (*prisonConfFile.Config)[DefaultProduct]
+	for _, ingress := range ingresses {
+		condition := strings.Join(conditions[ingress], "||")
+		*ruleList = append(*ruleList, newPrisonRule(ingress, condition, c.rateLimits[ingress]))
+	}
+
+	if err := mod_prison.ProductRulesCheck(*prisonConfFile.Config); err != nil {
+		return moduleConf{}, fmt.Errorf("fail to check generated prison conf, err: %s", err)
+	}
+
+	return moduleConf{file: prisonConfFile, version: prisonConfFile.Version, rules: prisonConfFile.Config}, nil
+}
+
+func newPrisonRule(name, condition string, rateLimit *annotations.RateLimit) *mod_prison.PrisonRuleConf {
+	signConf := &mod_prison.AccessSignConf{}
+	switch {
+	case len(rateLimit.Header) > 0:
+		signConf.Header = []string{rateLimit.Header}
+	case len(rateLimit.Cookie) > 0:
+		signConf.Cookie = []string{rateLimit.Cookie}
+	default:
+		signConf.UseClientIP = true
+	}
+
+	checkPeriod := int64(PrisonCheckPeriod)
+	stayPeriod := int64(rateLimit.BlockDuration / time.Second)
+	threshold := int32(rateLimit.RPS*PrisonCheckPeriod + rateLimit.Burst)
+	accessDictSize, prisonDictSize := PrisonAccessDictSize, PrisonPrisonDictSize
+	return &mod_prison.PrisonRuleConf{
+		Cond:           &condition,
+		Action:         &action.Action{Cmd: action.ActionClose, Params: []string{}},
+		AccessSignConf: signConf,
+		Name:           &name,
+		CheckPeriod:    &checkPeriod,
+		StayPeriod:     &stayPeriod,
+		Threshold:      &threshold,
+		AccessDictSize: &accessDictSize,
+		PrisonDictSize: &prisonDictSize,
+	}
+}
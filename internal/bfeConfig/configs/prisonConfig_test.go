@@ -0,0 +1,78 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configs
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bfenetworks/bfe/bfe_modules/mod_prison"
+
+	"github.com/bfenetworks/ingress-bfe/internal/bfeConfig/annotations"
+)
+
+func TestPrisonConfig_UpdateIngress(t *testing.T) {
+	setTestOptions(t)
+
+	s := NewServerDataConfig("init")
+	c := NewPrisonConfig("init")
+
+	ingress := newTestIngress("ingress1", time.Now(), map[string]string{
+		annotations.RateLimitRPSAnnotation:           "10",
+		annotations.RateLimitBurstAnnotation:         "5",
+		annotations.RateLimitBlockDurationAnnotation: "30s",
+		annotations.RateLimitKeyAnnotation:           "header:X-Api-Key",
+	}, "foo.com", "/api", "/v2/api")
+	if err := updateTestIngress(t, s, c, ingress); err != nil {
+		t.Fatalf("UpdateIngress() error: %s", err)
+	}
+
+	// one rule for all paths of ingress
+	rules := *(*c.conf.file.(*mod_prison.ProductRuleConf).Config)[DefaultProduct]
+	if len(rules) != 1 {
+		t.Fatalf("prison rules = %d, want 1", len(rules))
+	}
+	rule := rules[0]
+	if *rule.Name != "default/ingress1" || *rule.Threshold != 15 || *rule.StayPeriod != 30 || *rule.CheckPeriod != 1 {
+		t.Errorf("prison rule = %s, threshold %d, stay period %d, check period %d",
+			*rule.Name, *rule.Threshold, *rule.StayPeriod, *rule.CheckPeriod)
+	}
+	if !reflect.DeepEqual(rule.AccessSignConf.Header, []string{"X-Api-Key"}) || rule.AccessSignConf.UseClientIP {
+		t.Errorf("prison sign conf = %+v", *rule.AccessSignConf)
+	}
+	want := `(req_host_in("foo.com")&&req_path_element_prefix_in("/v2/api", false))||` +
+		`(req_host_in("foo.com")&&req_path_element_prefix_in("/api", false))`
+	if *rule.Cond != want {
+		t.Errorf("prison rule condition = %s, want %s", *rule.Cond, want)
+	}
+
+	// version is kept if rules not changed
+	version := *c.conf.version
+	if err := c.UpdateIngress(ingress, s.RouteRules()); err != nil || *c.conf.version != version {
+		t.Errorf("UpdateIngress() should keep version, error: %v", err)
+	}
+
+	// illegal annotation
+	ingress.Annotations[annotations.RateLimitRPSAnnotation] = "-1"
+	if err := c.UpdateIngress(ingress, s.RouteRules()); err == nil {
+		t.Errorf("UpdateIngress() should fail for illegal annotation")
+	}
+
+	deleteTestIngress(s, &c.moduleRule, "ingress1")
+	if rules := *(*c.conf.file.(*mod_prison.ProductRuleConf).Config)[DefaultProduct]; len(rules) != 0 {
+		t.Errorf("prison rules = %d, want 0", len(rules))
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package configs
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/bfenetworks/bfe/bfe_modules/mod_redirect"
+	netv1 "k8s.io/api/networking/v1"
+
+	"github.com/bfenetworks/ingress-bfe/internal/bfeConfig/annotations"
+	"github.com/bfenetworks/ingress-bfe/internal/bfeConfig/util"
+)
+
+const (
+	ConfigNameRedirect = "mod_redirect"
+
+	// SSLRedirectCode keeps method and body of request when redirected
+	SSLRedirectCode = http.StatusPermanentRedirect
+)
+
+var (
+	RedirectData = "mod_redirect/redirect.data"
+)
+
+// sslRedirect records hosts of ingress which are redirected to https
+type sslRedirect struct {
+	// redirect all hosts
+	force bool
+	// hosts in spec.tls, empty hosts in spec.tls match all hosts
+	tlsHosts []string
+	tlsAll   bool
+}
+
+type RedirectConfig struct {
+	moduleRule
+
+	// ingress -> ssl redirect
+	redirects map[string]*sslRedirect
+	// rule of route -> redirect of all requests
+	urlRedirects map[string]*Redirect
+}
+
+func NewRedirectConfig(version string) *RedirectConfig {
+	c := &RedirectConfig{
+		redirects:    make(map[string]*sslRedirect),
+		urlRedirects: make(map[string]*Redirect),
+	}
+	c.moduleRule = newModuleRule(ConfigNameRedirect, RedirectData, version, c)
+	return c
+}
+
+func newRedirectConfFile(version string) *mod_redirect.RedirectConfFile {
+	productRules := make(mod_redirect.ProductRulesFile)
+	productRules[DefaultProduct] = &mod_redirect.RuleFileList{}
+
+	return &mod_redirect.RedirectConfFile{
+		Version: &version,
+		Config:  &productRules,
+	}
+}
+
+// UpdateIngress updates redirect rules of ingress, routes should contain rules of the ingress
+func (c *RedirectConfig) UpdateIngress(ingress *netv1.Ingress, routes *RouteRuleCache) error {
+	return c.update(newIngressSource(ingress), nil, routes)
+}
+
+// UpdateRoute updates redirect rules of route rules, routes should contain rules of the route
+func (c *RedirectConfig) UpdateRoute(route *Route, routes *RouteRuleCache) error {
+	for i, rule := range route.Rules {
+		var urlRedirect *Redirect
+		if rule.Redirect != nil {
+			redirect := *rule.Redirect
+			if err := redirect.check(); err != nil {
+				return err
+			}
+			urlRedirect = &redirect
+		}
+
+		if err := c.update(route.ruleSource(i), urlRedirect, routes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *RedirectConfig) update(src *ruleSource, urlRedirect *Redirect, routes *RouteRuleCache) error {
+	ingressName := util.NamespacedName(src.namespace, src.name)
+
+	redirect, err := newSSLRedirect(src)
+	if err != nil {
+		return err
+	}
+
+	return c.updateIngress(ingressName, func() {
+		if redirect != nil {
+			c.redirects[ingressName] = redirect
+		}
+		if urlRedirect != nil {
+			c.urlRedirects[ingressName] = urlRedirect
+		}
+	}, routes)
+}
+
+func newSSLRedirect(src *ruleSource) (*sslRedirect, error) {
+	redirect, force, err := annotations.GetSSLRedirect(src.annotations)
+	if err != nil {
+		return nil, err
+	}
+
+	if force {
+		return &sslRedirect{force: true}, nil
+	}
+	if !redirect || len(src.tls) == 0 {
+		return nil, nil
+	}
+
+	r := &sslRedirect{}
+	for _, tls := range src.tls {
+		if len(tls.Hosts) == 0 {
+			r.tlsAll = true
+		}
+		r.tlsHosts = append(r.tlsHosts, tls.Hosts...)
+	}
+	return r, nil
+}
+
+// match returns true if requests of host should be redirected
+func (r *sslRedirect) match(host string) bool {
+	if r.force || r.tlsAll {
+		return true
+	}
+	return matchCertNames(r.tlsHosts, strings.ToLower(host))
+}
+
+func (c *RedirectConfig) hasRule(rule *httpRule) bool {
+	if _, ok := c.urlRedirects[rule.ingress]; ok {
+		return true
+	}
+	redirect, ok := c.redirects[rule.ingress]
+	return ok && redirect.match(rule.host)
+}
+
+func (c *RedirectConfig) removeIngress(ingress string) {
+	delete(c.redirects, ingress)
+	delete(c.urlRedirects, ingress)
+}
+
+func (c *RedirectConfig) buildConf(version string, rules []ingressRule) (moduleConf, error) {
+	redirectConfFile := newRedirectConfFile(version)
+	ruleList := (*redirectConfFile.Config)[DefaultProduct]
+	for _, rule := range rules {
+		if urlRedirect, ok := c.urlRedirects[rule.ingress]; ok {
+			*ruleList = append(*ruleList, newURLRedirectRuleFile(rule.condition, urlRedirect))
+			continue
+		}
+
+		condition := rule.condition + "&&!req_proto_secure()"
+		cmd := "SCHEME_SET"
+		status := SSLRedirectCode
+		*ruleList = append(*ruleList, mod_redirect.RedirectRuleFile{
+			Cond:    &condition,
+			Actions: &mod_redirect.ActionFileList{{Cmd: &cmd, Params: []string{"https"}}},
+			Status:  &status,
+		})
+	}
+
+	if err := mod_redirect.RedirectConfCheck(*redirectConfFile); err != nil {
+		return moduleConf{}, fmt.Errorf("fail to check generated redirect conf, err: %s", err)
+	}
+
+	return moduleConf{file: redirectConfFile, version: redirectConfFile.Version, rules: redirectConfFile.Config}, nil
+}
+
+// newURLRedirectRuleFile builds redirect rule for all requests of a route rule
+func newURLRedirectRuleFile(condition string, redirect *Redirect) mod_redirect.RedirectRuleFile {
+	cmd, param := "SCHEME_SET", redirect.Scheme
+	if len(redirect.URLPrefix) > 0 {
+		cmd, param = "URL_PREFIX_ADD", redirect.URLPrefix
+	}
+	status := redirect.StatusCode
+	return mod_redirect.RedirectRuleFile{
+		Cond:    &condition,
+		Actions: &mod_redirect.ActionFileList{{Cmd: &cmd, Params: []string{param}}},
+		Status:  &status,
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package configs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bfenetworks/bfe/bfe_modules/mod_redirect"
+	netv1 "k8s.io/api/networking/v1"
+
+	"github.com/bfenetworks/ingress-bfe/internal/bfeConfig/annotations"
+)
+
+func TestRedirectConfig_UpdateIngress(t *testing.T) {
+	setTestOptions(t)
+
+	now := time.Now()
+	s := NewServerDataConfig("init")
+	c := NewRedirectConfig("init")
+
+	// ssl-redirect without spec.tls is ignored
+	ingress1 := newTestIngress("ingress1", now, map[string]string{annotations.SSLRedirectAnnotation: "true"}, "foo.com", "/")
+	if err := updateTestIngress(t, s, c, ingress1); err != nil {
+		t.Fatalf("UpdateIngress() error: %s", err)
+	}
+	if rules := (*c.conf.file.(*mod_redirect.RedirectConfFile).Config)[DefaultProduct]; len(*rules) != 0 {
+		t.Errorf("redirect rules = %d, want 0", len(*rules))
+	}
+
+	ingress1.Spec.TLS = []netv1.IngressTLS{{Hosts: []string{"foo.com"}, SecretName: "secret"}}
+	if err := updateTestIngress(t, s, c, ingress1); err != nil {
+		t.Fatalf("UpdateIngress() error: %s", err)
+	}
+
+	// requests routed to more specific rule of other ingress are not redirected
+	ingress2 := newTestIngress("ingress2", now, nil, "foo.com", "/api")
+	if err := updateTestIngress(t, s, c, ingress2); err != nil {
+		t.Fatalf("UpdateIngress() error: %s", err)
+	}
+	rules := (*c.conf.file.(*mod_redirect.RedirectConfFile).Config)[DefaultProduct]
+	if len(*rules) != 1 {
+		t.Fatalf("redirect rules = %d, want 1", len(*rules))
+	}
+	want := `req_host_in("foo.com")&&req_path_element_prefix_in("/", false)&&` +
+		`!(req_host_in("foo.com")&&req_path_element_prefix_in("/api", false))&&!req_proto_secure()`
+	if rule := (*rules)[0]; *rule.Cond != want || *rule.Status != SSLRedirectCode {
+		t.Errorf("redirect rule = %s, %d, want %s", *rule.Cond, *rule.Status, want)
+	}
+
+	// force-ssl-redirect
+	version := *c.conf.version
+	ingress2.Annotations = map[string]string{annotations.ForceSSLRedirectAnnotation: "true"}
+	if err := updateTestIngress(t, s, c, ingress2); err != nil {
+		t.Fatalf("UpdateIngress() error: %s", err)
+	}
+	if rules := (*c.conf.file.(*mod_redirect.RedirectConfFile).Config)[DefaultProduct]; len(*rules) != 2 {
+		t.Errorf("redirect rules = %d, want 2", len(*rules))
+	}
+	if *c.conf.version == version {
+		t.Errorf("version should be changed")
+	}
+
+	// illegal annotation
+	ingress3 := newTestIngress("ingress3", now, map[string]string{annotations.SSLRedirectAnnotation: "yes"}, "bar.com", "/")
+	if err := updateTestIngress(t, s, c, ingress3); err == nil {
+		t.Errorf("UpdateIngress() should fail for illegal annotation")
+	}
+
+	deleteTestIngress(s, &c.moduleRule, "ingress1")
+	rules = (*c.conf.file.(*mod_redirect.RedirectConfFile).Config)[DefaultProduct]
+	if len(*rules) != 1 || *(*rules)[0].Cond != `req_host_in("foo.com")&&req_path_element_prefix_in("/api", false)&&!req_proto_secure()` {
+		t.Errorf("redirect rules = %v, want rule of ingress2", *rules)
+	}
+}
+
+func TestRedirectConfig_URLRedirect(t *testing.T) {
+	setTestOptions(t)
+
+	now := time.Now()
+	s := NewServerDataConfig("init")
+	c := NewRedirectConfig("init")
+
+	route := newTestRoute("route", now, "foo.com", "/", "/api", "/web")
+	route.Rules[0].Redirect = &Redirect{URLPrefix: "https://bar.com", StatusCode: 301}
+	route.Rules[1].Redirect = &Redirect{Scheme: "https"}
+	if err := s.UpdateRoute(route, nil, nil, nil); err != nil {
+		t.Fatalf("UpdateRoute() of route error: %s", err)
+	}
+	if err := c.UpdateRoute(route, s.RouteRules()); err != nil {
+		t.Fatalf("UpdateRoute() error: %s", err)
+	}
+	if route.Rules[1].Redirect.StatusCode != 0 {
+		t.Errorf("UpdateRoute() should not change redirect of route")
+	}
+
+	// rule without redirect is not redirected
+	rules := *(*c.conf.file.(*mod_redirect.RedirectConfFile).Config)[DefaultProduct]
+	if len(rules) != 2 {
+		t.Fatalf("redirect rules = %d, want 2", len(rules))
+	}
+	rule := rules[0]
+	if *rule.Cond != `req_host_in("foo.com")&&req_path_element_prefix_in("/api", false)` ||
+		*(*rule.Actions)[0].Cmd != "SCHEME_SET" || (*rule.Actions)[0].Params[0] != "https" || *rule.Status != 302 {
+		t.Errorf("redirect rule of /api = %s, %+v, %d", *rule.Cond, (*rule.Actions)[0], *rule.Status)
+	}
+	rule = rules[1]
+	if *rule.Cond != `req_host_in("foo.com")&&req_path_element_prefix_in("/", false)&&`+
+		`!(req_host_in("foo.com")&&req_path_element_prefix_in("/api", false))&&`+
+		`!(req_host_in("foo.com")&&req_path_element_prefix_in("/web", false))` ||
+		*(*rule.Actions)[0].Cmd != "URL_PREFIX_ADD" || (*rule.Actions)[0].Params[0] != "https://bar.com" || *rule.Status != 301 {
+		t.Errorf("redirect rule of / = %s, %+v, %d", *rule.Cond, (*rule.Actions)[0], *rule.Status)
+	}
+
+	deleteTestIngress(s, &c.moduleRule, route.RuleName(1))
+	if rules := *(*c.conf.file.(*mod_redirect.RedirectConfFile).Config)[DefaultProduct]; len(rules) != 1 {
+		t.Errorf("redirect rules = %d, want 1", len(rules))
+	}
+
+	// illegal redirect is rejected
+	route.Rules[1].Redirect = &Redirect{Scheme: "ftp"}
+	if err := c.UpdateRoute(route, s.RouteRules()); err == nil {
+		t.Errorf("UpdateRoute() should fail for illegal redirect")
+	}
+}
+
+func Test_overlapRule(t *testing.T) {
+	tests := []struct {
+		host1, path1 string
+		host2, path2 string
+		want         bool
+	}{
+		{"foo.com", "/*", "foo.com", "/api*", true},
+		{"foo.com", "/api", "foo.com", "/api*", true},
+		{"foo.com", "/api", "foo.com", "/web", false},
+		{"*.foo.com", "/*", "a.foo.com", "/*", true},
+		{"*.foo.com", "/*", "bar.com", "/*", false},
+		{"*", "/api*", "bar.com", "/*", true},
+	}
+	for _, tt := range tests {
+		rule1 := NewHttpRule("ingress1", tt.host1, tt.path1, nil, "svc", time.Now())
+		rule2 := NewHttpRule("ingress2", tt.host2, tt.path2, nil, "svc", time.Now())
+		if got := overlapRule(rule1, rule2); got != tt.want {
+			t.Errorf("overlapRule(%s%s, %s%s) = %v, want %v", tt.host1, tt.path1, tt.host2, tt.path2, got, tt.want)
+		}
+	}
+}
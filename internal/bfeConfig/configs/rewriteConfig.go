@@ -0,0 +1,177 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package configs
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bfenetworks/bfe/bfe_basic/action"
+	"github.com/bfenetworks/bfe/bfe_modules/mod_rewrite"
+	netv1 "k8s.io/api/networking/v1"
+
+	"github.com/bfenetworks/ingress-bfe/internal/bfeConfig/annotations"
+	"github.com/bfenetworks/ingress-bfe/internal/bfeConfig/util"
+)
+
+const (
+	ConfigNameRewrite = "mod_rewrite"
+)
+
+var (
+	RewriteData = "mod_rewrite/rewrite.data"
+)
+
+type RewriteConfig struct {
+	moduleRule
+
+	// ingress -> rewrite
+	rewrites map[string]*annotations.Rewrite
+}
+
+func NewRewriteConfig(version string) *RewriteConfig {
+	c := &RewriteConfig{
+		rewrites: make(map[string]*annotations.Rewrite),
+	}
+	c.moduleRule = newModuleRule(ConfigNameRewrite, RewriteData, version, c)
+	return c
+}
+
+func newRewriteConfFile(version string) *mod_rewrite.ReWriteConfFile {
+	productRules := make(mod_rewrite.ProductRulesFile)
+	productRules[DefaultProduct] = &mod_rewrite.RuleFileList{}
+
+	return &mod_rewrite.ReWriteConfFile{
+		Version: &version,
+		Config:  &productRules,
+	}
+}
+
+// UpdateIngress updates rewrite rules of ingress, routes should contain rules of the ingress
+func (c *RewriteConfig) UpdateIngress(ingress *netv1.Ingress, routes *RouteRuleCache) error {
+	ingressName := util.NamespacedName(ingress.Namespace, ingress.Name)
+
+	rewrite, err := annotations.GetRewrite(ingress.Annotations)
+	if err != nil {
+		return err
+	}
+
+	return c.updateIngress(ingressName, func() {
+		if rewrite != nil {
+			c.rewrites[ingressName] = rewrite
+		}
+	}, routes)
+}
+
+func (c *RewriteConfig) hasRule(rule *httpRule) bool {
+	_, ok := c.rewrites[rule.ingress]
+	return ok
+}
+
+func (c *RewriteConfig) removeIngress(ingress string) {
+	delete(c.rewrites, ingress)
+}
+
+func (c *RewriteConfig) buildConf(version string, rules []ingressRule) (moduleConf, error) {
+	rewriteConfFile := newRewriteConfFile(version)
+	ruleList := (*rewriteConfFile.Config)[DefaultProduct]
+	for _, rule := range rules {
+		ruleFiles, err := newRewriteRuleFiles(rule.condition, rule.path, c.rewrites[rule.ingress])
+		if err != nil {
+			return moduleConf{}, err
+		}
+		*ruleList = append(*ruleList, ruleFiles...)
+	}
+
+	if err := mod_rewrite.ReWriteConfCheck(*rewriteConfFile); err != nil {
+		return moduleConf{}, fmt.Errorf("fail to check generated rewrite conf, err: %s", err)
+	}
+
+	return moduleConf{file: rewriteConfFile, version: rewriteConfFile.Version, rules: rewriteConfFile.Config}, nil
+}
+
+// newRewriteRuleFiles builds rewrite rules for a route rule.
+// Rewrite is done after route, and rewritten request may match rules of other routes,
+// so rule checking stops at the first matched rule.
+func newRewriteRuleFiles(condition string, path string, rewrite *annotations.Rewrite) ([]mod_rewrite.ReWriteRuleFile, error) {
+	var hostActions, pathActions []action.Action
+	if len(rewrite.Host) > 0 {
+		hostActions = append(hostActions, action.Action{Cmd: action.ActionHostSet, Params: []string{rewrite.Host}})
+	}
+
+	if regexPath(path) && (rewrite.PrefixStrip || len(rewrite.PrefixReplace) > 0) {
+		return nil, fmt.Errorf("prefix rewrite is not supported for regex path[%s]", strings.TrimPrefix(path, regexPathPrefix))
+	}
+
+	pathCondition := condition
+	prefix := strings.TrimSuffix(path, "*")
+	if len(prefix) > 1 {
+		prefix = strings.TrimSuffix(prefix, "/")
+	}
+	switch {
+	case rewrite.PrefixStrip:
+		if prefix != "/" {
+			pathActions = append(pathActions, action.Action{Cmd: action.ActionPathPrefixTrim, Params: []string{prefix}})
+		}
+	case len(rewrite.PrefixReplace) > 0:
+		replace := rewrite.PrefixReplace
+		if !strings.HasSuffix(replace, "/") {
+			replace = replace + "/"
+		}
+		pathActions = append(pathActions,
+			action.Action{Cmd: action.ActionPathPrefixTrim, Params: []string{prefix}},
+			action.Action{Cmd: action.ActionPathPrefixAdd, Params: []string{replace}})
+	case rewrite.Regex != nil:
+		pathCondition = fmt.Sprintf("%s&&req_path_regmatch(`%s`)", condition, rewrite.Regex.Pattern)
+		pathActions = append(pathActions, action.Action{Cmd: action.ActionPathSet, Params: []string{rewrite.Regex.Replacement}})
+	}
+
+	var ruleFiles []mod_rewrite.ReWriteRuleFile
+	if len(pathActions) > 0 {
+		ruleFile, err := newRewriteRuleFile(pathCondition, append(hostActions, pathActions...))
+		if err != nil {
+			return nil, err
+		}
+		ruleFiles = append(ruleFiles, ruleFile)
+	}
+
+	// host is rewritten even if path not matches pattern
+	if len(hostActions) > 0 && (len(pathActions) == 0 || pathCondition != condition) {
+		ruleFile, err := newRewriteRuleFile(condition, hostActions)
+		if err != nil {
+			return nil, err
+		}
+		ruleFiles = append(ruleFiles, ruleFile)
+	}
+	return ruleFiles, nil
+}
+
+func newRewriteRuleFile(condition string, actions []action.Action) (mod_rewrite.ReWriteRuleFile, error) {
+	if err := checkCondition(condition); err != nil {
+		return mod_rewrite.ReWriteRuleFile{}, err
+	}
+	for _, ac := range actions {
+		cmd := ac.Cmd
+		if err := action.ActionFileCheck(action.ActionFile{Cmd: &cmd, Params: ac.Params}); err != nil {
+			return mod_rewrite.ReWriteRuleFile{}, fmt.Errorf("rewrite action is illegal, err: %s", err)
+		}
+	}
+
+	last := true
+	return mod_rewrite.ReWriteRuleFile{
+		Cond:    &condition,
+		Actions: actions,
+		Last:    &last,
+	}, nil
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package configs
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bfenetworks/bfe/bfe_basic/action"
+
+	"github.com/bfenetworks/ingress-bfe/internal/bfeConfig/annotations"
+)
+
+func Test_newRewriteRuleFiles(t *testing.T) {
+	cond := `req_host_in("foo.com")`
+	tests := []struct {
+		name    string
+		path    string
+		rewrite *annotations.Rewrite
+		want    [][]action.Action
+	}{
+		{
+			name:    "prefix strip",
+			path:    "/api/*",
+			rewrite: &annotations.Rewrite{PrefixStrip: true},
+			want: [][]action.Action{
+				{{Cmd: action.ActionPathPrefixTrim, Params: []string{"/api"}}},
+			},
+		},
+		{
+			name:    "prefix replace",
+			path:    "/api*",
+			rewrite: &annotations.Rewrite{PrefixReplace: "/v2"},
+			want: [][]action.Action{
+				{
+					{Cmd: action.ActionPathPrefixTrim, Params: []string{"/api"}},
+					{Cmd: action.ActionPathPrefixAdd, Params: []string{"/v2/"}},
+				},
+			},
+		},
+		{
+			name: "regex and host",
+			path: "/*",
+			rewrite: &annotations.Rewrite{
+				Regex: &annotations.RewriteRegex{Pattern: "^/old$", Replacement: "/new"},
+				Host:  "bar.com",
+			},
+			want: [][]action.Action{
+				{
+					{Cmd: action.ActionHostSet, Params: []string{"bar.com"}},
+					{Cmd: action.ActionPathSet, Params: []string{"/new"}},
+				},
+				{{Cmd: action.ActionHostSet, Params: []string{"bar.com"}}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ruleFiles, err := newRewriteRuleFiles(cond, tt.path, tt.rewrite)
+			if err != nil {
+				t.Fatalf("newRewriteRuleFiles() error: %s", err)
+			}
+			var got [][]action.Action
+			for _, ruleFile := range ruleFiles {
+				if !*ruleFile.Last {
+					t.Errorf("rewrite rule should be last")
+				}
+				got = append(got, ruleFile.Actions)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("newRewriteRuleFiles() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package configs
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	netv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Route is translated from Gateway API resources, e.g. HTTPRoute and Gateway.
+// Each rule of route is built like an ingress with a single path, and tls of route is built like spec.tls of ingress.
+// They are named after kind and name of the resource, ':' is not allowed in names of k8s objects,
+// so they never conflict with ingresses.
+type Route struct {
+	Kind      string
+	Namespace string
+	Name      string
+	// priority of conflict rules and tls hosts is decided by creation time of the resource
+	CreationTimestamp metav1.Time
+
+	Rules []RouteRule
+	TLS   []netv1.IngressTLS
+	// services not found, they have no subcluster, so requests to them are responded with 500
+	UnresolvedBackends []string
+}
+
+// RouteRule routes requests of hosts and path to backend of path
+type RouteRule struct {
+	// hosts of rule, "" matches any host
+	Hosts []string
+	Path  netv1.HTTPIngressPath
+	// ingress annotations supported by route rule, e.g. condition, header and balance
+	Annotations map[string]string
+	// redirect of all requests of rule, nil if requests are not redirected
+	Redirect *Redirect
+}
+
+// Redirect defines how all requests of route rule are redirected, one of Scheme and URLPrefix should be set
+type Redirect struct {
+	// redirect to url of request with scheme replaced
+	Scheme string
+	// redirect to url prefix followed by path and query of request
+	URLPrefix string
+	// status code of redirect response, 302 if not set
+	StatusCode int
+}
+
+// RouteConfigName returns name of route in configs, in format of "{kind}:{name}"
+func RouteConfigName(kind, name string) string {
+	return strings.ToLower(kind) + ":" + name
+}
+
+// ConfigName returns name of route in configs, tls of route is kept by this name
+func (r *Route) ConfigName() string {
+	return RouteConfigName(r.Kind, r.Name)
+}
+
+// RuleName returns name of the i-th rule of route in configs
+func (r *Route) RuleName(i int) string {
+	return fmt.Sprintf("%s:%d", r.ConfigName(), i)
+}
+
+// ruleSource returns source of the i-th rule of route
+func (r *Route) ruleSource(i int) *ruleSource {
+	rule := &r.Rules[i]
+	src := &ruleSource{
+		namespace:   r.Namespace,
+		name:        r.RuleName(i),
+		createTime:  r.CreationTimestamp.Time,
+		annotations: rule.Annotations,
+	}
+	for _, host := range rule.Hosts {
+		src.rules = append(src.rules, netv1.IngressRule{
+			Host: host,
+			IngressRuleValue: netv1.IngressRuleValue{
+				HTTP: &netv1.HTTPIngressRuleValue{
+					Paths: []netv1.HTTPIngressPath{*rule.Path.DeepCopy()},
+				},
+			},
+		})
+	}
+	return src
+}
+
+// tlsSource returns source of tls of route
+func (r *Route) tlsSource() *ruleSource {
+	return &ruleSource{
+		namespace:  r.Namespace,
+		name:       r.ConfigName(),
+		createTime: r.CreationTimestamp.Time,
+		tls:        r.TLS,
+	}
+}
+
+// unresolvedBackends returns set of services not found
+func (r *Route) unresolvedBackends() map[string]bool {
+	services := make(map[string]bool)
+	for _, name := range r.UnresolvedBackends {
+		services[name] = true
+	}
+	return services
+}
+
+// check checks redirect and sets default status code
+func (r *Redirect) check() error {
+	if r.StatusCode == 0 {
+		r.StatusCode = http.StatusFound
+	}
+
+	if len(r.Scheme) > 0 && r.Scheme != "http" && r.Scheme != "https" {
+		return fmt.Errorf("scheme of redirect should be http or https")
+	}
+	if len(r.URLPrefix) > 0 {
+		u, err := url.Parse(r.URLPrefix)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 ||
+			len(u.RawQuery) > 0 || len(u.Fragment) > 0 {
+			return fmt.Errorf("url prefix of redirect should be absolute url without query")
+		}
+		r.URLPrefix = strings.TrimSuffix(r.URLPrefix, "/")
+	}
+	if !validRedirectCode(r.StatusCode) {
+		return fmt.Errorf("status code of redirect should be one of 301, 302, 303, 307, 308")
+	}
+	if (len(r.Scheme) > 0) == (len(r.URLPrefix) > 0) {
+		return fmt.Errorf("one of scheme and url prefix of redirect should be set")
+	}
+	return nil
+}
+
+func validRedirectCode(code int) bool {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// ruleSource is what configs are built from, an ingress or a rule of route
+type ruleSource struct {
+	namespace   string
+	name        string
+	createTime  time.Time
+	annotations map[string]string
+	rules       []netv1.IngressRule
+	tls         []netv1.IngressTLS
+}
+
+func newIngressSource(ingress *netv1.Ingress) *ruleSource {
+	return &ruleSource{
+		namespace:   ingress.Namespace,
+		name:        ingress.Name,
+		createTime:  ingress.CreationTimestamp.Time,
+		annotations: ingress.Annotations,
+		rules:       ingress.Spec.Rules,
+		tls:         ingress.Spec.TLS,
+	}
+}
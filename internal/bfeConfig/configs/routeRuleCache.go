@@ -21,9 +21,13 @@ import (
 
 	"github.com/bfenetworks/bfe/bfe_config/bfe_route_conf/route_rule_conf"
 	"github.com/bfenetworks/ingress-bfe/internal/bfeConfig/annotations"
+	"github.com/bfenetworks/ingress-bfe/internal/bfeConfig/util"
 	"github.com/jwangsadinata/go-multimap/setmultimap"
 )
 
+// regexPathPrefix is prefix of path of rule, which path is a regular expression
+const regexPathPrefix = "~"
+
 type httpRule struct {
 	ingress     string
 	host        string
@@ -31,6 +35,19 @@ type httpRule struct {
 	annotations map[string]string
 	cluster     string
 	createTime  time.Time
+
+	// condition and priority of rules generated for canary, see canaryRules
+	cond     string
+	priority int
+	// set if cluster of rule is merged from primary and canary clusters by canary weight
+	canary *canaryBackend
+}
+
+// canaryBackend defines how requests of primary rule are split to canary by weight
+type canaryBackend struct {
+	primary string // cluster of primary rule
+	canary  string // cluster of canary rule
+	weight  int    // percentage of requests routed to canary
 }
 
 type HttpRouteRuleCache struct {
@@ -65,10 +82,23 @@ func NewHttpRule(ingress string, host string, path string, annots map[string]str
 	}
 }
 
+// getPriority returns priority of rule among rules of the same host and path
+func (r *httpRule) getPriority() int {
+	if r.priority > 0 {
+		return r.priority
+	}
+	return annotations.Priority(r.annotations)
+}
+
 func (c *RouteRuleCache) GetHttpRules() (basicRuleList []*httpRule, advancedRuleList []*httpRule) {
 	return c.httpRules.get()
 }
 
+// GetAllHttpRules returns all valid http rules, ordered by priority
+func (c *RouteRuleCache) GetAllHttpRules() []*httpRule {
+	return c.httpRules.all()
+}
+
 func (c *RouteRuleCache) PutHttpRule(rule *httpRule) error {
 	return c.httpRules.put(rule)
 }
@@ -83,14 +113,27 @@ func (c *RouteRuleCache) ContainsIngress(ingress string) bool {
 }
 
 func (c *HttpRouteRuleCache) get() (basicRuleList []*httpRule, advancedRuleList []*httpRule) {
-	for _, paths := range c.ruleMap {
+	var allRules []*httpRule
+	advanced := make(map[*httpRule]bool)
+	regexHosts := make(map[string]bool)
+	for host, paths := range c.ruleMap {
 		for _, rules := range paths {
+			rules = canaryRules(rules)
 			if len(rules) == 0 {
 				continue
 			}
+			allRules = append(allRules, rules...)
+
+			// regex path is not supported by basic rule, rules of regex path are
+			// matched only if no basic rule of exact or prefix path is matched
+			if regexPath(rules[0].path) {
+				regexHosts[host] = true
+				advancedRuleList = appendAdvancedRules(advancedRuleList, advanced, rules...)
+				continue
+			}
 
 			// add host+path rule to basic rule list
-			if len(rules) == 1 && annotations.Priority(rules[0].annotations) == annotations.PriorityBasic {
+			if len(rules) == 1 && rules[0].getPriority() == annotations.PriorityBasic {
 				basicRuleList = append(basicRuleList, rules[0])
 				continue
 			}
@@ -100,35 +143,52 @@ func (c *HttpRouteRuleCache) get() (basicRuleList []*httpRule, advancedRuleList
 			basicRuleList = append(basicRuleList, &newRule)
 
 			// add advanced rule
-			advancedRuleList = append(advancedRuleList, rules...)
+			advancedRuleList = appendAdvancedRules(advancedRuleList, advanced, rules...)
 		}
 	}
 
-	// host: exact match over wildcard match
-	// path: long path over short path
-	sort.SliceStable(advancedRuleList, func(i, j int) bool {
-		// compare host
-		if result := comparePriority(advancedRuleList[i].host, advancedRuleList[j].host, wildcardHost); result != 0 {
-			return result > 0
+	// only basic rules of the most specific host are looked up for a request. Requests of host with regex rules,
+	// which are not matched by its basic rules, are routed by advanced rules, including rules of less specific hosts.
+	for host := range regexHosts {
+		basicRuleList = append(basicRuleList, &httpRule{host: host, cluster: route_rule_conf.AdvancedMode})
+		for _, rule := range allRules {
+			if hostRank(rule.host) < hostRank(host) && overlapHost(rule.host, host) {
+				advancedRuleList = appendAdvancedRules(advancedRuleList, advanced, rule)
+			}
 		}
+	}
+
+	// advanced rules are matched in the same order as module rules, see higherPriority
+	sort.SliceStable(advancedRuleList, func(i, j int) bool {
+		return higherPriority(advancedRuleList[i], advancedRuleList[j])
+	})
 
-		// compare path
-		if result := comparePriority(advancedRuleList[i].path, advancedRuleList[j].path, wildcardPath); result != 0 {
-			return result > 0
+	return
+}
+
+// appendAdvancedRules appends rules not in advanced rule list
+func appendAdvancedRules(ruleList []*httpRule, added map[*httpRule]bool, rules ...*httpRule) []*httpRule {
+	for _, rule := range rules {
+		if !added[rule] {
+			added[rule] = true
+			ruleList = append(ruleList, rule)
 		}
+	}
+	return ruleList
+}
 
-		// compare annotation
-		priority1 := annotations.Priority(advancedRuleList[i].annotations)
-		priority2 := annotations.Priority(advancedRuleList[j].annotations)
-		if priority1 != priority2 {
-			return priority1 > priority2
+func (c *HttpRouteRuleCache) all() []*httpRule {
+	var ruleList []*httpRule
+	for _, paths := range c.ruleMap {
+		for _, rules := range paths {
+			ruleList = append(ruleList, canaryRules(rules)...)
 		}
+	}
 
-		// check createTime
-		return advancedRuleList[i].createTime.Before(advancedRuleList[j].createTime)
+	sort.SliceStable(ruleList, func(i, j int) bool {
+		return higherPriority(ruleList[i], ruleList[j])
 	})
-
-	return
+	return ruleList
 }
 
 func (c *HttpRouteRuleCache) delete(ingressName string) {
@@ -181,6 +241,73 @@ func (c *HttpRouteRuleCache) put(rule *httpRule) error {
 	return nil
 }
 
+// canaryRules replaces canary rule of the same host and path with rules generated from it.
+// Requests of canary header or cookie are routed by generated rules of higher priority than the primary rule,
+// which has no router annotation, and requests of primary rule are split to canary by weight.
+// Canary rule is ignored if primary rule not exist.
+func canaryRules(rules []*httpRule) []*httpRule {
+	var primary, canaryRule *httpRule
+	result := make([]*httpRule, 0, len(rules))
+	for _, rule := range rules {
+		// canary rules conflict with each other, so there is at most one
+		if annotations.IsCanary(rule.annotations) {
+			canaryRule = rule
+			continue
+		}
+		if annotations.Priority(rule.annotations) == annotations.PriorityBasic {
+			primary = rule
+		}
+		result = append(result, rule)
+	}
+	if primary == nil || canaryRule == nil {
+		return result
+	}
+
+	// annotations have been checked when ingress updated
+	canary, err := annotations.GetCanary(canaryRule.annotations)
+	if err != nil {
+		return result
+	}
+
+	if canary.Weight > 0 {
+		rule := *primary
+		rule.cluster = util.CanaryClusterName(primary.cluster)
+		rule.canary = &canaryBackend{primary: primary.cluster, canary: canaryRule.cluster, weight: canary.Weight}
+		for i := range result {
+			if result[i] == primary {
+				result[i] = &rule
+			}
+		}
+	}
+
+	// requests of header never and cookie never are routed to primary rule
+	headerCanary, headerPrimary := canary.HeaderConditions()
+	cookieCanary, cookiePrimary := canary.CookieConditions()
+	for _, r := range []struct {
+		rule     *httpRule
+		cond     string
+		priority int
+	}{
+		{canaryRule, headerCanary, annotations.PriorityCanaryHeader},
+		{primary, headerPrimary, annotations.PriorityCanaryHeader},
+		{canaryRule, cookieCanary, annotations.PriorityCanaryCookie},
+		{primary, cookiePrimary, annotations.PriorityCanaryCookie},
+	} {
+		if len(r.cond) > 0 {
+			result = append(result, newCanaryRule(r.rule, r.cond, r.priority))
+		}
+	}
+	return result
+}
+
+// newCanaryRule returns copy of rule with condition and priority
+func newCanaryRule(rule *httpRule, cond string, priority int) *httpRule {
+	newRule := *rule
+	newRule.cond = cond
+	newRule.priority = priority
+	return &newRule
+}
+
 func delRule(ruleList []*httpRule, ingress string) []*httpRule {
 	var result []*httpRule
 	for _, rule := range ruleList {
@@ -211,6 +338,29 @@ func comparePriority(str1, str2 string, wildcard func(string) bool) int {
 
 }
 
+// comparePath compares priority of paths: exact match over prefix match over regex match
+func comparePath(path1, path2 string) int {
+	if rank1, rank2 := pathRank(path1), pathRank(path2); rank1 != rank2 {
+		return rank1 - rank2
+	}
+	return comparePriority(path1, path2, wildcardPath)
+}
+
+func pathRank(path string) int {
+	if regexPath(path) {
+		return 0
+	}
+	if wildcardPath(path) {
+		return 1
+	}
+	return 2
+}
+
+// regexPath returns true if path is a regular expression, see newRegexPath
+func regexPath(path string) bool {
+	return strings.HasPrefix(path, regexPathPrefix)
+}
+
 func wildcardPath(path string) bool {
 	if len(path) > 0 && strings.HasSuffix(path, "*") {
 		return true
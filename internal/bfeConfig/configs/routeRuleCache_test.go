@@ -16,6 +16,10 @@ package configs
 import (
 	"testing"
 	"time"
+
+	"github.com/bfenetworks/bfe/bfe_config/bfe_route_conf/route_rule_conf"
+
+	"github.com/bfenetworks/ingress-bfe/internal/bfeConfig/annotations"
 )
 
 func Test_putBasic(t *testing.T) {
@@ -272,3 +276,130 @@ func Test_deleteRule(t *testing.T) {
 	}
 
 }
+
+func Test_canaryRules(t *testing.T) {
+	now := time.Now()
+	cache := NewRouteRuleCache()
+
+	// canary rule without primary rule is ignored
+	canaryAnnots := map[string]string{
+		annotations.CanaryAnnotation:         "true",
+		annotations.CanaryWeightAnnotation:   "20",
+		annotations.CanaryByHeaderAnnotation: "X-Canary",
+		annotations.CanaryByCookieAnnotation: "canary",
+	}
+	if err := cache.PutHttpRule(NewHttpRule("canary", "example.com", "/foo", canaryAnnots, "canary_svc", now)); err != nil {
+		t.Fatalf("PutHttpRule() error: %s", err)
+	}
+	if basic, advanced := cache.GetHttpRules(); len(basic) != 0 || len(advanced) != 0 {
+		t.Fatalf("GetHttpRules() = %d, %d rules, want none", len(basic), len(advanced))
+	}
+
+	// only one canary rule for the same host and path
+	if err := cache.PutHttpRule(NewHttpRule("canary2", "example.com", "/foo", canaryAnnots, "canary2_svc", now.Add(time.Second))); err == nil {
+		t.Errorf("PutHttpRule() should fail for another canary rule")
+	}
+
+	if err := cache.PutHttpRule(NewHttpRule("primary", "example.com", "/foo", nil, "primary_svc", now)); err != nil {
+		t.Fatalf("PutHttpRule() error: %s", err)
+	}
+	basic, advanced := cache.GetHttpRules()
+	if len(basic) != 1 || basic[0].cluster != route_rule_conf.AdvancedMode {
+		t.Fatalf("basic rules = %v, want advanced mode", basic)
+	}
+
+	want := []struct {
+		cluster string
+		cond    string
+	}{
+		{"canary_svc", `req_header_value_in("X-Canary", "always", false)`},
+		{"primary_svc", `req_header_value_in("X-Canary", "never", false)`},
+		{"canary_svc", `req_cookie_value_in("canary", "always", false)`},
+		{"primary_svc", `req_cookie_value_in("canary", "never", false)`},
+		{"primary_svc_canary", ""},
+	}
+	if len(advanced) != len(want) {
+		t.Fatalf("advanced rules = %d, want %d", len(advanced), len(want))
+	}
+	for i, rule := range advanced {
+		if rule.cluster != want[i].cluster || rule.cond != want[i].cond {
+			t.Errorf("advanced rule %d = %s %s, want %s %s", i, rule.cluster, rule.cond, want[i].cluster, want[i].cond)
+		}
+	}
+	if canary := advanced[4].canary; canary == nil || *canary != (canaryBackend{"primary_svc", "canary_svc", 20}) {
+		t.Errorf("canary of primary rule = %v", canary)
+	}
+
+	// primary rule is not changed without canary weight
+	cache.DeleteHttpRulesByIngress("canary")
+	delete(canaryAnnots, annotations.CanaryWeightAnnotation)
+	if err := cache.PutHttpRule(NewHttpRule("canary", "example.com", "/foo", canaryAnnots, "canary_svc", now)); err != nil {
+		t.Fatalf("PutHttpRule() error: %s", err)
+	}
+	for _, rule := range cache.GetAllHttpRules() {
+		if rule.canary != nil || rule.cluster == "primary_svc_canary" {
+			t.Errorf("primary rule should not be split without canary weight")
+		}
+	}
+}
+
+func Test_regexPathRules(t *testing.T) {
+	now := time.Now()
+	cache := NewRouteRuleCache()
+
+	regex1, _ := newRegexPath("/api/v[0-9]+/users")
+	regex2, _ := newRegexPath("^/api/.*")
+	for _, r := range []*httpRule{
+		NewHttpRule("ingress1", "example.com", regex2, nil, "svc1", now),
+		NewHttpRule("ingress2", "example.com", regex1, nil, "svc2", now),
+		NewHttpRule("ingress3", "example.com", regex1, map[string]string{annotations.HeaderAnnotation: "Key: value"}, "svc3", now),
+		NewHttpRule("ingress4", "example.com", "/api/v1*", map[string]string{annotations.HeaderAnnotation: "Key: value"}, "svc4", now),
+		NewHttpRule("ingress5", "example.com", "/api/v1/users", map[string]string{annotations.HeaderAnnotation: "Key: value"}, "svc5", now),
+		NewHttpRule("ingress6", "example.com", "/api/v1/users", nil, "svc6", now),
+	} {
+		if err := cache.PutHttpRule(r); err != nil {
+			t.Fatalf("PutHttpRule() error: %s", err)
+		}
+	}
+
+	// regex path of the same expression conflicts
+	if err := cache.PutHttpRule(NewHttpRule("ingress7", "example.com", regex1, nil, "svc7", now.Add(time.Second))); err == nil {
+		t.Errorf("PutHttpRule() should fail for conflict regex path")
+	}
+
+	basicList, advancedList := cache.GetHttpRules()
+
+	// regex path rules are not in basic rules
+	for _, r := range basicList {
+		if regexPath(r.path) {
+			t.Errorf("basic rule of regex path: %+v", r)
+		}
+	}
+	// basic rules of exact path, prefix path, and host with regex rules
+	if len(basicList) != 3 {
+		t.Errorf("basic rules = %d, want 3", len(basicList))
+	}
+
+	// exact match over prefix match over regex match, long regex over short regex
+	want := []string{"ingress5", "ingress6", "ingress4", "ingress3", "ingress2", "ingress1"}
+	if len(advancedList) != len(want) {
+		t.Fatalf("advanced rules = %d, want %d", len(advancedList), len(want))
+	}
+	for i, r := range advancedList {
+		if r.ingress != want[i] {
+			t.Errorf("advanced rule %d = %s, want %s", i, r.ingress, want[i])
+		}
+	}
+
+	// all rules are in the same order
+	for i, r := range cache.GetAllHttpRules() {
+		if r.ingress != want[i] {
+			t.Errorf("rule %d = %s, want %s", i, r.ingress, want[i])
+		}
+	}
+
+	cond, err := buildCondition(advancedList[4])
+	if err != nil || cond != "req_host_in(\"example.com\")&&req_path_regmatch(`^/api/v[0-9]+/users`)" {
+		t.Errorf("buildCondition() = %s, %v", cond, err)
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package configs
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	netv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// newTestRoute returns HTTPRoute with a rule for each path on host, rules are copied from paths of ingress
+func newTestRoute(name string, createTime time.Time, host string, paths ...string) *Route {
+	route := &Route{
+		Kind:              "HTTPRoute",
+		Namespace:         "default",
+		Name:              name,
+		CreationTimestamp: metav1.NewTime(createTime),
+	}
+	for _, path := range newTestIngress(name, createTime, nil, host, paths...).Spec.Rules[0].HTTP.Paths {
+		route.Rules = append(route.Rules, RouteRule{Hosts: []string{host}, Path: path})
+	}
+	return route
+}
+
+func TestRoute_ruleSource(t *testing.T) {
+	route := newTestRoute("route", time.Now(), "foo.com", "/", "/api")
+	route.Rules[1].Hosts = []string{"foo.com", "bar.com"}
+	route.Rules[1].Annotations = map[string]string{"k": "v"}
+
+	src := route.ruleSource(1)
+	if src.namespace != "default" || src.name != "httproute:route:1" || !src.createTime.Equal(route.CreationTimestamp.Time) ||
+		!reflect.DeepEqual(src.annotations, route.Rules[1].Annotations) {
+		t.Errorf("ruleSource() = %+v", src)
+	}
+
+	var hosts []string
+	for _, rule := range src.rules {
+		hosts = append(hosts, rule.Host)
+		if !reflect.DeepEqual(rule.HTTP.Paths, []netv1.HTTPIngressPath{route.Rules[1].Path}) {
+			t.Errorf("paths of host %s = %+v", rule.Host, rule.HTTP.Paths)
+		}
+	}
+	if !reflect.DeepEqual(hosts, []string{"foo.com", "bar.com"}) {
+		t.Errorf("hosts of rules = %v", hosts)
+	}
+
+	if src := route.tlsSource(); src.name != "httproute:route" || len(src.rules) != 0 {
+		t.Errorf("tlsSource() = %+v", src)
+	}
+}
+
+func TestRedirect_check(t *testing.T) {
+	tests := []struct {
+		name     string
+		redirect Redirect
+		want     Redirect
+		wantErr  bool
+	}{
+		{
+			name:     "scheme",
+			redirect: Redirect{Scheme: "https"},
+			want:     Redirect{Scheme: "https", StatusCode: 302},
+		},
+		{
+			name:     "url prefix",
+			redirect: Redirect{URLPrefix: "https://example.org:8443/v2/", StatusCode: 308},
+			want:     Redirect{URLPrefix: "https://example.org:8443/v2", StatusCode: 308},
+		},
+		{
+			name:     "illegal scheme",
+			redirect: Redirect{Scheme: "ftp"},
+			wantErr:  true,
+		},
+		{
+			name:     "relative url prefix",
+			redirect: Redirect{URLPrefix: "/v2"},
+			wantErr:  true,
+		},
+		{
+			name:     "illegal status code",
+			redirect: Redirect{Scheme: "https", StatusCode: 200},
+			wantErr:  true,
+		},
+		{
+			name:     "scheme with url prefix",
+			redirect: Redirect{Scheme: "https", URLPrefix: "https://example.org"},
+			wantErr:  true,
+		},
+		{
+			name:     "neither scheme nor url prefix",
+			redirect: Redirect{StatusCode: 301},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.redirect.check()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(tt.redirect, tt.want) {
+				t.Errorf("check() = %+v, want %+v", tt.redirect, tt.want)
+			}
+		})
+	}
+}
@@ -15,8 +15,13 @@ package configs
 
 import (
 	"fmt"
+	"regexp"
+	"sort"
 	"strings"
+	"time"
 
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	netv1 "k8s.io/api/networking/v1"
 
 	"github.com/bfenetworks/bfe/bfe_config/bfe_cluster_conf/cluster_conf"
@@ -45,6 +50,11 @@ type ServerDataConfig struct {
 
 	routeRuleCache *RouteRuleCache
 
+	// ingress -> cluster -> health check
+	ingress2Checks map[string]map[string]*cluster_conf.BackendCheck
+	// ingress -> conf of clusters, except health check
+	ingress2Cluster map[string]*cluster_conf.ClusterConf
+
 	hostTableConf  *host_rule_conf.HostTableConf
 	routeTableFile *route_rule_conf.RouteTableFile
 	bfeClusterConf *cluster_conf.BfeClusterConf
@@ -52,10 +62,12 @@ type ServerDataConfig struct {
 
 func NewServerDataConfig(version string) *ServerDataConfig {
 	return &ServerDataConfig{
-		routeRuleCache: NewRouteRuleCache(),
-		hostTableConf:  newHostTableConf(version),
-		routeTableFile: newRouteTableConfFile(version),
-		bfeClusterConf: newBfeClusterConf(version),
+		routeRuleCache:  NewRouteRuleCache(),
+		ingress2Checks:  make(map[string]map[string]*cluster_conf.BackendCheck),
+		ingress2Cluster: make(map[string]*cluster_conf.ClusterConf),
+		hostTableConf:   newHostTableConf(version),
+		routeTableFile:  newRouteTableConfFile(version),
+		bfeClusterConf:  newBfeClusterConf(version),
 	}
 }
 
@@ -106,26 +118,67 @@ func newBfeClusterConf(version string) *cluster_conf.BfeClusterConf {
 	return &clusterConf
 }
 
-func (c *ServerDataConfig) UpdateIngress(ingress *netv1.Ingress) error {
-	if len(ingress.Spec.Rules) == 0 {
+// UpdateIngress updates route rules of ingress, probes are readiness probes of backend services keyed by checked port
+func (c *ServerDataConfig) UpdateIngress(ingress *netv1.Ingress, services map[string]*corev1.Service, endpoints map[string][]*discoveryv1.EndpointSlice, probes map[string]map[int32]*corev1.Probe) error {
+	return c.update(newIngressSource(ingress), services, endpoints, probes)
+}
+
+// UpdateRoute updates route rules of route, each rule of route is updated like an ingress named by RuleName.
+// Rules updated are not removed on error, route should be deleted as a whole.
+func (c *ServerDataConfig) UpdateRoute(route *Route, services map[string]*corev1.Service, endpoints map[string][]*discoveryv1.EndpointSlice, probes map[string]map[int32]*corev1.Probe) error {
+	for i := range route.Rules {
+		if err := c.update(route.ruleSource(i), services, endpoints, probes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *ServerDataConfig) update(src *ruleSource, services map[string]*corev1.Service, endpoints map[string][]*discoveryv1.EndpointSlice, probes map[string]map[int32]*corev1.Probe) error {
+	if len(src.rules) == 0 {
 		return nil
 	}
 
-	ingressName := util.NamespacedName(ingress.Namespace, ingress.Name)
+	ingressName := util.NamespacedName(src.namespace, src.name)
+
+	check, err := annotations.GetHealthCheck(src.annotations)
+	if err != nil {
+		return err
+	}
+	hash, err := annotations.GetHash(src.annotations)
+	if err != nil {
+		return err
+	}
+	backend, err := annotations.GetBackend(src.annotations)
+	if err != nil {
+		return err
+	}
+	if _, err := annotations.GetCanary(src.annotations); err != nil {
+		return err
+	}
+	if _, err := annotations.GetRouteExpression(src.annotations); err != nil {
+		return err
+	}
 
 	//delete existing ingress
 	if c.routeRuleCache.ContainsIngress(ingressName) {
 		c.routeRuleCache.DeleteHttpRulesByIngress(ingressName)
 	}
+	c.ingress2Checks[ingressName] = make(map[string]*cluster_conf.BackendCheck)
+	c.ingress2Cluster[ingressName] = newClusterConf(hash, backend)
 
-	if err := c.updateCache(ingress); err != nil {
+	if err := c.updateCache(src, check, services, endpoints, probes); err != nil {
 		// delete rules which have been inserted
 		c.routeRuleCache.DeleteHttpRulesByIngress(ingressName)
+		delete(c.ingress2Checks, ingressName)
+		delete(c.ingress2Cluster, ingressName)
 		return err
 	}
 
 	if err := c.updateRouteTable(); err != nil {
 		c.routeRuleCache.DeleteHttpRulesByIngress(ingressName)
+		delete(c.ingress2Checks, ingressName)
+		delete(c.ingress2Cluster, ingressName)
 		return err
 	}
 
@@ -142,26 +195,37 @@ func (c *ServerDataConfig) DeleteIngress(namespace, name string) {
 	}
 
 	c.routeRuleCache.DeleteHttpRulesByIngress(ingressName)
+	delete(c.ingress2Checks, ingressName)
+	delete(c.ingress2Cluster, ingressName)
 	c.updateRouteTable()
 	c.updateBfeClusterConf()
 }
 
-func (c *ServerDataConfig) updateCache(ingress *netv1.Ingress) error {
-	for _, rule := range ingress.Spec.Rules {
+// RouteRules returns cache of valid route rules, which module configs are built from
+func (c *ServerDataConfig) RouteRules() *RouteRuleCache {
+	return c.routeRuleCache
+}
+
+func (c *ServerDataConfig) updateCache(src *ruleSource, check *annotations.HealthCheck, services map[string]*corev1.Service, endpoints map[string][]*discoveryv1.EndpointSlice, probes map[string]map[int32]*corev1.Probe) error {
+	for _, rule := range src.rules {
 		if rule.HTTP == nil || len(rule.HTTP.Paths) == 0 {
 			continue
 		}
 
 		for _, p := range rule.HTTP.Paths {
-			if err := c.addRule(ingress, rule.Host, p); err != nil {
+			if err := c.addRule(src, rule.Host, p); err != nil {
 				return err
 			}
+
+			ingressName := util.NamespacedName(src.namespace, src.name)
+			clusterName := util.ClusterName(ingressName, p.Backend.Service)
+			c.ingress2Checks[ingressName][clusterName] = newCheckConf(check, backendProbe(src, p.Backend.Service, services, endpoints, probes))
 		}
 	}
 	return nil
 }
 
-func (c *ServerDataConfig) addRule(ingress *netv1.Ingress, host string, httpPath netv1.HTTPIngressPath) error {
+func (c *ServerDataConfig) addRule(src *ruleSource, host string, httpPath netv1.HTTPIngressPath) error {
 	if err := checkHost(host); err != nil {
 		return err
 	}
@@ -170,27 +234,38 @@ func (c *ServerDataConfig) addRule(ingress *netv1.Ingress, host string, httpPath
 		host = "*"
 	}
 
-	path := httpPath.Path
-	if err := checkPath(path); err != nil {
+	useRegex, err := annotations.GetUseRegex(src.annotations)
+	if err != nil {
 		return err
 	}
 
-	if httpPath.PathType == nil || *httpPath.PathType == netv1.PathTypePrefix || *httpPath.PathType == netv1.PathTypeImplementationSpecific {
-		path = path + "*"
+	path := httpPath.Path
+	if useRegex && (httpPath.PathType == nil || *httpPath.PathType == netv1.PathTypeImplementationSpecific) {
+		if path, err = newRegexPath(path); err != nil {
+			return err
+		}
+	} else {
+		if err := checkPath(path); err != nil {
+			return err
+		}
+
+		if httpPath.PathType == nil || *httpPath.PathType == netv1.PathTypePrefix || *httpPath.PathType == netv1.PathTypeImplementationSpecific {
+			path = path + "*"
+		}
 	}
 
-	ingressName := util.NamespacedName(ingress.Namespace, ingress.Name)
+	ingressName := util.NamespacedName(src.namespace, src.name)
 	clusterName := util.ClusterName(ingressName, httpPath.Backend.Service)
 
 	// put rule into cache
-	err := c.routeRuleCache.PutHttpRule(
+	err = c.routeRuleCache.PutHttpRule(
 		NewHttpRule(
 			ingressName,
 			host,
 			path,
-			ingress.Annotations,
+			src.annotations,
 			clusterName,
-			ingress.CreationTimestamp.Time,
+			src.createTime,
 		),
 	)
 
@@ -216,6 +291,23 @@ func checkPath(path string) error {
 	return nil
 }
 
+// newRegexPath checks regex path and returns path of rule, regex is anchored at the beginning of path
+func newRegexPath(path string) (string, error) {
+	if len(path) == 0 {
+		return "", fmt.Errorf("path is not set")
+	}
+	if strings.Contains(path, "`") {
+		return "", fmt.Errorf("regex path[%s] is illegal, should not contain '`'", path)
+	}
+	if !strings.HasPrefix(path, "^") {
+		path = "^" + path
+	}
+	if _, err := regexp.Compile(path); err != nil {
+		return "", fmt.Errorf("regex path[%s] is illegal: %s", path, err)
+	}
+	return regexPathPrefix + path, nil
+}
+
 func (c *ServerDataConfig) updateRouteTable() error {
 	basicRules, advancedRules := c.routeRuleCache.GetHttpRules()
 
@@ -238,7 +330,7 @@ func (c *ServerDataConfig) updateRouteTable() error {
 	}
 
 	for _, rule := range advancedRules {
-		condition, err := buildCondition(rule.host, rule.path, rule.annotations)
+		condition, err := buildCondition(rule)
 		if err != nil {
 			return err
 		}
@@ -278,32 +370,27 @@ func (c *ServerDataConfig) updateBfeClusterConf() {
 		if r.cluster == route_rule_conf.AdvancedMode {
 			continue
 		}
-		(*clusterConf.Config)[r.cluster] = cluster_conf.ClusterConf{
-			CheckConf: newCheckConf(),
-			GslbBasic: newGslbBasicConf(),
-		}
+		(*clusterConf.Config)[r.cluster] = c.clusterConf(r)
 	}
 
 	for _, r := range advancedRules {
-		(*clusterConf.Config)[r.cluster] = cluster_conf.ClusterConf{
-			CheckConf: newCheckConf(),
-			GslbBasic: newGslbBasicConf(),
-		}
+		(*clusterConf.Config)[r.cluster] = c.clusterConf(r)
 	}
 	if len(option.Opts.Ingress.DefaultBackend) > 0 && (len(basicRules) > 0 || len(advancedRules) > 0) {
 		(*clusterConf.Config)[util.DefaultClusterName()] = cluster_conf.ClusterConf{
-			CheckConf: newCheckConf(),
-			GslbBasic: newGslbBasicConf(),
+			CheckConf: newCheckConf(nil, nil),
+			GslbBasic: newGslbBasicConf(nil, nil),
 		}
 	}
 
 	c.bfeClusterConf = clusterConf
 }
 
-func buildCondition(host string, path string, annots map[string]string) (string, error) {
+// buildCondition builds condition of advanced route rule
+func buildCondition(rule *httpRule) (string, error) {
 	var statement []string
 
-	primitive, err := hostPrimitive(host)
+	primitive, err := hostPrimitive(rule.host)
 	if err != nil {
 		return "", err
 	}
@@ -311,7 +398,7 @@ func buildCondition(host string, path string, annots map[string]string) (string,
 		statement = append(statement, primitive)
 	}
 
-	primitive, err = pathPrimitive(path)
+	primitive, err = pathPrimitive(rule.path)
 	if err != nil {
 		return "", err
 	}
@@ -319,7 +406,7 @@ func buildCondition(host string, path string, annots map[string]string) (string,
 		statement = append(statement, primitive)
 	}
 
-	primitive, err = annotations.GetRouteExpression(annots)
+	primitive, err = annotations.GetRouteExpression(rule.annotations)
 	if err != nil {
 		return "", err
 	}
@@ -327,30 +414,256 @@ func buildCondition(host string, path string, annots map[string]string) (string,
 		statement = append(statement, primitive)
 	}
 
+	// condition of rule generated for canary
+	if len(rule.cond) > 0 {
+		statement = append(statement, rule.cond)
+	}
+
 	return strings.Join(statement, "&&"), nil
 }
 
-func newCheckConf() *cluster_conf.BackendCheck {
-	schem := "tcp"
-	return &cluster_conf.BackendCheck{
+// clusterConf returns conf of cluster of rule
+func (c *ServerDataConfig) clusterConf(rule *httpRule) cluster_conf.ClusterConf {
+	var conf cluster_conf.ClusterConf
+	if ingressConf, ok := c.ingress2Cluster[rule.ingress]; ok {
+		conf = *ingressConf
+	} else {
+		conf.GslbBasic = newGslbBasicConf(nil, nil)
+	}
+	conf.CheckConf = c.clusterCheckConf(rule)
+	return conf
+}
+
+// clusterCheckConf returns health check of cluster of rule
+func (c *ServerDataConfig) clusterCheckConf(rule *httpRule) *cluster_conf.BackendCheck {
+	cluster := rule.cluster
+	if rule.canary != nil {
+		cluster = rule.canary.primary
+	}
+	if check, ok := c.ingress2Checks[rule.ingress][cluster]; ok {
+		return check
+	}
+	return newCheckConf(nil, nil)
+}
+
+// backendProbe returns readiness probe of backend service, which checks target port of backend.
+// For services in balance annotation, the first service with such readiness probe is used.
+func backendProbe(src *ruleSource, backend *netv1.IngressServiceBackend, services map[string]*corev1.Service,
+	endpoints map[string][]*discoveryv1.EndpointSlice, probes map[string]map[int32]*corev1.Probe) *corev1.Probe {
+	if backend == nil || len(probes) == 0 {
+		return nil
+	}
+
+	names := []string{backend.Name}
+	balance, _ := annotations.GetBalance(src.annotations)
+	if weights, ok := balance[backend.Name]; ok {
+		names = make([]string, 0, len(weights))
+		for name := range weights {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	for _, name := range names {
+		service := util.NamespacedName(src.namespace, name)
+		svc, ok := services[service]
+		if !ok {
+			continue
+		}
+		if probe, ok := probes[service][targetPortNumber(backend.Port, svc, endpoints[service])]; ok {
+			return probe
+		}
+	}
+	return nil
+}
+
+// targetPortNumber returns number of target port of backend in endpoints, 0 if not found
+func targetPortNumber(port netv1.ServiceBackendPort, svc *corev1.Service, slices []*discoveryv1.EndpointSlice) int32 {
+	targetPort := getTargetPort(port, svc)
+	for _, slice := range slices {
+		for _, endpointPort := range slice.Ports {
+			if matchPort(targetPort, endpointPort) {
+				return *endpointPort.Port
+			}
+		}
+	}
+	return 0
+}
+
+// newCheckConf builds health check of cluster.
+// Fields in health check annotations take precedence over those from readiness probe of backend pods,
+// tcp check is used if neither exists.
+func newCheckConf(check *annotations.HealthCheck, probe *corev1.Probe) *cluster_conf.BackendCheck {
+	checkConf := newProbeCheckConf(probe)
+
+	if check != nil {
+		if check.Scheme != nil {
+			checkConf.Schem = check.Scheme
+		}
+		if check.URI != nil {
+			checkConf.Uri = check.URI
+		}
+		if check.Host != nil {
+			checkConf.Host = check.Host
+		}
+		if check.StatusCode != nil {
+			checkConf.StatusCode = check.StatusCode
+		}
+		if check.Interval != nil {
+			checkConf.CheckInterval = durationMs(check.Interval)
+		}
+		if check.Timeout != nil {
+			checkConf.CheckTimeout = durationMs(check.Timeout)
+		}
+		if check.FailureThreshold != nil {
+			checkConf.FailNum = check.FailureThreshold
+		}
+		if check.SuccessThreshold != nil {
+			checkConf.SuccNum = check.SuccessThreshold
+		}
+	}
+
+	if *checkConf.Schem == annotations.HealthCheckSchemeHTTP {
+		if checkConf.Uri == nil {
+			uri := "/"
+			checkConf.Uri = &uri
+		}
+		if checkConf.StatusCode == nil {
+			// 2xx or 3xx, same as http probe of kubernetes
+			statusCode := 0b00110
+			checkConf.StatusCode = &statusCode
+		}
+	}
+	return checkConf
+}
+
+// newProbeCheckConf converts readiness probe to health check, https probe is checked by tcp.
+// Probe should check target port of backend, as health check of bfe is sent to port of backend instances.
+func newProbeCheckConf(probe *corev1.Probe) *cluster_conf.BackendCheck {
+	schem := annotations.HealthCheckSchemeTCP
+	checkConf := &cluster_conf.BackendCheck{
 		Schem: &schem,
 	}
+	if probe == nil || (probe.HTTPGet == nil && probe.TCPSocket == nil) {
+		return checkConf
+	}
+
+	if probe.HTTPGet != nil && probe.HTTPGet.Scheme != corev1.URISchemeHTTPS {
+		schem = annotations.HealthCheckSchemeHTTP
+		if len(probe.HTTPGet.Path) > 0 {
+			uri := probe.HTTPGet.Path
+			checkConf.Uri = &uri
+		}
+		for _, header := range probe.HTTPGet.HTTPHeaders {
+			if strings.EqualFold(header.Name, "Host") {
+				host := header.Value
+				checkConf.Host = &host
+			}
+		}
+	}
+
+	if probe.PeriodSeconds > 0 {
+		interval := int(probe.PeriodSeconds) * 1000
+		checkConf.CheckInterval = &interval
+	}
+	if probe.TimeoutSeconds > 0 {
+		timeout := int(probe.TimeoutSeconds) * 1000
+		checkConf.CheckTimeout = &timeout
+	}
+	if probe.FailureThreshold > 0 {
+		failNum := int(probe.FailureThreshold)
+		checkConf.FailNum = &failNum
+	}
+	if probe.SuccessThreshold > 0 {
+		succNum := int(probe.SuccessThreshold)
+		checkConf.SuccNum = &succNum
+	}
+	return checkConf
+}
+
+// newClusterConf builds conf of clusters of ingress from annotations, except health check
+func newClusterConf(hash *annotations.Hash, backend *annotations.Backend) *cluster_conf.ClusterConf {
+	conf := &cluster_conf.ClusterConf{
+		GslbBasic: newGslbBasicConf(hash, backend),
+	}
+	if backend == nil {
+		return conf
+	}
+
+	conf.BackendConf = &cluster_conf.BackendBasic{
+		TimeoutConnSrv:        durationMs(backend.ConnectTimeout),
+		TimeoutResponseHeader: durationMs(backend.ReadTimeout),
+		MaxIdleConnsPerHost:   backend.MaxIdleConns,
+	}
+	conf.ClusterBasic = &cluster_conf.ClusterBasicConf{
+		TimeoutWriteClient: durationMs(backend.WriteTimeout),
+		ReqWriteBufferSize: backend.RequestBufferSize,
+		ReqFlushInterval:   durationMs(backend.RequestFlushInterval),
+	}
+	return conf
 }
 
-func newGslbBasicConf() *cluster_conf.GslbBasicConf {
+// newGslbBasicConf builds gslb conf of cluster, default hash conf is used if hash is nil
+func newGslbBasicConf(hash *annotations.Hash, backend *annotations.Backend) *cluster_conf.GslbBasicConf {
+	gslbConf := &cluster_conf.GslbBasicConf{}
+	if backend != nil {
+		gslbConf.RetryMax = backend.Retries
+		gslbConf.CrossRetry = backend.CrossRetries
+	}
+	// subclusters in other zones are used by cross retry
+	if gslbConf.CrossRetry == nil && option.Opts.Ingress.ZoneAwareRouting {
+		crossRetry := 1
+		gslbConf.CrossRetry = &crossRetry
+	}
+
+	if hash != nil {
+		gslbConf.HashConf = newHashConf(hash)
+		return gslbConf
+	}
+
 	defaultHashStrategy := cluster_conf.ClientIdOnly
 	defaultHashHeader := "bfe-non-existence"
 	defaultSessionSticky := false
-	gslbConf := &cluster_conf.GslbBasicConf{
-		HashConf: &cluster_conf.HashConf{
-			HashStrategy:  &defaultHashStrategy,
-			HashHeader:    &defaultHashHeader,
-			SessionSticky: &defaultSessionSticky,
-		},
+	gslbConf.HashConf = &cluster_conf.HashConf{
+		HashStrategy:  &defaultHashStrategy,
+		HashHeader:    &defaultHashHeader,
+		SessionSticky: &defaultSessionSticky,
 	}
 	return gslbConf
 }
 
+// newHashConf builds hash conf from annotation.
+// Requests without hash header or cookie are hashed by client ip.
+func newHashConf(hash *annotations.Hash) *cluster_conf.HashConf {
+	strategy := cluster_conf.ClientIpOnly
+	var header *string
+	switch hash.Strategy {
+	case annotations.HashStrategyHeader:
+		strategy = cluster_conf.ClientIdPreferred
+		header = &hash.Key
+	case annotations.HashStrategyCookie:
+		strategy = cluster_conf.ClientIdPreferred
+		cookie := "Cookie:" + hash.Key
+		header = &cookie
+	}
+
+	sticky := hash.SessionSticky
+	return &cluster_conf.HashConf{
+		HashStrategy:  &strategy,
+		HashHeader:    header,
+		SessionSticky: &sticky,
+	}
+}
+
+// durationMs converts duration to milliseconds, nil if duration is nil
+func durationMs(d *time.Duration) *int {
+	if d == nil {
+		return nil
+	}
+	ms := int(d.Milliseconds())
+	return &ms
+}
+
 // hostPrimitive builds host primitive in condition
 func hostPrimitive(host string) (string, error) {
 	if len(host) == 0 || host == "*" {
@@ -371,6 +684,9 @@ func pathPrimitive(path string) (string, error) {
 	if len(path) == 0 || path == "*" {
 		return "", nil // no restriction
 	}
+	if regexPath(path) {
+		return fmt.Sprintf("req_path_regmatch(`%s`)", strings.TrimPrefix(path, regexPathPrefix)), nil
+	}
 	if path[len(path)-1] == '*' {
 		return fmt.Sprintf(`req_path_element_prefix_in("%s", false)`, path[:len(path)-1]), nil
 	} else {
@@ -0,0 +1,280 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package configs
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bfenetworks/bfe/bfe_config/bfe_cluster_conf/cluster_conf"
+	"github.com/bfenetworks/bfe/bfe_config/bfe_route_conf/route_rule_conf"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	netv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"github.com/bfenetworks/ingress-bfe/internal/bfeConfig/annotations"
+	"github.com/bfenetworks/ingress-bfe/internal/bfeConfig/util"
+)
+
+func Test_newCheckConf(t *testing.T) {
+	// tcp check by default
+	if checkConf := newCheckConf(nil, nil); *checkConf.Schem != "tcp" {
+		t.Errorf("default check schem = %s, want tcp", *checkConf.Schem)
+	}
+
+	probe := &corev1.Probe{
+		Handler: corev1.Handler{
+			HTTPGet: &corev1.HTTPGetAction{
+				Path:        "/ready",
+				Port:        intstr.FromInt(8080),
+				HTTPHeaders: []corev1.HTTPHeader{{Name: "host", Value: "foo.com"}},
+			},
+		},
+		PeriodSeconds:    5,
+		FailureThreshold: 3,
+	}
+	checkConf := newCheckConf(nil, probe)
+	if *checkConf.Schem != "http" || *checkConf.Uri != "/ready" || *checkConf.Host != "foo.com" ||
+		*checkConf.StatusCode != 0b00110 || *checkConf.CheckInterval != 5000 || *checkConf.FailNum != 3 {
+		t.Errorf("check from probe = %+v", checkConf)
+	}
+
+	// annotation takes precedence over probe
+	uri := "/healthz"
+	interval := time.Second
+	checkConf = newCheckConf(&annotations.HealthCheck{URI: &uri, Interval: &interval}, probe)
+	if *checkConf.Uri != "/healthz" || *checkConf.CheckInterval != 1000 || *checkConf.Host != "foo.com" {
+		t.Errorf("check from annotation = %+v", checkConf)
+	}
+
+	// https probe is checked by tcp
+	probe.HTTPGet.Scheme = corev1.URISchemeHTTPS
+	if checkConf := newCheckConf(nil, probe); *checkConf.Schem != "tcp" {
+		t.Errorf("check schem of https probe = %s, want tcp", *checkConf.Schem)
+	}
+}
+
+func Test_backendProbe(t *testing.T) {
+	// service port 80 targets 8080 of pods, port 9090 targets 9090 of pods, probe checks 9090
+	svc := &corev1.Service{Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{
+		{Name: "http", Port: 80, TargetPort: intstr.FromInt(8080)},
+		{Name: "metrics", Port: 9090, TargetPort: intstr.FromInt(9090)},
+	}}}
+	services := map[string]*corev1.Service{"default/svc": svc}
+	endpoints := map[string][]*discoveryv1.EndpointSlice{"default/svc": {
+		newTestSlice(discoveryv1.AddressTypeIPv4, "http", 8080),
+		newTestSlice(discoveryv1.AddressTypeIPv4, "metrics", 9090),
+	}}
+	probe := &corev1.Probe{Handler: corev1.Handler{HTTPGet: &corev1.HTTPGetAction{Path: "/ready", Port: intstr.FromInt(9090)}}}
+	probes := map[string]map[int32]*corev1.Probe{"default/svc": {9090: probe}}
+
+	tests := []struct {
+		name    string
+		annots  map[string]string
+		backend *netv1.IngressServiceBackend
+		want    *corev1.Probe
+	}{
+		{
+			name:    "probe checks other port",
+			backend: &netv1.IngressServiceBackend{Name: "svc", Port: netv1.ServiceBackendPort{Number: 80}},
+		},
+		{
+			name:    "probe checks target port",
+			backend: &netv1.IngressServiceBackend{Name: "svc", Port: netv1.ServiceBackendPort{Number: 9090}},
+			want:    probe,
+		},
+		{
+			name:    "probe checks target port of named port",
+			backend: &netv1.IngressServiceBackend{Name: "svc", Port: netv1.ServiceBackendPort{Name: "metrics"}},
+			want:    probe,
+		},
+		{
+			name:    "service in balance annotation",
+			annots:  map[string]string{annotations.WeightAnnotation: `{"weighted": {"svc": 1, "other": 1}}`},
+			backend: &netv1.IngressServiceBackend{Name: "weighted", Port: netv1.ServiceBackendPort{Number: 9090}},
+			want:    probe,
+		},
+		{
+			name:    "service not found",
+			backend: &netv1.IngressServiceBackend{Name: "other", Port: netv1.ServiceBackendPort{Number: 9090}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ingress := newTestIngress("ingress", time.Now(), tt.annots, "foo.com", "/")
+			if got := backendProbe(newIngressSource(ingress), tt.backend, services, endpoints, probes); got != tt.want {
+				t.Errorf("backendProbe() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServerDataConfig_ClusterConf(t *testing.T) {
+	setTestOptions(t)
+
+	s := NewServerDataConfig("init")
+	ingress1 := newTestIngress("ingress1", time.Now(), map[string]string{
+		annotations.HashStrategyAnnotation:  "cookie",
+		annotations.HashKeyAnnotation:       "SESSIONID",
+		annotations.SessionStickyAnnotation: "true",
+		annotations.ReadTimeoutAnnotation:   "5m",
+		annotations.RetriesAnnotation:       "0",
+	}, "foo.com", "/")
+	ingress2 := newTestIngress("ingress2", time.Now(), nil, "bar.com", "/")
+	for _, ingress := range []*netv1.Ingress{ingress1, ingress2} {
+		if err := s.UpdateIngress(ingress, nil, nil, nil); err != nil {
+			t.Fatalf("UpdateIngress() error: %s", err)
+		}
+	}
+
+	clusters := *s.bfeClusterConf.Config
+	conf := clusters[util.ClusterName("default/ingress1", ingress1.Spec.Rules[0].HTTP.Paths[0].Backend.Service)]
+	hashConf := conf.GslbBasic.HashConf
+	if *hashConf.HashStrategy != cluster_conf.ClientIdPreferred || *hashConf.HashHeader != "Cookie:SESSIONID" || !*hashConf.SessionSticky {
+		t.Errorf("hash conf of ingress1 = %+v", hashConf)
+	}
+	if *conf.BackendConf.TimeoutResponseHeader != 300000 || conf.BackendConf.TimeoutConnSrv != nil ||
+		*conf.GslbBasic.RetryMax != 0 || conf.CheckConf == nil {
+		t.Errorf("cluster conf of ingress1 = %+v", conf)
+	}
+
+	conf = clusters[util.ClusterName("default/ingress2", ingress2.Spec.Rules[0].HTTP.Paths[0].Backend.Service)]
+	hashConf = conf.GslbBasic.HashConf
+	if *hashConf.HashStrategy != cluster_conf.ClientIdOnly || *hashConf.SessionSticky || conf.BackendConf != nil {
+		t.Errorf("cluster conf of ingress2 = %+v", conf)
+	}
+	for name, conf := range clusters {
+		if err := cluster_conf.ClusterConfCheck(&conf); err != nil {
+			t.Errorf("ClusterConfCheck() of %s error: %s", name, err)
+		}
+	}
+
+	// illegal annotation
+	ingress2.Annotations = map[string]string{annotations.HashStrategyAnnotation: "header"}
+	if err := s.UpdateIngress(ingress2, nil, nil, nil); err == nil {
+		t.Errorf("UpdateIngress() should fail for illegal annotation")
+	}
+}
+
+func TestServerDataConfig_RouteCondition(t *testing.T) {
+	setTestOptions(t)
+
+	s := NewServerDataConfig("init")
+	ingress := newTestIngress("ingress1", time.Now(), map[string]string{
+		annotations.ConditionAnnotation: `req_query_value_in("a", "b", false) || req_method_in("POST")`,
+		annotations.HeaderAnnotation:    "Key: value",
+	}, "foo.com", "/")
+	if err := s.UpdateIngress(ingress, nil, nil, nil); err != nil {
+		t.Fatalf("UpdateIngress() error: %s", err)
+	}
+
+	rules := (*s.routeTableFile.ProductRule)[DefaultProduct]
+	if len(rules) != 1 || !strings.HasSuffix(*rules[0].Cond,
+		`&&req_header_value_in("Key", "value", false)&&(req_query_value_in("a", "b", false) || req_method_in("POST"))`) {
+		t.Errorf("advanced rules = %+v", rules)
+	}
+
+	// illegal condition is rejected, and existing rules are kept
+	ingress2 := newTestIngress("ingress2", time.Now(), map[string]string{
+		annotations.ConditionAnnotation: `req_query_value_in("a")`,
+	}, "bar.com", "/")
+	if err := s.UpdateIngress(ingress2, nil, nil, nil); err == nil {
+		t.Errorf("UpdateIngress() should fail for illegal condition")
+	}
+	if s.routeRuleCache.ContainsIngress("default/ingress2") || len((*s.routeTableFile.ProductRule)[DefaultProduct]) != 1 {
+		t.Errorf("rules of ingress2 should not be added")
+	}
+}
+
+func TestServerDataConfig_RegexPath(t *testing.T) {
+	setTestOptions(t)
+
+	s := NewServerDataConfig("init")
+	ingress := newTestIngress("ingress1", time.Now(), map[string]string{annotations.UseRegexAnnotation: "true"},
+		"foo.com", "/api/v[0-9]+/users", "/static")
+	implementationSpecific := netv1.PathTypeImplementationSpecific
+	ingress.Spec.Rules[0].HTTP.Paths[0].PathType = &implementationSpecific
+	if err := s.UpdateIngress(ingress, nil, nil, nil); err != nil {
+		t.Fatalf("UpdateIngress() error: %s", err)
+	}
+
+	// path of type Prefix is not regex, other paths of host are routed by advanced rules
+	basicRules := (*s.routeTableFile.BasicRule)[DefaultProduct]
+	if len(basicRules) != 2 || basicRules[0].Path[0] != "/static*" || *basicRules[1].ClusterName != route_rule_conf.AdvancedMode {
+		t.Errorf("basic rules = %+v", basicRules)
+	}
+	advancedRules := (*s.routeTableFile.ProductRule)[DefaultProduct]
+	if len(advancedRules) != 1 || *advancedRules[0].Cond != "req_host_in(\"foo.com\")&&req_path_regmatch(`^/api/v[0-9]+/users`)" {
+		t.Errorf("advanced rules = %+v", advancedRules)
+	}
+
+	// path of type ImplementationSpecific is prefix without use-regex
+	ingress2 := newTestIngress("ingress2", time.Now(), nil, "bar.com", "/api/v[0-9]+")
+	ingress2.Spec.Rules[0].HTTP.Paths[0].PathType = &implementationSpecific
+	if err := s.UpdateIngress(ingress2, nil, nil, nil); err != nil {
+		t.Fatalf("UpdateIngress() error: %s", err)
+	}
+	if !s.routeRuleCache.ContainsIngress("default/ingress2") || len((*s.routeTableFile.ProductRule)[DefaultProduct]) != 1 {
+		t.Errorf("path of ingress2 should be prefix")
+	}
+
+	// illegal regex
+	ingress.Spec.Rules[0].HTTP.Paths[0].Path = "/api/v[0-9+"
+	if err := s.UpdateIngress(ingress, nil, nil, nil); err == nil {
+		t.Errorf("UpdateIngress() should fail for illegal regex path")
+	}
+}
+
+func TestServerDataConfig_RegexOnlyHost(t *testing.T) {
+	setTestOptions(t)
+
+	s := NewServerDataConfig("init")
+	ingress1 := newTestIngress("ingress1", time.Now(), map[string]string{annotations.UseRegexAnnotation: "true"},
+		"foo.com", "/api/v[0-9]+")
+	implementationSpecific := netv1.PathTypeImplementationSpecific
+	ingress1.Spec.Rules[0].HTTP.Paths[0].PathType = &implementationSpecific
+	ingress2 := newTestIngress("ingress2", time.Now(), nil, "", "/")
+	for _, ingress := range []*netv1.Ingress{ingress1, ingress2} {
+		if err := s.UpdateIngress(ingress, nil, nil, nil); err != nil {
+			t.Fatalf("UpdateIngress() error: %s", err)
+		}
+	}
+
+	conf, err := route_rule_conf.Convert(s.routeTableFile)
+	if err != nil {
+		t.Fatalf("Convert() error: %s", err)
+	}
+	tree := conf.BasicRuleTree[DefaultProduct]
+	advancedRules := (*s.routeTableFile.ProductRule)[DefaultProduct]
+
+	// requests of foo.com are routed by advanced rules, instead of basic rule without host
+	if cluster, _ := tree.Get("foo.com", "/api/v1"); cluster != route_rule_conf.AdvancedMode {
+		t.Errorf("cluster of foo.com = %s, want %s", cluster, route_rule_conf.AdvancedMode)
+	}
+	if cluster, _ := tree.Get("bar.com", "/api/v1"); cluster != *advancedRules[1].ClusterName {
+		t.Errorf("cluster of bar.com = %s, want %s", cluster, *advancedRules[1].ClusterName)
+	}
+
+	// regex rule is matched before rule without host, the same as module rules
+	if len(advancedRules) != 2 || *advancedRules[0].Cond != "req_host_in(\"foo.com\")&&req_path_regmatch(`^/api/v[0-9]+`)" ||
+		*advancedRules[1].Cond != "req_path_element_prefix_in(\"/\", false)" {
+		t.Errorf("advanced rules = %+v", advancedRules)
+	}
+	rules := s.RouteRules().GetAllHttpRules()
+	if len(rules) != 2 || rules[0].ingress != "default/ingress1" {
+		t.Errorf("rules = %+v", rules)
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package configs
+
+import (
+	"fmt"
+
+	"github.com/bfenetworks/bfe/bfe_modules/mod_trust_clientip"
+
+	"github.com/bfenetworks/ingress-bfe/internal/bfeConfig/util"
+	"github.com/bfenetworks/ingress-bfe/internal/option"
+)
+
+const (
+	ConfigNameTrustIP = "mod_trust_clientip"
+
+	// source name of trusted proxies in trust_client_ip.data
+	TrustedProxySource = "trusted-proxies"
+)
+
+var (
+	TrustIPData = "mod_trust_clientip/trust_client_ip.data"
+)
+
+// TrustIPConfig builds trusted proxies of bfe from command line arguments.
+// Client ip of requests from trusted proxies is read from X-Real-Ip or X-Forwarded-For header,
+// and no proxy is trusted by default, which replaces default trusted ip of bfe.
+type TrustIPConfig struct {
+	trustIPVersion string
+
+	trustIPConfFile *mod_trust_clientip.TrustIPConfFile
+}
+
+func NewTrustIPConfig(version string) *TrustIPConfig {
+	scopes := mod_trust_clientip.AddrScopeFileList{}
+	for _, ipNet := range option.Opts.Ingress.TrustedProxyList {
+		start, end := util.CIDRRange(ipNet)
+		begin, last := start.String(), end.String()
+		scopes = append(scopes, mod_trust_clientip.AddrScopeFile{Begin: &begin, End: &last})
+	}
+
+	config := make(mod_trust_clientip.SrcScopeMapFile)
+	config[TrustedProxySource] = &scopes
+
+	return &TrustIPConfig{
+		trustIPConfFile: &mod_trust_clientip.TrustIPConfFile{
+			Version: &version,
+			Config:  &config,
+		},
+	}
+}
+
+func (c *TrustIPConfig) Reload() error {
+	if *c.trustIPConfFile.Version == c.trustIPVersion {
+		return nil
+	}
+
+	if err := mod_trust_clientip.TrustIPConfCheck(c.trustIPConfFile); err != nil {
+		return fmt.Errorf("fail to check generated trust ip conf, err: %s", err)
+	}
+	if err := util.DumpBfeConf(TrustIPData, c.trustIPConfFile); err != nil {
+		return fmt.Errorf("dump trust_client_ip.data error: %v", err)
+	}
+	if err := util.ReloadBfe(ConfigNameTrustIP); err != nil {
+		return err
+	}
+	c.trustIPVersion = *c.trustIPConfFile.Version
+
+	return nil
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configs
+
+import (
+	"testing"
+
+	"github.com/bfenetworks/ingress-bfe/internal/option"
+)
+
+func TestNewTrustIPConfig(t *testing.T) {
+	tests := []struct {
+		name           string
+		trustedProxies string
+		want           []string
+	}{
+		{
+			name:           "no trusted proxy",
+			trustedProxies: "",
+			want:           nil,
+		},
+		{
+			name:           "trusted proxies",
+			trustedProxies: "10.0.0.0/8, 2001:db8::1/128",
+			want:           []string{"10.0.0.0-10.255.255.255", "2001:db8::1-2001:db8::1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := option.NewOptions()
+			opts.Ingress.BfeBinary = ""
+			opts.Ingress.TrustedProxies = tt.trustedProxies
+			if err := option.SetOptions(opts); err != nil {
+				t.Fatal(err)
+			}
+
+			c := NewTrustIPConfig("init")
+			scopes := (*c.trustIPConfFile.Config)[TrustedProxySource]
+			var got []string
+			for _, scope := range *scopes {
+				got = append(got, *scope.Begin+"-"+*scope.End)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("trusted ip = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("trusted ip = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+
+	opts := option.NewOptions()
+	opts.Ingress.TrustedProxies = "10.0.0.1"
+	if err := option.SetOptions(opts); err == nil {
+		t.Errorf("SetOptions() should fail for illegal trusted proxies")
+	}
+}
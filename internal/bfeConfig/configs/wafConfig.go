@@ -0,0 +1,257 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package configs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/bfenetworks/bfe/bfe_modules/mod_waf"
+	"github.com/bfenetworks/bfe/bfe_modules/mod_waf/waf_rule"
+	corev1 "k8s.io/api/core/v1"
+	netv1 "k8s.io/api/networking/v1"
+
+	"github.com/bfenetworks/ingress-bfe/internal/bfeConfig/annotations"
+	"github.com/bfenetworks/ingress-bfe/internal/bfeConfig/util"
+)
+
+const (
+	ConfigNameWaf = "mod_waf"
+
+	// key of waf rules in configmap of waf policy
+	ConfigMapWafRules = "rules"
+)
+
+var (
+	WafData = "mod_waf/waf_rule.data"
+
+	// rules used if waf policy is not set, or its configmap is deleted or illegal
+	WafDefaultRules = []string{waf_rule.RuleBashCmd}
+)
+
+// WafRuleFile is the same as waf rule of mod_waf, which is not exported
+type WafRuleFile struct {
+	Cond       string
+	BlockRules []string
+	CheckRules []string
+}
+
+type WafRuleFileList []*WafRuleFile
+
+type WafProductRulesFile map[string]*WafRuleFileList
+
+type WafConfFile struct {
+	Version *string
+	Config  *WafProductRulesFile
+}
+
+type WafConfig struct {
+	moduleRule
+
+	// ingress -> waf
+	wafs map[string]*annotations.Waf
+	// configmap -> waf rules, for configmaps referred by wafs
+	policies map[string][]string
+}
+
+func NewWafConfig(version string) *WafConfig {
+	c := &WafConfig{
+		wafs:     make(map[string]*annotations.Waf),
+		policies: make(map[string][]string),
+	}
+	c.moduleRule = newModuleRule(ConfigNameWaf, WafData, version, c)
+	return c
+}
+
+func newWafConfFile(version string) *WafConfFile {
+	productRules := make(WafProductRulesFile)
+	productRules[DefaultProduct] = &WafRuleFileList{}
+
+	return &WafConfFile{
+		Version: &version,
+		Config:  &productRules,
+	}
+}
+
+// UpdateIngress updates waf rules of ingress, routes should contain rules of the ingress.
+// ConfigMap of waf policy should be in configMaps.
+func (c *WafConfig) UpdateIngress(ingress *netv1.Ingress, configMaps []*corev1.ConfigMap, routes *RouteRuleCache) error {
+	ingressName := util.NamespacedName(ingress.Namespace, ingress.Name)
+
+	waf, err := annotations.GetWaf(ingress.Annotations)
+	if err != nil {
+		return err
+	}
+
+	var rules []string
+	if waf != nil && len(waf.Policy) > 0 {
+		policyName := util.NamespacedName(ingress.Namespace, waf.Policy)
+		configMap := findConfigMap(configMaps, ingress.Namespace, waf.Policy)
+		if configMap == nil {
+			return fmt.Errorf("configmap [%s] of waf policy not found", policyName)
+		}
+		if rules, err = parseWafRules(configMap.Data[ConfigMapWafRules]); err != nil {
+			return fmt.Errorf("configmap [%s] of waf policy is illegal: %s", policyName, err)
+		}
+	}
+
+	return c.updateIngress(ingressName, func() {
+		if waf != nil {
+			c.wafs[ingressName] = waf
+			if len(waf.Policy) > 0 {
+				c.policies[util.NamespacedName(ingress.Namespace, waf.Policy)] = rules
+			}
+		}
+	}, routes)
+}
+
+// UpdateConfigMap updates waf rules of policy, if configmap is referred by ingresses.
+// Default rules are used if configmap is illegal.
+func (c *WafConfig) UpdateConfigMap(configMap *corev1.ConfigMap, routes *RouteRuleCache) error {
+	name := util.NamespacedName(configMap.Namespace, configMap.Name)
+	if _, ok := c.policies[name]; !ok {
+		return nil
+	}
+
+	rules, err := parseWafRules(configMap.Data[ConfigMapWafRules])
+	if err != nil {
+		c.policies[name] = WafDefaultRules
+		c.updateConf(routes)
+		return fmt.Errorf("configmap [%s] of waf policy is illegal: %s", name, err)
+	}
+	c.policies[name] = rules
+	return c.updateConf(routes)
+}
+
+// DeleteConfigMap resets waf rules of policy to default rules, if configmap is referred by ingresses
+func (c *WafConfig) DeleteConfigMap(namespace, name string, routes *RouteRuleCache) {
+	configMapName := util.NamespacedName(namespace, name)
+	if _, ok := c.policies[configMapName]; !ok {
+		return
+	}
+	c.policies[configMapName] = WafDefaultRules
+	c.updateConf(routes)
+}
+
+// cleanPolicies removes policies not referred by any ingress
+func (c *WafConfig) cleanPolicies() {
+	referred := make(map[string]bool)
+	for ingress, waf := range c.wafs {
+		if len(waf.Policy) == 0 {
+			continue
+		}
+		namespace, _ := util.SplitNamespacedName(ingress)
+		referred[util.NamespacedName(namespace, waf.Policy)] = true
+	}
+	for policy := range c.policies {
+		if !referred[policy] {
+			delete(c.policies, policy)
+		}
+	}
+}
+
+func (c *WafConfig) hasRule(rule *httpRule) bool {
+	_, ok := c.wafs[rule.ingress]
+	return ok
+}
+
+func (c *WafConfig) removeIngress(ingress string) {
+	delete(c.wafs, ingress)
+}
+
+func (c *WafConfig) buildConf(version string, rules []ingressRule) (moduleConf, error) {
+	// policies of removed ingresses may be no longer referred
+	c.cleanPolicies()
+
+	wafConfFile := newWafConfFile(version)
+	ruleList := (*wafConfFile.Config)[DefaultProduct]
+	for _, rule := range rules {
+		waf := c.wafs[rule.ingress]
+		wafRules := WafDefaultRules
+		if len(waf.Policy) > 0 {
+			namespace, _ := util.SplitNamespacedName(rule.ingress)
+			wafRules = c.policies[util.NamespacedName(namespace, waf.Policy)]
+		}
+
+		// only the first matched rule is used by mod_waf
+		wafRule := &WafRuleFile{Cond: rule.condition, BlockRules: []string{}, CheckRules: []string{}}
+		if waf.Mode == annotations.WafModeBlock {
+			wafRule.BlockRules = wafRules
+		} else {
+			wafRule.CheckRules = wafRules
+		}
+		*ruleList = append(*ruleList, wafRule)
+	}
+
+	if err := checkWafConf(wafConfFile); err != nil {
+		return moduleConf{}, fmt.Errorf("fail to check generated waf conf, err: %s", err)
+	}
+
+	return moduleConf{file: wafConfFile, version: wafConfFile.Version, rules: wafConfFile.Config}, nil
+}
+
+// checkWafConf checks conf with mod_waf, which only checks conf loaded from file
+func checkWafConf(conf *WafConfFile) error {
+	data, err := json.Marshal(conf)
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile("", "waf_rule")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = mod_waf.ProductWafRuleConfLoad(f.Name())
+	return err
+}
+
+// parseWafRules checks waf rules separated by ","
+func parseWafRules(data string) ([]string, error) {
+	var rules []string
+	for _, rule := range strings.Split(data, ",") {
+		rule = strings.TrimSpace(rule)
+		if len(rule) == 0 {
+			continue
+		}
+		if !waf_rule.IsValidRule(rule) {
+			return nil, fmt.Errorf("waf rule [%s] is not supported", rule)
+		}
+		rules = append(rules, rule)
+	}
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("no waf rule found in key %s", ConfigMapWafRules)
+	}
+	return rules, nil
+}
+
+func findConfigMap(configMaps []*corev1.ConfigMap, namespace, name string) *corev1.ConfigMap {
+	for _, configMap := range configMaps {
+		if configMap.Namespace == namespace && configMap.Name == name {
+			return configMap
+		}
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package configs
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/bfenetworks/ingress-bfe/internal/bfeConfig/annotations"
+)
+
+func newTestWafPolicy(name, rules string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+		Data:       map[string]string{ConfigMapWafRules: rules},
+	}
+}
+
+func TestWafConfig_UpdateIngress(t *testing.T) {
+	setTestOptions(t)
+
+	s := NewServerDataConfig("init")
+	c := NewWafConfig("init")
+
+	ingress1 := newTestIngress("ingress1", time.Now(), map[string]string{
+		annotations.WafAnnotation: "block",
+	}, "foo.com", "/")
+	ingress2 := newTestIngress("ingress2", time.Now(), map[string]string{
+		annotations.WafAnnotation:       "detect",
+		annotations.WafPolicyAnnotation: "waf-policy",
+	}, "bar.com", "/")
+	policy := newTestWafPolicy("waf-policy", "RuleBashCmd")
+
+	updateTestRoutes(t, s, ingress1, ingress2)
+	if err := c.UpdateIngress(ingress1, nil, s.RouteRules()); err != nil {
+		t.Fatalf("UpdateIngress() error: %s", err)
+	}
+
+	// configmap not found
+	if err := c.UpdateIngress(ingress2, nil, s.RouteRules()); err == nil {
+		t.Fatalf("UpdateIngress() should fail without configmap")
+	}
+	if err := c.UpdateIngress(ingress2, []*corev1.ConfigMap{policy}, s.RouteRules()); err != nil {
+		t.Fatalf("UpdateIngress() error: %s", err)
+	}
+
+	rules := *(*c.conf.file.(*WafConfFile).Config)[DefaultProduct]
+	if len(rules) != 2 {
+		t.Fatalf("waf rules = %d, want 2", len(rules))
+	}
+	for _, rule := range rules {
+		switch rule.Cond {
+		case `req_host_in("foo.com")&&req_path_element_prefix_in("/", false)`:
+			if !reflect.DeepEqual(rule.BlockRules, WafDefaultRules) || len(rule.CheckRules) != 0 {
+				t.Errorf("waf rule of block mode = %+v", rule)
+			}
+		case `req_host_in("bar.com")&&req_path_element_prefix_in("/", false)`:
+			if !reflect.DeepEqual(rule.CheckRules, []string{"RuleBashCmd"}) || len(rule.BlockRules) != 0 {
+				t.Errorf("waf rule of detect mode = %+v", rule)
+			}
+		default:
+			t.Errorf("unexpected waf rule = %+v", rule)
+		}
+	}
+
+	// illegal policy falls back to default rules
+	if err := c.UpdateConfigMap(newTestWafPolicy("waf-policy", "RuleUnknown"), s.RouteRules()); err == nil {
+		t.Errorf("UpdateConfigMap() should fail for illegal rules")
+	}
+	if !reflect.DeepEqual(c.policies["default/waf-policy"], WafDefaultRules) {
+		t.Errorf("policy = %v, want default rules", c.policies["default/waf-policy"])
+	}
+	if err := c.UpdateConfigMap(policy, s.RouteRules()); err != nil {
+		t.Errorf("UpdateConfigMap() error: %s", err)
+	}
+	c.DeleteConfigMap("default", "waf-policy", s.RouteRules())
+	if !reflect.DeepEqual(c.policies["default/waf-policy"], WafDefaultRules) {
+		t.Errorf("policy = %v, want default rules", c.policies["default/waf-policy"])
+	}
+
+	deleteTestIngress(s, &c.moduleRule, "ingress1")
+	deleteTestIngress(s, &c.moduleRule, "ingress2")
+	if len(*(*c.conf.file.(*WafConfFile).Config)[DefaultProduct]) != 0 || len(c.policies) != 0 {
+		t.Errorf("waf rules and policies should be deleted with ingress")
+	}
+}
+
+func TestWafConfig_checkConf(t *testing.T) {
+	setTestOptions(t)
+
+	s := NewServerDataConfig("init")
+	c := NewWafConfig("init")
+
+	// rule without block rules or check rules is rejected by mod_waf
+	defaultRules := WafDefaultRules
+	WafDefaultRules = []string{}
+	defer func() { WafDefaultRules = defaultRules }()
+
+	ingress := newTestIngress("ingress1", time.Now(), map[string]string{annotations.WafAnnotation: "block"}, "foo.com", "/")
+	updateTestRoutes(t, s, ingress)
+	if err := c.UpdateIngress(ingress, nil, s.RouteRules()); err == nil {
+		t.Fatalf("UpdateIngress() should fail for rules rejected by mod_waf")
+	}
+	if _, ok := c.wafs["default/ingress1"]; ok || len(*(*c.conf.file.(*WafConfFile).Config)[DefaultProduct]) != 0 {
+		t.Errorf("waf rules of ingress should be rolled back")
+	}
+
+	WafDefaultRules = defaultRules
+	if err := c.UpdateIngress(ingress, nil, s.RouteRules()); err != nil {
+		t.Errorf("UpdateIngress() error: %s", err)
+	}
+}
+
+func Test_parseWafRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "rules",
+			data: " RuleBashCmd, ",
+			want: []string{"RuleBashCmd"},
+		},
+		{
+			name:    "empty",
+			data:    "",
+			wantErr: true,
+		},
+		{
+			name:    "unknown rule",
+			data:    "RuleBashCmd,RuleSqlInjection",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseWafRules(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseWafRules() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseWafRules() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
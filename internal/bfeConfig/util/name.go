@@ -37,6 +37,11 @@ func DefaultClusterName() string {
 	return fmt.Sprintf("%s_%s_%d", ingress, option.Opts.Ingress.DefaultBackend, 0)
 }
 
+// CanaryClusterName returns name of cluster merged from cluster of primary rule and cluster of canary rule
+func CanaryClusterName(cluster string) string {
+	return cluster + "_canary"
+}
+
 func ParsePort(clusterName string) netv1.ServiceBackendPort {
 	port := netv1.ServiceBackendPort{}
 	index := strings.LastIndexByte(clusterName, '_')
@@ -67,3 +72,21 @@ func SplitNamespacedName(namespacedName string) (namespace, name string) {
 	}
 	return names[0], names[1]
 }
+
+// SubClusterName returns name of sub-cluster for endpoints of service in zone.
+// Endpoints not split by zone are in sub-cluster named by service.
+func SubClusterName(service, zone string) string {
+	if len(zone) == 0 {
+		return service
+	}
+	return fmt.Sprintf("%s/%s", service, zone)
+}
+
+// SubClusterService returns service of sub-cluster, which is named by SubClusterName
+func SubClusterService(subCluster string) string {
+	names := strings.SplitN(subCluster, "/", 3)
+	if len(names) < 2 {
+		return subCluster
+	}
+	return names[0] + "/" + names[1]
+}
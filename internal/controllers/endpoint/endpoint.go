@@ -0,0 +1,256 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package endpoint
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/bfenetworks/ingress-bfe/internal/bfeConfig/annotations"
+	"github.com/bfenetworks/ingress-bfe/internal/option"
+)
+
+var (
+	// useEndpointSlice is true if EndpointSlice of discovery.k8s.io/v1 is served by cluster
+	useEndpointSlice = false
+)
+
+// Setup checks whether EndpointSlice is served by cluster, Endpoints is used if not
+func Setup(client discovery.DiscoveryInterface) error {
+	useEndpointSlice = false
+
+	resources, err := client.ServerResourcesForGroupVersion(discoveryv1.SchemeGroupVersion.String())
+	if apierrors.IsNotFound(err) {
+		// group version not served
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to get resources of %s: %s", discoveryv1.SchemeGroupVersion, err)
+	}
+
+	for _, resource := range resources.APIResources {
+		if resource.Name == "endpointslices" {
+			useEndpointSlice = true
+			return nil
+		}
+	}
+	return nil
+}
+
+// SetupZone sets zone of the controller for zone aware routing if it is not set by option.
+// Zone is read from label topology.kubernetes.io/zone of node, whose name is in env NODE_NAME.
+func SetupZone(ctx context.Context, r client.Reader) error {
+	opts := option.Opts.Ingress
+	if !opts.ZoneAwareRouting || len(opts.Zone) > 0 {
+		return nil
+	}
+
+	nodeName := os.Getenv("NODE_NAME")
+	if len(nodeName) == 0 {
+		return fmt.Errorf("zone of controller is unknown, set argument zone or env NODE_NAME")
+	}
+	node := &corev1.Node{}
+	if err := r.Get(ctx, client.ObjectKey{Name: nodeName}, node); err != nil {
+		return fmt.Errorf("unable to get node %s: %s", nodeName, err)
+	}
+	zone := node.Labels[corev1.LabelTopologyZone]
+	if len(zone) == 0 {
+		return fmt.Errorf("label %s not found in node %s, set argument zone instead", corev1.LabelTopologyZone, nodeName)
+	}
+
+	opts.Zone = zone
+	return nil
+}
+
+// UseEndpointSlice returns whether EndpointSlice is used
+func UseEndpointSlice() bool {
+	return useEndpointSlice
+}
+
+// Object returns the object to be watched for endpoints of services
+func Object() client.Object {
+	if useEndpointSlice {
+		return &discoveryv1.EndpointSlice{}
+	}
+	return &corev1.Endpoints{}
+}
+
+// ServiceKey returns key of service which the watched object belongs to
+func ServiceKey(obj client.Object) (types.NamespacedName, bool) {
+	if _, ok := obj.(*discoveryv1.EndpointSlice); ok {
+		name, ok := obj.GetLabels()[discoveryv1.LabelServiceName]
+		return types.NamespacedName{Namespace: obj.GetNamespace(), Name: name}, ok && len(name) > 0
+	}
+	return types.NamespacedName{Namespace: obj.GetNamespace(), Name: obj.GetName()}, true
+}
+
+// Get returns all EndpointSlices of service, sorted by name.
+// If EndpointSlice is not used, they are converted from Endpoints of service.
+func Get(ctx context.Context, r client.Reader, namespace, name string) ([]*discoveryv1.EndpointSlice, error) {
+	slices, err := get(ctx, r, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if option.Opts.Ingress.ZoneAwareRouting {
+		setZones(ctx, r, slices)
+	}
+	return slices, nil
+}
+
+func get(ctx context.Context, r client.Reader, namespace, name string) ([]*discoveryv1.EndpointSlice, error) {
+	if !useEndpointSlice {
+		ep := &corev1.Endpoints{}
+		if err := r.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, ep); err != nil {
+			return nil, err
+		}
+		return FromEndpoints(ep), nil
+	}
+
+	sliceList := &discoveryv1.EndpointSliceList{}
+	err := r.List(ctx, sliceList, client.InNamespace(namespace), client.MatchingLabels{discoveryv1.LabelServiceName: name})
+	if err != nil {
+		return nil, fmt.Errorf("fail to list endpoint slices of service %s/%s: %s", namespace, name, err)
+	}
+
+	slices := make([]*discoveryv1.EndpointSlice, 0, len(sliceList.Items))
+	for i := range sliceList.Items {
+		slices = append(slices, &sliceList.Items[i])
+	}
+	sort.Slice(slices, func(i, j int) bool {
+		return slices[i].Name < slices[j].Name
+	})
+	return slices, nil
+}
+
+// Weights returns weights of endpoints keyed by address, which are set by annotation backend-weight of their pods.
+// Endpoints without the annotation are not included, and illegal annotation is ignored.
+func Weights(ctx context.Context, r client.Reader, slices []*discoveryv1.EndpointSlice) map[string]int {
+	weights := make(map[string]int)
+	for _, slice := range slices {
+		for _, ep := range slice.Endpoints {
+			if len(ep.Addresses) == 0 || ep.TargetRef == nil || ep.TargetRef.Kind != "Pod" {
+				continue
+			}
+
+			pod := &corev1.Pod{}
+			if err := r.Get(ctx, client.ObjectKey{Namespace: slice.Namespace, Name: ep.TargetRef.Name}, pod); err != nil {
+				continue
+			}
+			weight, err := annotations.GetBackendWeight(pod.Annotations)
+			if err != nil {
+				log.FromContext(ctx).Info("ignore weight of pod", "namespace", pod.Namespace, "name", pod.Name, "error", err.Error())
+				continue
+			}
+			if weight != nil {
+				weights[ep.Addresses[0]] = *weight
+			}
+		}
+	}
+	return weights
+}
+
+// setZones sets zone of endpoints which is not set, by label topology.kubernetes.io/zone of their nodes.
+// Zone is always missing in endpoints converted from Endpoints.
+func setZones(ctx context.Context, r client.Reader, slices []*discoveryv1.EndpointSlice) {
+	zones := make(map[string]string)
+	for _, slice := range slices {
+		for i := range slice.Endpoints {
+			ep := &slice.Endpoints[i]
+			if ep.Zone != nil || ep.NodeName == nil {
+				continue
+			}
+
+			zone, ok := zones[*ep.NodeName]
+			if !ok {
+				node := &corev1.Node{}
+				if err := r.Get(ctx, client.ObjectKey{Name: *ep.NodeName}, node); err == nil {
+					zone = node.Labels[corev1.LabelTopologyZone]
+				}
+				zones[*ep.NodeName] = zone
+			}
+			if len(zone) > 0 {
+				ep.Zone = &zone
+			}
+		}
+	}
+}
+
+// FromEndpoints converts Endpoints to EndpointSlices, one EndpointSlice for each subset
+func FromEndpoints(ep *corev1.Endpoints) []*discoveryv1.EndpointSlice {
+	slices := make([]*discoveryv1.EndpointSlice, 0, len(ep.Subsets))
+	for i, subset := range ep.Subsets {
+		slice := &discoveryv1.EndpointSlice{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: ep.Namespace,
+				Name:      fmt.Sprintf("%s-%d", ep.Name, i),
+				Labels:    map[string]string{discoveryv1.LabelServiceName: ep.Name},
+			},
+			AddressType: discoveryv1.AddressTypeIPv4,
+		}
+
+		for j := range subset.Ports {
+			port := subset.Ports[j]
+			slice.Ports = append(slice.Ports, discoveryv1.EndpointPort{
+				Name:        &port.Name,
+				Protocol:    &port.Protocol,
+				Port:        &port.Port,
+				AppProtocol: port.AppProtocol,
+			})
+		}
+
+		for _, addr := range subset.Addresses {
+			slice.Endpoints = append(slice.Endpoints, newEndpoint(addr, true))
+		}
+		for _, addr := range subset.NotReadyAddresses {
+			slice.Endpoints = append(slice.Endpoints, newEndpoint(addr, false))
+		}
+
+		if len(slice.Endpoints) > 0 && net.ParseIP(slice.Endpoints[0].Addresses[0]).To4() == nil {
+			slice.AddressType = discoveryv1.AddressTypeIPv6
+		}
+		slices = append(slices, slice)
+	}
+	return slices
+}
+
+func newEndpoint(addr corev1.EndpointAddress, ready bool) discoveryv1.Endpoint {
+	return discoveryv1.Endpoint{
+		Addresses:  []string{addr.IP},
+		Conditions: discoveryv1.EndpointConditions{Ready: &ready},
+		Hostname:   stringPtr(addr.Hostname),
+		TargetRef:  addr.TargetRef,
+		NodeName:   addr.NodeName,
+	}
+}
+
+func stringPtr(s string) *string {
+	if len(s) == 0 {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,259 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package endpoint
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// testDiscovery serves resources of group versions, other group versions are not found like api server
+type testDiscovery struct {
+	discovery.DiscoveryInterface
+	resources map[string][]metav1.APIResource
+	err       error
+}
+
+func (d *testDiscovery) ServerResourcesForGroupVersion(groupVersion string) (*metav1.APIResourceList, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+	resources, ok := d.resources[groupVersion]
+	if !ok {
+		gv, _ := schema.ParseGroupVersion(groupVersion)
+		return nil, apierrors.NewNotFound(gv.WithResource("").GroupResource(), "")
+	}
+	return &metav1.APIResourceList{GroupVersion: groupVersion, APIResources: resources}, nil
+}
+
+func TestSetup(t *testing.T) {
+	defer func() { useEndpointSlice = false }()
+
+	tests := []struct {
+		name      string
+		discovery *testDiscovery
+		want      bool
+		wantErr   bool
+	}{
+		{
+			name: "endpointslices served",
+			discovery: &testDiscovery{resources: map[string][]metav1.APIResource{
+				"discovery.k8s.io/v1": {{Name: "endpointslices"}},
+			}},
+			want: true,
+		},
+		{
+			name:      "discovery/v1 not served",
+			discovery: &testDiscovery{resources: map[string][]metav1.APIResource{"discovery.k8s.io/v1beta1": {{Name: "endpointslices"}}}},
+			want:      false,
+		},
+		{
+			name:      "endpointslices not served",
+			discovery: &testDiscovery{resources: map[string][]metav1.APIResource{"discovery.k8s.io/v1": {}}},
+			want:      false,
+		},
+		{
+			name:      "discovery error",
+			discovery: &testDiscovery{err: fmt.Errorf("connection refused")},
+			want:      false,
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useEndpointSlice = true
+			if err := Setup(tt.discovery); (err != nil) != tt.wantErr {
+				t.Fatalf("Setup() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if UseEndpointSlice() != tt.want {
+				t.Errorf("UseEndpointSlice() = %v, want %v", UseEndpointSlice(), tt.want)
+			}
+
+			wantObject := client.Object(&corev1.Endpoints{})
+			if tt.want {
+				wantObject = &discoveryv1.EndpointSlice{}
+			}
+			if reflect.TypeOf(Object()) != reflect.TypeOf(wantObject) {
+				t.Errorf("Object() = %T, want %T", Object(), wantObject)
+			}
+		})
+	}
+}
+
+func TestServiceKey(t *testing.T) {
+	tests := []struct {
+		name   string
+		obj    client.Object
+		want   types.NamespacedName
+		wantOk bool
+	}{
+		{
+			name: "endpoint slice",
+			obj: &discoveryv1.EndpointSlice{ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "svc-abcde",
+				Labels:    map[string]string{discoveryv1.LabelServiceName: "svc"},
+			}},
+			want:   types.NamespacedName{Namespace: "default", Name: "svc"},
+			wantOk: true,
+		},
+		{
+			name: "endpoint slice without service name label",
+			obj: &discoveryv1.EndpointSlice{ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "custom-slice",
+			}},
+			want:   types.NamespacedName{Namespace: "default"},
+			wantOk: false,
+		},
+		{
+			name: "endpoint slice with empty service name label",
+			obj: &discoveryv1.EndpointSlice{ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "custom-slice",
+				Labels:    map[string]string{discoveryv1.LabelServiceName: ""},
+			}},
+			want:   types.NamespacedName{Namespace: "default"},
+			wantOk: false,
+		},
+		{
+			name:   "endpoints",
+			obj:    &corev1.Endpoints{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "svc"}},
+			want:   types.NamespacedName{Namespace: "default", Name: "svc"},
+			wantOk: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ServiceKey(tt.obj)
+			if ok != tt.wantOk {
+				t.Fatalf("ServiceKey() ok = %v, want %v", ok, tt.wantOk)
+			}
+			if got != tt.want {
+				t.Errorf("ServiceKey() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFromEndpoints(t *testing.T) {
+	ready, notReady := true, false
+	nodeName, hostname := "node1", "pod1"
+	portName, protocol := "http", corev1.ProtocolTCP
+	port := int32(8080)
+	targetRef := &corev1.ObjectReference{Kind: "Pod", Namespace: "default", Name: "pod1"}
+
+	tests := []struct {
+		name    string
+		subsets []corev1.EndpointSubset
+		want    []*discoveryv1.EndpointSlice
+	}{
+		{
+			name: "ipv4 with not ready address",
+			subsets: []corev1.EndpointSubset{{
+				Addresses:         []corev1.EndpointAddress{{IP: "10.0.0.1", Hostname: hostname, NodeName: &nodeName, TargetRef: targetRef}},
+				NotReadyAddresses: []corev1.EndpointAddress{{IP: "10.0.0.2"}},
+				Ports:             []corev1.EndpointPort{{Name: portName, Port: port, Protocol: protocol}},
+			}},
+			want: []*discoveryv1.EndpointSlice{{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "default",
+					Name:      "svc-0",
+					Labels:    map[string]string{discoveryv1.LabelServiceName: "svc"},
+				},
+				AddressType: discoveryv1.AddressTypeIPv4,
+				Ports:       []discoveryv1.EndpointPort{{Name: &portName, Protocol: &protocol, Port: &port}},
+				Endpoints: []discoveryv1.Endpoint{
+					{
+						Addresses:  []string{"10.0.0.1"},
+						Conditions: discoveryv1.EndpointConditions{Ready: &ready},
+						Hostname:   &hostname,
+						TargetRef:  targetRef,
+						NodeName:   &nodeName,
+					},
+					{
+						Addresses:  []string{"10.0.0.2"},
+						Conditions: discoveryv1.EndpointConditions{Ready: &notReady},
+					},
+				},
+			}},
+		},
+		{
+			name: "ipv6 subsets",
+			subsets: []corev1.EndpointSubset{
+				{
+					Addresses: []corev1.EndpointAddress{{IP: "fd00::1"}},
+					Ports:     []corev1.EndpointPort{{Name: portName, Port: port, Protocol: protocol}},
+				},
+				{
+					NotReadyAddresses: []corev1.EndpointAddress{{IP: "fd00::2"}},
+				},
+			},
+			want: []*discoveryv1.EndpointSlice{
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: "default",
+						Name:      "svc-0",
+						Labels:    map[string]string{discoveryv1.LabelServiceName: "svc"},
+					},
+					AddressType: discoveryv1.AddressTypeIPv6,
+					Ports:       []discoveryv1.EndpointPort{{Name: &portName, Protocol: &protocol, Port: &port}},
+					Endpoints: []discoveryv1.Endpoint{{
+						Addresses:  []string{"fd00::1"},
+						Conditions: discoveryv1.EndpointConditions{Ready: &ready},
+					}},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: "default",
+						Name:      "svc-1",
+						Labels:    map[string]string{discoveryv1.LabelServiceName: "svc"},
+					},
+					AddressType: discoveryv1.AddressTypeIPv6,
+					Endpoints: []discoveryv1.Endpoint{{
+						Addresses:  []string{"fd00::2"},
+						Conditions: discoveryv1.EndpointConditions{Ready: &notReady},
+					}},
+				},
+			},
+		},
+		{
+			name:    "no subset",
+			subsets: nil,
+			want:    []*discoveryv1.EndpointSlice{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ep := &corev1.Endpoints{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "svc"},
+				Subsets:    tt.subsets,
+			}
+			if got := FromEndpoints(ep); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FromEndpoints() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,253 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gateway
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+
+	"github.com/bfenetworks/ingress-bfe/internal/option"
+)
+
+const (
+	kindGateway   = "Gateway"
+	kindHTTPRoute = "HTTPRoute"
+)
+
+// reasons of route conditions
+const (
+	routeReasonAccepted                   = "Accepted"
+	routeReasonNoMatchingParent           = "NoMatchingParent"
+	routeReasonNotAllowedByListeners      = "NotAllowedByListeners"
+	routeReasonNoMatchingListenerHostname = "NoMatchingListenerHostname"
+	routeReasonUnsupportedValue           = "UnsupportedValue"
+	routeReasonResolvedRefs               = "ResolvedRefs"
+	routeReasonRefNotPermitted            = "RefNotPermitted"
+	routeReasonInvalidKind                = "InvalidKind"
+	routeReasonBackendNotFound            = "BackendNotFound"
+)
+
+// controllerName returns value of controllerName in GatewayClass handled by bfe ingress controller
+func controllerName() gatewayv1alpha2.GatewayController {
+	return gatewayv1alpha2.GatewayController(option.Opts.Ingress.ControllerName)
+}
+
+// managedGateway returns true if GatewayClass of gateway is handled by bfe ingress controller
+func managedGateway(ctx context.Context, r client.Reader, gateway *gatewayv1alpha2.Gateway) bool {
+	class := &gatewayv1alpha2.GatewayClass{}
+	if err := r.Get(ctx, client.ObjectKey{Name: string(gateway.Spec.GatewayClassName)}, class); err != nil {
+		return false
+	}
+	return class.Spec.ControllerName == controllerName()
+}
+
+// parentGateway returns gateway referenced by parentRef of route, false if parent is not a gateway
+func parentGateway(namespace string, ref gatewayv1alpha2.ParentRef) (types.NamespacedName, bool) {
+	if ref.Group != nil && *ref.Group != gatewayv1alpha2.GroupName {
+		return types.NamespacedName{}, false
+	}
+	if ref.Kind != nil && *ref.Kind != kindGateway {
+		return types.NamespacedName{}, false
+	}
+	if ref.Namespace != nil {
+		namespace = string(*ref.Namespace)
+	}
+	return types.NamespacedName{Namespace: namespace, Name: string(ref.Name)}, true
+}
+
+// listenerError returns reason and message if listener is not supported
+func listenerError(listener *gatewayv1alpha2.Listener) (string, string) {
+	switch listener.Protocol {
+	case gatewayv1alpha2.HTTPProtocolType:
+		return "", ""
+	case gatewayv1alpha2.HTTPSProtocolType:
+		if listener.TLS == nil || len(listener.TLS.CertificateRefs) == 0 {
+			return string(gatewayv1alpha2.ListenerReasonInvalidCertificateRef), "certificateRefs of HTTPS listener should be specified"
+		}
+		if len(listener.TLS.CertificateRefs) > 1 {
+			return string(gatewayv1alpha2.ListenerReasonInvalidCertificateRef), "only one certificateRef of HTTPS listener is supported"
+		}
+		if listener.TLS.Mode != nil && *listener.TLS.Mode != gatewayv1alpha2.TLSModeTerminate {
+			return string(gatewayv1alpha2.ListenerReasonUnsupportedProtocol), fmt.Sprintf("tls mode %s is not supported", *listener.TLS.Mode)
+		}
+		return "", ""
+	default:
+		return string(gatewayv1alpha2.ListenerReasonUnsupportedProtocol), fmt.Sprintf("protocol %s is not supported", listener.Protocol)
+	}
+}
+
+// routeAllowed returns true if HTTPRoute in namespace is allowed to attach to listener
+func routeAllowed(gateway *gatewayv1alpha2.Gateway, listener *gatewayv1alpha2.Listener, namespace string, namespaceLabels map[string]string) bool {
+	allowed := listener.AllowedRoutes
+	if allowed != nil && len(allowed.Kinds) > 0 {
+		found := false
+		for _, kind := range allowed.Kinds {
+			if (kind.Group == nil || *kind.Group == gatewayv1alpha2.GroupName) && kind.Kind == kindHTTPRoute {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	from := gatewayv1alpha2.NamespacesFromSame
+	if allowed != nil && allowed.Namespaces != nil && allowed.Namespaces.From != nil {
+		from = *allowed.Namespaces.From
+	}
+
+	switch from {
+	case gatewayv1alpha2.NamespacesFromAll:
+		return true
+	case gatewayv1alpha2.NamespacesFromSelector:
+		if allowed.Namespaces.Selector == nil {
+			return false
+		}
+		selector, err := metav1.LabelSelectorAsSelector(allowed.Namespaces.Selector)
+		if err != nil {
+			return false
+		}
+		return selector.Matches(labels.Set(namespaceLabels))
+	default:
+		return namespace == gateway.Namespace
+	}
+}
+
+// attachRoute returns hostnames of route on each listener of gateway which route is attached to by parentRef.
+// If route is not attached to any listener, reason and message are returned.
+func attachRoute(gateway *gatewayv1alpha2.Gateway, route *gatewayv1alpha2.HTTPRoute, ref gatewayv1alpha2.ParentRef,
+	namespaceLabels map[string]string) (map[gatewayv1alpha2.SectionName][]string, string, string) {
+	listeners := make(map[gatewayv1alpha2.SectionName][]string)
+	matched, allowed := false, false
+
+	for i := range gateway.Spec.Listeners {
+		listener := &gateway.Spec.Listeners[i]
+		if ref.SectionName != nil && *ref.SectionName != listener.Name {
+			continue
+		}
+		matched = true
+
+		if reason, _ := listenerError(listener); len(reason) > 0 {
+			continue
+		}
+		if !routeAllowed(gateway, listener, route.Namespace, namespaceLabels) {
+			continue
+		}
+		allowed = true
+
+		if hostnames := intersectHostnames(listener.Hostname, route.Spec.Hostnames); len(hostnames) > 0 {
+			listeners[listener.Name] = hostnames
+		}
+	}
+
+	switch {
+	case !matched:
+		return nil, routeReasonNoMatchingParent, fmt.Sprintf("listener %s not found in gateway", *ref.SectionName)
+	case !allowed:
+		return nil, routeReasonNotAllowedByListeners, "route is not allowed by listeners"
+	case len(listeners) == 0:
+		return nil, routeReasonNoMatchingListenerHostname, "no hostname of route matches listeners"
+	}
+	return listeners, "", ""
+}
+
+// getListener returns listener of gateway by name
+func getListener(gateway *gatewayv1alpha2.Gateway, name gatewayv1alpha2.SectionName) *gatewayv1alpha2.Listener {
+	for i := range gateway.Spec.Listeners {
+		if gateway.Spec.Listeners[i].Name == name {
+			return &gateway.Spec.Listeners[i]
+		}
+	}
+	return nil
+}
+
+// getNamespaceLabels returns labels of namespace, used by route namespace selector of listener
+func getNamespaceLabels(ctx context.Context, r client.Reader, name string) map[string]string {
+	namespace := &corev1.Namespace{}
+	if err := r.Get(ctx, client.ObjectKey{Name: name}, namespace); err != nil {
+		return nil
+	}
+	return namespace.Labels
+}
+
+// newCondition returns condition observed for object
+func newCondition(obj client.Object, conditionType string, status bool, reason, message string) metav1.Condition {
+	condition := metav1.Condition{
+		Type:               conditionType,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: obj.GetGeneration(),
+		Reason:             reason,
+		Message:            message,
+	}
+	if status {
+		condition.Status = metav1.ConditionTrue
+	}
+	return condition
+}
+
+// resyncRunnable sends all objects of a kind to controller after this replica is elected,
+// so that their status is written by the leader
+type resyncRunnable struct {
+	client  client.Reader
+	elected <-chan struct{}
+	list    client.ObjectList
+	events  chan event.GenericEvent
+}
+
+func newResyncRunnable(r client.Reader, elected <-chan struct{}, list client.ObjectList) *resyncRunnable {
+	return &resyncRunnable{
+		client:  r,
+		elected: elected,
+		list:    list,
+		events:  make(chan event.GenericEvent),
+	}
+}
+
+// Start implements manager.Runnable
+func (r *resyncRunnable) Start(ctx context.Context) error {
+	select {
+	case <-r.elected:
+	case <-ctx.Done():
+		return nil
+	}
+
+	if err := r.client.List(ctx, r.list); err != nil {
+		log.FromContext(ctx).Error(err, "fail to list objects for resync")
+		return nil
+	}
+	objects, err := meta.ExtractList(r.list)
+	if err != nil {
+		return err
+	}
+
+	for _, obj := range objects {
+		select {
+		case r.events <- event.GenericEvent{Object: obj.(client.Object)}:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	return nil
+}
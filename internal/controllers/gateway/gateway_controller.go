@@ -0,0 +1,448 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/bfenetworks/bfe/bfe_config/bfe_tls_conf/server_cert_conf"
+	"github.com/bfenetworks/bfe/bfe_config/bfe_tls_conf/tls_rule_conf"
+	"github.com/bfenetworks/bfe/bfe_tls"
+	corev1 "k8s.io/api/core/v1"
+	netv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+
+	"github.com/bfenetworks/ingress-bfe/internal/bfeConfig"
+	"github.com/bfenetworks/ingress-bfe/internal/bfeConfig/configs"
+	"github.com/bfenetworks/ingress-bfe/internal/controllers/filter"
+	"github.com/bfenetworks/ingress-bfe/internal/controllers/status"
+)
+
+func AddGatewayController(mgr manager.Manager, cb *bfeConfig.ConfigBuilder, publisher *status.Publisher) error {
+	reconciler := newGatewayReconciler(mgr, cb, publisher)
+	if err := mgr.Add(reconciler.resync); err != nil {
+		return err
+	}
+	if err := reconciler.setupWithManager(mgr); err != nil {
+		return fmt.Errorf("unable to create gateway controller")
+	}
+
+	return nil
+}
+
+// GatewayReconciler converts certificates of HTTPS listeners to tls config of a route of bfe config,
+// and writes status of gateways whose GatewayClass is handled by bfe ingress controller.
+type GatewayReconciler struct {
+	BfeConfigBuilder *bfeConfig.ConfigBuilder
+	StatusPublisher  *status.Publisher
+
+	client.Client
+	Scheme *runtime.Scheme
+	resync *resyncRunnable
+}
+
+func newGatewayReconciler(mgr manager.Manager, cb *bfeConfig.ConfigBuilder, publisher *status.Publisher) *GatewayReconciler {
+	return &GatewayReconciler{
+		BfeConfigBuilder: cb,
+		StatusPublisher:  publisher,
+		Client:           mgr.GetClient(),
+		Scheme:           mgr.GetScheme(),
+		resync:           newResyncRunnable(mgr.GetClient(), mgr.Elected(), &gatewayv1alpha2.GatewayList{}),
+	}
+}
+
+// listenerResult is result of reconciling a listener
+type listenerResult struct {
+	// reason and message if listener is not supported or its certificate is invalid
+	reason  string
+	message string
+	// hostnames of attached routes
+	hostnames      []string
+	attachedRoutes int32
+	secret         *corev1.Secret
+	// names of certificate in secret, and hostnames not included in certificate
+	certNames      []string
+	unmatchedHosts []string
+}
+
+func (r *GatewayReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+	log.V(1).Info("reconciling gateway", "api version", "v1alpha2")
+
+	gateway := &gatewayv1alpha2.Gateway{}
+	if err := r.Get(ctx, req.NamespacedName, gateway); err != nil {
+		r.BfeConfigBuilder.DeleteRoute(kindGateway, req.Namespace, req.Name)
+		log.V(1).Info("reconcile: gateway delete")
+		return reconcile.Result{}, nil
+	}
+
+	if !managedGateway(ctx, r, gateway) {
+		r.BfeConfigBuilder.DeleteRoute(kindGateway, req.Namespace, req.Name)
+		return reconcile.Result{}, nil
+	}
+
+	listeners := r.attachedRoutes(ctx, gateway)
+	for i := range gateway.Spec.Listeners {
+		r.resolveCertificate(ctx, gateway, &gateway.Spec.Listeners[i], listeners[gateway.Spec.Listeners[i].Name])
+	}
+
+	route, secrets := tlsRoute(gateway, listeners)
+	// route is deleted by config builder on error
+	err := r.BfeConfigBuilder.UpdateRoute(route, nil, nil, nil, nil, secrets)
+
+	// only leader writes status
+	if r.StatusPublisher.Elected() {
+		r.setStatus(ctx, gateway, listeners, err)
+	}
+
+	return reconcile.Result{}, err
+}
+
+// attachedRoutes returns result of each listener, with routes attached to it
+func (r *GatewayReconciler) attachedRoutes(ctx context.Context, gateway *gatewayv1alpha2.Gateway) map[gatewayv1alpha2.SectionName]*listenerResult {
+	listeners := make(map[gatewayv1alpha2.SectionName]*listenerResult)
+	for i := range gateway.Spec.Listeners {
+		listener := &gateway.Spec.Listeners[i]
+		reason, message := listenerError(listener)
+		listeners[listener.Name] = &listenerResult{reason: reason, message: message}
+	}
+
+	routeList := &gatewayv1alpha2.HTTPRouteList{}
+	if err := r.List(ctx, routeList); err != nil {
+		log.FromContext(ctx).Error(err, "fail to list httproutes")
+		return listeners
+	}
+
+	namespaceLabels := make(map[string]map[string]string)
+	for i := range routeList.Items {
+		route := &routeList.Items[i]
+		if !filter.NamespaceFilter().Generic(event.GenericEvent{Object: route}) {
+			continue
+		}
+		if _, ok := namespaceLabels[route.Namespace]; !ok {
+			namespaceLabels[route.Namespace] = getNamespaceLabels(ctx, r, route.Namespace)
+		}
+
+		for _, ref := range route.Spec.ParentRefs {
+			if key, ok := parentGateway(route.Namespace, ref); !ok || key != client.ObjectKeyFromObject(gateway) {
+				continue
+			}
+			attached, _, _ := attachRoute(gateway, route, ref, namespaceLabels[route.Namespace])
+			for name, hostnames := range attached {
+				listeners[name].attachedRoutes++
+				listeners[name].hostnames = append(listeners[name].hostnames, hostnames...)
+			}
+		}
+	}
+
+	return listeners
+}
+
+// resolveCertificate gets secret of HTTPS listener, which should be in namespace of gateway
+func (r *GatewayReconciler) resolveCertificate(ctx context.Context, gateway *gatewayv1alpha2.Gateway, listener *gatewayv1alpha2.Listener, result *listenerResult) {
+	if len(result.reason) > 0 || listener.Protocol != gatewayv1alpha2.HTTPSProtocolType {
+		return
+	}
+
+	ref := listener.TLS.CertificateRefs[0]
+	if ref == nil {
+		result.reason = string(gatewayv1alpha2.ListenerReasonInvalidCertificateRef)
+		result.message = "certificateRef is empty"
+		return
+	}
+	if (ref.Group != nil && len(*ref.Group) > 0) || (ref.Kind != nil && *ref.Kind != "Secret") {
+		result.reason = string(gatewayv1alpha2.ListenerReasonInvalidCertificateRef)
+		result.message = fmt.Sprintf("certificateRef %s is not a Secret", ref.Name)
+		return
+	}
+	if ref.Namespace != nil && string(*ref.Namespace) != gateway.Namespace {
+		result.reason = string(gatewayv1alpha2.ListenerReasonRefNotPermitted)
+		result.message = fmt.Sprintf("certificateRef %s/%s is not in namespace of gateway", *ref.Namespace, ref.Name)
+		return
+	}
+
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: gateway.Namespace, Name: string(ref.Name)}, secret); err != nil {
+		result.reason = string(gatewayv1alpha2.ListenerReasonInvalidCertificateRef)
+		result.message = fmt.Sprintf("secret %s not found", ref.Name)
+		return
+	}
+
+	cert, err := bfe_tls.X509KeyPair(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		result.reason = string(gatewayv1alpha2.ListenerReasonInvalidCertificateRef)
+		result.message = fmt.Sprintf("secret %s is not a valid certificate: %s", ref.Name, err)
+		return
+	}
+	result.secret = secret
+	result.certNames = server_cert_conf.GetNamesForCert(&cert)
+}
+
+// tlsRoute returns route with tls config of HTTPS listeners. Certificate is used for hostname of listener,
+// or hostnames of attached routes if hostname of listener is not specified. Hostnames not included in
+// certificate are recorded in result of listener, as bfe rejects tls config using them.
+func tlsRoute(gateway *gatewayv1alpha2.Gateway, listeners map[gatewayv1alpha2.SectionName]*listenerResult) (*configs.Route, []*corev1.Secret) {
+	route := &configs.Route{
+		Kind:              kindGateway,
+		Namespace:         gateway.Namespace,
+		Name:              gateway.Name,
+		CreationTimestamp: gateway.CreationTimestamp,
+	}
+
+	var secrets []*corev1.Secret
+	for _, listener := range gateway.Spec.Listeners {
+		result := listeners[listener.Name]
+		if result.secret == nil {
+			continue
+		}
+
+		var candidates, hosts []string
+		if listener.Hostname != nil && len(*listener.Hostname) > 0 {
+			candidates = []string{string(*listener.Hostname)}
+		} else {
+			candidates = uniqueHostnames(result.hostnames)
+		}
+		result.unmatchedHosts = nil
+		for _, host := range candidates {
+			if len(host) == 0 {
+				continue
+			}
+			if tls_rule_conf.MatchCertNames(result.certNames, strings.ToLower(host)) {
+				hosts = append(hosts, host)
+			} else {
+				result.unmatchedHosts = append(result.unmatchedHosts, host)
+			}
+		}
+		if len(hosts) == 0 {
+			continue
+		}
+
+		route.TLS = append(route.TLS, netv1.IngressTLS{Hosts: hosts, SecretName: result.secret.Name})
+		secrets = append(secrets, result.secret)
+	}
+
+	return route, secrets
+}
+
+// setStatus writes addresses, conditions and listener status of gateway
+func (r *GatewayReconciler) setStatus(ctx context.Context, gateway *gatewayv1alpha2.Gateway, listeners map[gatewayv1alpha2.SectionName]*listenerResult, err error) {
+	log := log.FromContext(ctx)
+
+	gatewayStatus := gateway.Status.DeepCopy()
+
+	gatewayStatus.Addresses = nil
+	addresses, addrErr := r.StatusPublisher.Addresses(ctx)
+	if addrErr != nil {
+		log.Error(addrErr, "fail to get gateway address")
+		// keep addresses written before
+		gatewayStatus.Addresses = gateway.Status.Addresses
+	}
+	for _, addr := range addresses {
+		if len(addr.IP) > 0 {
+			gatewayStatus.Addresses = append(gatewayStatus.Addresses, gatewayAddress(gatewayv1alpha2.IPAddressType, addr.IP))
+		} else {
+			gatewayStatus.Addresses = append(gatewayStatus.Addresses, gatewayAddress(gatewayv1alpha2.HostnameAddressType, addr.Hostname))
+		}
+	}
+
+	var listenerStatuses []gatewayv1alpha2.ListenerStatus
+	ready := err == nil
+	for _, listener := range gateway.Spec.Listeners {
+		listenerStatus := listenerStatusOf(gateway, listener, listeners[listener.Name])
+		listenerStatuses = append(listenerStatuses, listenerStatus)
+		if !meta.IsStatusConditionTrue(listenerStatus.Conditions, string(gatewayv1alpha2.ListenerConditionReady)) {
+			ready = false
+		}
+	}
+	gatewayStatus.Listeners = listenerStatuses
+
+	meta.SetStatusCondition(&gatewayStatus.Conditions, newCondition(gateway, string(gatewayv1alpha2.GatewayConditionScheduled),
+		true, string(gatewayv1alpha2.GatewayReasonScheduled), "Gateway is scheduled by bfe ingress controller"))
+
+	switch {
+	case err != nil:
+		meta.SetStatusCondition(&gatewayStatus.Conditions, newCondition(gateway, string(gatewayv1alpha2.GatewayConditionReady),
+			false, string(gatewayv1alpha2.GatewayReasonListenersNotReady), err.Error()))
+	case !ready:
+		meta.SetStatusCondition(&gatewayStatus.Conditions, newCondition(gateway, string(gatewayv1alpha2.GatewayConditionReady),
+			false, string(gatewayv1alpha2.GatewayReasonListenersNotValid), "Some listeners are not valid"))
+	default:
+		meta.SetStatusCondition(&gatewayStatus.Conditions, newCondition(gateway, string(gatewayv1alpha2.GatewayConditionReady),
+			true, string(gatewayv1alpha2.GatewayReasonReady), "Gateway is ready"))
+	}
+
+	if reflect.DeepEqual(*gatewayStatus, gateway.Status) {
+		return
+	}
+
+	gateway.Status = *gatewayStatus
+	if err := r.Status().Update(ctx, gateway); err != nil {
+		log.Error(err, "fail to update gateway status")
+	}
+}
+
+// listenerStatusOf returns status of listener, conditions written before are kept if not changed
+func listenerStatusOf(gateway *gatewayv1alpha2.Gateway, listener gatewayv1alpha2.Listener, result *listenerResult) gatewayv1alpha2.ListenerStatus {
+	listenerStatus := gatewayv1alpha2.ListenerStatus{
+		Name:           listener.Name,
+		AttachedRoutes: result.attachedRoutes,
+		SupportedKinds: []gatewayv1alpha2.RouteGroupKind{},
+	}
+	for _, s := range gateway.Status.Listeners {
+		if s.Name == listener.Name {
+			listenerStatus.Conditions = append(listenerStatus.Conditions, s.Conditions...)
+		}
+	}
+
+	unsupported := result.reason == string(gatewayv1alpha2.ListenerReasonUnsupportedProtocol)
+	if !unsupported {
+		group := gatewayv1alpha2.Group(gatewayv1alpha2.GroupName)
+		listenerStatus.SupportedKinds = append(listenerStatus.SupportedKinds, gatewayv1alpha2.RouteGroupKind{Group: &group, Kind: kindHTTPRoute})
+	}
+
+	conditions := []metav1.Condition{
+		newCondition(gateway, string(gatewayv1alpha2.ListenerConditionDetached),
+			false, string(gatewayv1alpha2.ListenerReasonAttached), "Listener is attached"),
+		newCondition(gateway, string(gatewayv1alpha2.ListenerConditionResolvedRefs),
+			true, string(gatewayv1alpha2.ListenerReasonResolvedRefs), "References are resolved"),
+		newCondition(gateway, string(gatewayv1alpha2.ListenerConditionReady),
+			true, string(gatewayv1alpha2.ListenerReasonReady), "Listener is ready"),
+	}
+	if len(result.unmatchedHosts) > 0 {
+		conditions[2].Message = fmt.Sprintf("Listener is ready, hostnames not included in certificate are not served with it: %s",
+			strings.Join(result.unmatchedHosts, ", "))
+	}
+	switch {
+	case unsupported:
+		conditions[0] = newCondition(gateway, string(gatewayv1alpha2.ListenerConditionDetached), true, result.reason, result.message)
+		conditions[2] = newCondition(gateway, string(gatewayv1alpha2.ListenerConditionReady), false, string(gatewayv1alpha2.ListenerReasonInvalid), result.message)
+	case len(result.reason) > 0:
+		conditions[1] = newCondition(gateway, string(gatewayv1alpha2.ListenerConditionResolvedRefs), false, result.reason, result.message)
+		conditions[2] = newCondition(gateway, string(gatewayv1alpha2.ListenerConditionReady), false, string(gatewayv1alpha2.ListenerReasonInvalid), result.message)
+	}
+	for _, condition := range conditions {
+		meta.SetStatusCondition(&listenerStatus.Conditions, condition)
+	}
+
+	return listenerStatus
+}
+
+func gatewayAddress(addressType gatewayv1alpha2.AddressType, value string) gatewayv1alpha2.GatewayAddress {
+	return gatewayv1alpha2.GatewayAddress{Type: &addressType, Value: value}
+}
+
+func (r *GatewayReconciler) setupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&gatewayv1alpha2.Gateway{}, builder.WithPredicates(filter.NamespaceFilter())).
+		Watches(&source.Channel{Source: r.resync.events}, &handler.EnqueueRequestForObject{}).
+		Watches(r.BfeConfigBuilder.RouteRequeueSource(), handler.EnqueueRequestsFromMapFunc(requeuedGateways)).
+		Watches(
+			&source.Kind{Type: &gatewayv1alpha2.GatewayClass{}},
+			handler.EnqueueRequestsFromMapFunc(r.classGateways),
+		).
+		Watches(
+			&source.Kind{Type: &gatewayv1alpha2.HTTPRoute{}},
+			handler.EnqueueRequestsFromMapFunc(routeGateways),
+			builder.WithPredicates(filter.NamespaceFilter()),
+		).
+		Watches(
+			&source.Kind{Type: &corev1.Secret{}},
+			handler.EnqueueRequestsFromMapFunc(r.secretGateways),
+			builder.WithPredicates(filter.NamespaceFilter()),
+		).
+		Complete(r)
+}
+
+// classGateways returns gateways of GatewayClass
+func (r *GatewayReconciler) classGateways(obj client.Object) []reconcile.Request {
+	return r.gateways(func(gateway *gatewayv1alpha2.Gateway) bool {
+		return string(gateway.Spec.GatewayClassName) == obj.GetName()
+	})
+}
+
+// secretGateways returns gateways referencing secret by certificateRefs
+func (r *GatewayReconciler) secretGateways(obj client.Object) []reconcile.Request {
+	return r.gateways(func(gateway *gatewayv1alpha2.Gateway) bool {
+		if gateway.Namespace != obj.GetNamespace() {
+			return false
+		}
+		for _, listener := range gateway.Spec.Listeners {
+			if listener.TLS == nil {
+				continue
+			}
+			for _, ref := range listener.TLS.CertificateRefs {
+				if ref != nil && string(ref.Name) == obj.GetName() {
+					return true
+				}
+			}
+		}
+		return false
+	})
+}
+
+// gateways returns requests of gateways selected by fn
+func (r *GatewayReconciler) gateways(fn func(gateway *gatewayv1alpha2.Gateway) bool) []reconcile.Request {
+	gatewayList := &gatewayv1alpha2.GatewayList{}
+	if err := r.List(context.Background(), gatewayList); err != nil {
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for i := range gatewayList.Items {
+		if fn(&gatewayList.Items[i]) {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&gatewayList.Items[i])})
+		}
+	}
+	return requests
+}
+
+// requeuedGateways returns gateway requeued by config builder
+func requeuedGateways(obj client.Object) []reconcile.Request {
+	if obj.GetObjectKind().GroupVersionKind().Kind != kindGateway {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: client.ObjectKeyFromObject(obj)}}
+}
+
+// routeGateways returns gateways referenced by parentRefs of route
+func routeGateways(obj client.Object) []reconcile.Request {
+	route, ok := obj.(*gatewayv1alpha2.HTTPRoute)
+	if !ok {
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, ref := range route.Spec.ParentRefs {
+		if key, ok := parentGateway(route.Namespace, ref); ok {
+			requests = append(requests, reconcile.Request{NamespacedName: key})
+		}
+	}
+	return requests
+}
@@ -0,0 +1,122 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gateway
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+)
+
+func Test_tlsRoute(t *testing.T) {
+	gateway := &gatewayv1alpha2.Gateway{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "gw", Name: "gateway"},
+		Spec: gatewayv1alpha2.GatewaySpec{
+			Listeners: []gatewayv1alpha2.Listener{
+				{Name: "https", Protocol: gatewayv1alpha2.HTTPSProtocolType},
+				{Name: "https-host", Protocol: gatewayv1alpha2.HTTPSProtocolType, Hostname: hostname("bar.com")},
+			},
+		},
+	}
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "gw", Name: "cert"}}
+	listeners := map[gatewayv1alpha2.SectionName]*listenerResult{
+		"https": {
+			hostnames: []string{"foo.com", "a.foo.com", "evil.com", "a.foo.com"},
+			secret:    secret,
+			certNames: []string{"foo.com", "*.foo.com"},
+		},
+		"https-host": {
+			secret:    secret,
+			certNames: []string{"foo.com"},
+		},
+	}
+
+	route, secrets := tlsRoute(gateway, listeners)
+
+	// hostnames of routes not included in certificate are dropped
+	want := []string{"a.foo.com", "foo.com"}
+	if len(route.TLS) != 1 || !reflect.DeepEqual(route.TLS[0].Hosts, want) || len(secrets) != 1 {
+		t.Fatalf("tls of route = %+v, want hosts %v", route.TLS, want)
+	}
+	if got := listeners["https"].unmatchedHosts; !reflect.DeepEqual(got, []string{"evil.com"}) {
+		t.Errorf("unmatched hosts of https = %v", got)
+	}
+	if got := listeners["https-host"].unmatchedHosts; !reflect.DeepEqual(got, []string{"bar.com"}) {
+		t.Errorf("unmatched hosts of https-host = %v", got)
+	}
+
+	// unmatched hostnames are reported in status of listener
+	status := listenerStatusOf(gateway, gateway.Spec.Listeners[0], listeners["https"])
+	for _, condition := range status.Conditions {
+		if condition.Type == string(gatewayv1alpha2.ListenerConditionReady) &&
+			condition.Message != "Listener is ready, hostnames not included in certificate are not served with it: evil.com" {
+			t.Errorf("ready condition of listener = %+v", condition)
+		}
+	}
+}
+
+func Test_listenerError(t *testing.T) {
+	passthrough := gatewayv1alpha2.TLSModePassthrough
+	ref := &gatewayv1alpha2.SecretObjectReference{Name: "cert"}
+	tests := []struct {
+		name     string
+		listener gatewayv1alpha2.Listener
+		want     string
+	}{
+		{
+			name:     "http",
+			listener: gatewayv1alpha2.Listener{Protocol: gatewayv1alpha2.HTTPProtocolType},
+			want:     "",
+		},
+		{
+			name: "https",
+			listener: gatewayv1alpha2.Listener{Protocol: gatewayv1alpha2.HTTPSProtocolType,
+				TLS: &gatewayv1alpha2.GatewayTLSConfig{CertificateRefs: []*gatewayv1alpha2.SecretObjectReference{ref}}},
+			want: "",
+		},
+		{
+			name:     "https without certificate",
+			listener: gatewayv1alpha2.Listener{Protocol: gatewayv1alpha2.HTTPSProtocolType},
+			want:     string(gatewayv1alpha2.ListenerReasonInvalidCertificateRef),
+		},
+		{
+			name: "https with multiple certificates",
+			listener: gatewayv1alpha2.Listener{Protocol: gatewayv1alpha2.HTTPSProtocolType,
+				TLS: &gatewayv1alpha2.GatewayTLSConfig{CertificateRefs: []*gatewayv1alpha2.SecretObjectReference{ref, ref}}},
+			want: string(gatewayv1alpha2.ListenerReasonInvalidCertificateRef),
+		},
+		{
+			name: "tls passthrough",
+			listener: gatewayv1alpha2.Listener{Protocol: gatewayv1alpha2.HTTPSProtocolType,
+				TLS: &gatewayv1alpha2.GatewayTLSConfig{Mode: &passthrough, CertificateRefs: []*gatewayv1alpha2.SecretObjectReference{ref}}},
+			want: string(gatewayv1alpha2.ListenerReasonUnsupportedProtocol),
+		},
+		{
+			name:     "tcp",
+			listener: gatewayv1alpha2.Listener{Protocol: gatewayv1alpha2.TCPProtocolType},
+			want:     string(gatewayv1alpha2.ListenerReasonUnsupportedProtocol),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, _ := listenerError(&tt.listener); got != tt.want {
+				t.Errorf("listenerError() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gateway
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+
+	"github.com/bfenetworks/ingress-bfe/internal/controllers/status"
+)
+
+func AddGatewayClassController(mgr manager.Manager, publisher *status.Publisher) error {
+	reconciler := newGatewayClassReconciler(mgr, publisher)
+	if err := mgr.Add(reconciler.resync); err != nil {
+		return err
+	}
+	if err := reconciler.setupWithManager(mgr); err != nil {
+		return fmt.Errorf("unable to create gatewayclass controller")
+	}
+
+	return nil
+}
+
+// GatewayClassReconciler accepts GatewayClass whose controllerName is the name of bfe ingress controller
+type GatewayClassReconciler struct {
+	StatusPublisher *status.Publisher
+
+	client.Client
+	Scheme *runtime.Scheme
+	resync *resyncRunnable
+}
+
+func newGatewayClassReconciler(mgr manager.Manager, publisher *status.Publisher) *GatewayClassReconciler {
+	return &GatewayClassReconciler{
+		StatusPublisher: publisher,
+		Client:          mgr.GetClient(),
+		Scheme:          mgr.GetScheme(),
+		resync:          newResyncRunnable(mgr.GetClient(), mgr.Elected(), &gatewayv1alpha2.GatewayClassList{}),
+	}
+}
+
+func (r *GatewayClassReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+	log.V(1).Info("reconciling gatewayclass", "api version", "v1alpha2")
+
+	// only leader writes status
+	if !r.StatusPublisher.Elected() {
+		return reconcile.Result{}, nil
+	}
+
+	class := &gatewayv1alpha2.GatewayClass{}
+	if err := r.Get(ctx, req.NamespacedName, class); err != nil {
+		return reconcile.Result{}, nil
+	}
+	if class.Spec.ControllerName != controllerName() {
+		return reconcile.Result{}, nil
+	}
+
+	condition := newCondition(class, string(gatewayv1alpha2.GatewayClassConditionStatusAccepted),
+		true, string(gatewayv1alpha2.GatewayClassReasonAccepted), "GatewayClass is accepted by bfe ingress controller")
+	if current := meta.FindStatusCondition(class.Status.Conditions, condition.Type); current != nil &&
+		current.Status == condition.Status && current.Reason == condition.Reason && current.ObservedGeneration == condition.ObservedGeneration {
+		return reconcile.Result{}, nil
+	}
+
+	meta.SetStatusCondition(&class.Status.Conditions, condition)
+	if err := r.Status().Update(ctx, class); err != nil {
+		log.Error(err, "fail to update gatewayclass status")
+		return reconcile.Result{}, err
+	}
+
+	return reconcile.Result{}, nil
+}
+
+func (r *GatewayClassReconciler) setupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&gatewayv1alpha2.GatewayClass{}).
+		Watches(&source.Channel{Source: r.resync.events}, &handler.EnqueueRequestForObject{}).
+		Complete(r)
+}
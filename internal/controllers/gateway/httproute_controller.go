@@ -0,0 +1,391 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+
+	"github.com/bfenetworks/ingress-bfe/internal/bfeConfig"
+	"github.com/bfenetworks/ingress-bfe/internal/bfeConfig/configs"
+	"github.com/bfenetworks/ingress-bfe/internal/bfeConfig/util"
+	"github.com/bfenetworks/ingress-bfe/internal/controllers/endpoint"
+	"github.com/bfenetworks/ingress-bfe/internal/controllers/event"
+	"github.com/bfenetworks/ingress-bfe/internal/controllers/filter"
+	"github.com/bfenetworks/ingress-bfe/internal/controllers/ingress/netv1"
+	"github.com/bfenetworks/ingress-bfe/internal/controllers/status"
+)
+
+func AddHTTPRouteController(mgr manager.Manager, cb *bfeConfig.ConfigBuilder, publisher *status.Publisher) error {
+	reconciler := newHTTPRouteReconciler(mgr, cb, publisher)
+	if err := mgr.Add(reconciler.resync); err != nil {
+		return err
+	}
+	if err := reconciler.setupWithManager(mgr); err != nil {
+		return fmt.Errorf("unable to create httproute controller")
+	}
+
+	return nil
+}
+
+// HTTPRouteReconciler converts HTTPRoute attached to gateways of bfe to route of bfe config, one rule for each match of rules
+type HTTPRouteReconciler struct {
+	BfeConfigBuilder *bfeConfig.ConfigBuilder
+	StatusPublisher  *status.Publisher
+
+	client.Client
+	Scheme   *runtime.Scheme
+	recorder record.EventRecorder
+	resync   *resyncRunnable
+}
+
+func newHTTPRouteReconciler(mgr manager.Manager, cb *bfeConfig.ConfigBuilder, publisher *status.Publisher) *HTTPRouteReconciler {
+	return &HTTPRouteReconciler{
+		BfeConfigBuilder: cb,
+		StatusPublisher:  publisher,
+		Client:           mgr.GetClient(),
+		Scheme:           mgr.GetScheme(),
+		recorder:         mgr.GetEventRecorderFor("bfe-ingress-controller"),
+		resync:           newResyncRunnable(mgr.GetClient(), mgr.Elected(), &gatewayv1alpha2.HTTPRouteList{}),
+	}
+}
+
+// routeParent is result of attaching route to a gateway of bfe
+type routeParent struct {
+	ref gatewayv1alpha2.ParentRef
+	// reason and message if route is not attached to the gateway
+	reason  string
+	message string
+}
+
+func (r *HTTPRouteReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+	log.V(1).Info("reconciling httproute", "api version", "v1alpha2")
+
+	route := &gatewayv1alpha2.HTTPRoute{}
+	if err := r.Get(ctx, req.NamespacedName, route); err != nil {
+		r.BfeConfigBuilder.DeleteRoute(kindHTTPRoute, req.Namespace, req.Name)
+		log.V(1).Info("reconcile: httproute delete")
+		return reconcile.Result{}, nil
+	}
+
+	parents, groups := r.attach(ctx, route)
+	if len(parents) == 0 {
+		// route may be detached from gateways of bfe
+		r.BfeConfigBuilder.DeleteRoute(kindHTTPRoute, req.Namespace, req.Name)
+		return reconcile.Result{}, nil
+	}
+
+	var err error
+	var refErr *refError
+	if len(groups) == 0 {
+		r.BfeConfigBuilder.DeleteRoute(kindHTTPRoute, req.Namespace, req.Name)
+	} else {
+		refErr, err = r.syncRoute(ctx, route, groups)
+	}
+
+	// only leader writes status and events
+	if r.StatusPublisher.Elected() {
+		r.setStatus(ctx, route, parents, refErr, err)
+
+		if err != nil {
+			r.recorder.Event(route, corev1.EventTypeWarning, event.SyncFailed, err.Error())
+		} else if len(groups) > 0 {
+			r.recorder.Event(route, corev1.EventTypeNormal, event.SyncSucceed, "Synced")
+		}
+	}
+
+	return reconcile.Result{}, err
+}
+
+// attach returns gateways of bfe referenced by route, and hostnames of route on attached listeners
+func (r *HTTPRouteReconciler) attach(ctx context.Context, route *gatewayv1alpha2.HTTPRoute) ([]routeParent, []hostGroup) {
+	namespaceLabels := getNamespaceLabels(ctx, r, route.Namespace)
+
+	var parents []routeParent
+	var http, https []string
+	for _, ref := range route.Spec.ParentRefs {
+		key, ok := parentGateway(route.Namespace, ref)
+		if !ok {
+			continue
+		}
+		gateway := &gatewayv1alpha2.Gateway{}
+		if err := r.Get(ctx, key, gateway); err != nil || !managedGateway(ctx, r, gateway) {
+			continue
+		}
+
+		listeners, reason, message := attachRoute(gateway, route, ref, namespaceLabels)
+		parents = append(parents, routeParent{ref: ref, reason: reason, message: message})
+
+		for name, hostnames := range listeners {
+			if getListener(gateway, name).Protocol == gatewayv1alpha2.HTTPSProtocolType {
+				https = append(https, hostnames...)
+			} else {
+				http = append(http, hostnames...)
+			}
+		}
+	}
+
+	return parents, newHostGroups(http, https)
+}
+
+// syncRoute converts route to route of bfe config and updates bfe config.
+// Route is kept if some backends are not found, requests to them are responded with 500, and *refError is returned.
+func (r *HTTPRouteReconciler) syncRoute(ctx context.Context, route *gatewayv1alpha2.HTTPRoute, groups []hostGroup) (*refError, error) {
+	rules, backends, err := routeRules(route, groups)
+	if err != nil {
+		r.BfeConfigBuilder.DeleteRoute(kindHTTPRoute, route.Namespace, route.Name)
+		return nil, err
+	}
+
+	services, endpoints, refErr, err := r.getBackends(ctx, route.Namespace, backends)
+	if err != nil {
+		r.BfeConfigBuilder.DeleteRoute(kindHTTPRoute, route.Namespace, route.Name)
+		return nil, err
+	}
+
+	// placeholder backend and services not found have no subcluster
+	unresolved := []string{noBackend}
+	for _, backend := range backends {
+		if _, ok := services[util.NamespacedName(route.Namespace, backend.name)]; !ok {
+			unresolved = append(unresolved, backend.name)
+		}
+	}
+
+	weights := make(map[string]int)
+	for _, slices := range endpoints {
+		for addr, weight := range endpoint.Weights(ctx, r, slices) {
+			weights[addr] = weight
+		}
+	}
+	probes := netv1.GetServiceProbes(ctx, r, endpoints)
+
+	bfeRoute := &configs.Route{
+		Kind:               kindHTTPRoute,
+		Namespace:          route.Namespace,
+		Name:               route.Name,
+		CreationTimestamp:  route.CreationTimestamp,
+		Rules:              rules,
+		UnresolvedBackends: unresolved,
+	}
+	// route is removed as a whole on error, like ingress with invalid rules
+	if err := r.BfeConfigBuilder.UpdateRoute(bfeRoute, services, endpoints, weights, probes, nil); err != nil {
+		return nil, err
+	}
+
+	return refErr, nil
+}
+
+// getBackends returns services and endpoints referenced by route, error of not found service is returned as *refError
+func (r *HTTPRouteReconciler) getBackends(ctx context.Context, namespace string, backends []routeBackend) (map[string]*corev1.Service, map[string][]*discoveryv1.EndpointSlice, *refError, error) {
+	services := make(map[string]*corev1.Service)
+	endpoints := make(map[string][]*discoveryv1.EndpointSlice)
+	var refErr *refError
+
+	for _, backend := range backends {
+		name := util.NamespacedName(namespace, backend.name)
+		if _, ok := services[name]; ok {
+			continue
+		}
+
+		svc := &corev1.Service{}
+		if err := r.Get(ctx, client.ObjectKey{Namespace: namespace, Name: backend.name}, svc); err != nil {
+			refErr = &refError{reason: routeReasonBackendNotFound, msg: fmt.Sprintf("service %s not found", name)}
+			continue
+		}
+		if !servicePortExist(svc, backend.port) {
+			refErr = &refError{reason: routeReasonBackendNotFound, msg: fmt.Sprintf("service %s port %d not found", name, backend.port)}
+			continue
+		}
+
+		slices, err := endpoint.Get(ctx, r, namespace, backend.name)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		services[name] = svc
+		endpoints[name] = slices
+	}
+
+	return services, endpoints, refErr, nil
+}
+
+func servicePortExist(svc *corev1.Service, port int32) bool {
+	for _, p := range svc.Spec.Ports {
+		if p.Port == port {
+			return true
+		}
+	}
+	return false
+}
+
+// setStatus writes conditions Accepted and ResolvedRefs of route for each gateway of bfe
+func (r *HTTPRouteReconciler) setStatus(ctx context.Context, route *gatewayv1alpha2.HTTPRoute, parents []routeParent, refErr *refError, err error) {
+	log := log.FromContext(ctx)
+
+	// invalid backendRefs fail the route, they are reported by both Accepted and ResolvedRefs
+	var e *refError
+	if errors.As(err, &e) {
+		refErr = e
+	}
+
+	var statuses []gatewayv1alpha2.RouteParentStatus
+	for _, s := range route.Status.Parents {
+		if s.ControllerName != controllerName() {
+			statuses = append(statuses, s)
+		}
+	}
+
+	for _, parent := range parents {
+		conditions := lastConditions(route, parent.ref)
+
+		accepted := newCondition(route, string(gatewayv1alpha2.ConditionRouteAccepted), true, routeReasonAccepted, "Route is accepted")
+		if len(parent.reason) > 0 {
+			accepted = newCondition(route, string(gatewayv1alpha2.ConditionRouteAccepted), false, parent.reason, parent.message)
+		} else if err != nil {
+			accepted = newCondition(route, string(gatewayv1alpha2.ConditionRouteAccepted), false, routeReasonUnsupportedValue, err.Error())
+		}
+		meta.SetStatusCondition(&conditions, accepted)
+
+		resolved := newCondition(route, string(gatewayv1alpha2.ConditionRouteResolvedRefs), true, routeReasonResolvedRefs, "References are resolved")
+		if refErr != nil {
+			resolved = newCondition(route, string(gatewayv1alpha2.ConditionRouteResolvedRefs), false, refErr.reason, refErr.msg)
+		}
+		meta.SetStatusCondition(&conditions, resolved)
+
+		statuses = append(statuses, gatewayv1alpha2.RouteParentStatus{
+			ParentRef:      parent.ref,
+			ControllerName: controllerName(),
+			Conditions:     conditions,
+		})
+	}
+
+	if reflect.DeepEqual(statuses, route.Status.Parents) {
+		return
+	}
+
+	route.Status.Parents = statuses
+	if err := r.Status().Update(ctx, route); err != nil {
+		log.Error(err, "fail to update httproute status")
+	}
+}
+
+// lastConditions returns copy of conditions of route written for parentRef
+func lastConditions(route *gatewayv1alpha2.HTTPRoute, ref gatewayv1alpha2.ParentRef) []metav1.Condition {
+	for _, s := range route.Status.Parents {
+		if s.ControllerName == controllerName() && reflect.DeepEqual(s.ParentRef, ref) {
+			return append([]metav1.Condition{}, s.Conditions...)
+		}
+	}
+	return nil
+}
+
+func (r *HTTPRouteReconciler) setupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&gatewayv1alpha2.HTTPRoute{}, builder.WithPredicates(filter.NamespaceFilter())).
+		Watches(&source.Channel{Source: r.resync.events}, &handler.EnqueueRequestForObject{}).
+		Watches(
+			&source.Kind{Type: &gatewayv1alpha2.Gateway{}},
+			handler.EnqueueRequestsFromMapFunc(r.gatewayRoutes),
+		).
+		Watches(
+			&source.Kind{Type: &gatewayv1alpha2.GatewayClass{}},
+			handler.EnqueueRequestsFromMapFunc(r.gatewayClassRoutes),
+		).
+		Watches(
+			&source.Kind{Type: &corev1.Service{}},
+			handler.EnqueueRequestsFromMapFunc(r.serviceRoutes),
+			builder.WithPredicates(filter.NamespaceFilter()),
+		).
+		Complete(r)
+}
+
+// gatewayRoutes returns routes referencing gateway
+func (r *HTTPRouteReconciler) gatewayRoutes(obj client.Object) []reconcile.Request {
+	return r.routes(func(route *gatewayv1alpha2.HTTPRoute) bool {
+		for _, ref := range route.Spec.ParentRefs {
+			if key, ok := parentGateway(route.Namespace, ref); ok && key == client.ObjectKeyFromObject(obj) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// gatewayClassRoutes returns routes referencing gateways of class
+func (r *HTTPRouteReconciler) gatewayClassRoutes(obj client.Object) []reconcile.Request {
+	gatewayList := &gatewayv1alpha2.GatewayList{}
+	if err := r.List(context.Background(), gatewayList); err != nil {
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for i := range gatewayList.Items {
+		if string(gatewayList.Items[i].Spec.GatewayClassName) == obj.GetName() {
+			requests = append(requests, r.gatewayRoutes(&gatewayList.Items[i])...)
+		}
+	}
+	return requests
+}
+
+// serviceRoutes returns routes referencing service by backendRefs
+func (r *HTTPRouteReconciler) serviceRoutes(obj client.Object) []reconcile.Request {
+	return r.routes(func(route *gatewayv1alpha2.HTTPRoute) bool {
+		if route.Namespace != obj.GetNamespace() {
+			return false
+		}
+		for _, rule := range route.Spec.Rules {
+			for _, ref := range rule.BackendRefs {
+				if string(ref.Name) == obj.GetName() {
+					return true
+				}
+			}
+		}
+		return false
+	})
+}
+
+// routes returns requests of routes selected by fn
+func (r *HTTPRouteReconciler) routes(fn func(route *gatewayv1alpha2.HTTPRoute) bool) []reconcile.Request {
+	routeList := &gatewayv1alpha2.HTTPRouteList{}
+	if err := r.List(context.Background(), routeList); err != nil {
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for i := range routeList.Items {
+		if fn(&routeList.Items[i]) {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&routeList.Items[i])})
+		}
+	}
+	return requests
+}
@@ -0,0 +1,470 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	netv1 "k8s.io/api/networking/v1"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+
+	"github.com/bfenetworks/ingress-bfe/internal/bfeConfig/annotations"
+	"github.com/bfenetworks/ingress-bfe/internal/bfeConfig/configs"
+)
+
+const (
+	// noBackend is placeholder backend of rules without backendRefs or with backendRefs of weight 0,
+	// it is unresolved like services not found, so requests are responded with 500
+	noBackend = "_none"
+	// weightedBackend is virtual backend in balance annotation, for rules with multiple backendRefs
+	weightedBackend = "_weighted"
+
+	// protocol conditions of route rules, if a route is attached to listeners of different protocols
+	httpCondition  = "!req_proto_secure()"
+	httpsCondition = "req_proto_secure()"
+)
+
+// hostGroup is hostnames of a route on attached listeners of the same protocol
+type hostGroup struct {
+	// hostnames of route rules, "" matches any host
+	hostnames []string
+	// condition of listener protocol, empty if hostnames are served by both HTTP and HTTPS listeners
+	condition string
+	// scheme of listeners, empty if hostnames are served by both HTTP and HTTPS listeners
+	scheme string
+}
+
+// refError is error of backend reference, it is reported in condition ResolvedRefs of route
+type refError struct {
+	reason string
+	msg    string
+}
+
+func (e *refError) Error() string {
+	return e.msg
+}
+
+// routeBackend is a service referenced by backendRefs of route
+type routeBackend struct {
+	name string
+	port int32
+}
+
+// newHostGroups groups hostnames of route on listeners by protocol.
+// If hostnames on HTTP and HTTPS listeners are the same, they are not distinguished by protocol.
+func newHostGroups(http, https []string) []hostGroup {
+	http, https = uniqueHostnames(http), uniqueHostnames(https)
+
+	if equalHostnames(http, https) {
+		if len(http) == 0 {
+			return nil
+		}
+		return []hostGroup{{hostnames: http}}
+	}
+
+	var groups []hostGroup
+	if len(http) > 0 {
+		groups = append(groups, hostGroup{hostnames: http, condition: httpCondition, scheme: "http"})
+	}
+	if len(https) > 0 {
+		groups = append(groups, hostGroup{hostnames: https, condition: httpsCondition, scheme: "https"})
+	}
+	return groups
+}
+
+// uniqueHostnames sorts and removes duplicated hostnames, hostname "" covers all others
+func uniqueHostnames(hostnames []string) []string {
+	found := make(map[string]bool)
+	var result []string
+	for _, host := range hostnames {
+		if len(host) == 0 {
+			return []string{""}
+		}
+		if !found[host] {
+			found[host] = true
+			result = append(result, host)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func equalHostnames(hostnames1, hostnames2 []string) bool {
+	if len(hostnames1) != len(hostnames2) {
+		return false
+	}
+	for i := range hostnames1 {
+		if hostnames1[i] != hostnames2[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// intersectHostnames returns hostnames of route which are matched by hostname of listener.
+// It returns [""] if both are not specified, which matches any host.
+func intersectHostnames(listener *gatewayv1alpha2.Hostname, route []gatewayv1alpha2.Hostname) []string {
+	listenerHost := ""
+	if listener != nil {
+		listenerHost = strings.ToLower(string(*listener))
+	}
+
+	if len(route) == 0 {
+		return []string{listenerHost}
+	}
+
+	var hostnames []string
+	for _, h := range route {
+		routeHost := strings.ToLower(string(h))
+		switch {
+		case len(listenerHost) == 0 || listenerHost == routeHost:
+			hostnames = append(hostnames, routeHost)
+		case matchWildcard(listenerHost, routeHost):
+			hostnames = append(hostnames, routeHost)
+		case matchWildcard(routeHost, listenerHost):
+			hostnames = append(hostnames, listenerHost)
+		}
+	}
+	return hostnames
+}
+
+// matchWildcard returns true if wildcard hostname matches host, which is more specific
+func matchWildcard(wildcard, host string) bool {
+	if !strings.HasPrefix(wildcard, "*.") {
+		return false
+	}
+	return strings.HasSuffix(host, wildcard[1:]) && len(host) > len(wildcard)-1
+}
+
+// routeRules converts HTTPRoute to route rules, one rule for each match of rules in each host group.
+// It returns backends referenced by route, errors of backendRefs are returned as *refError.
+func routeRules(route *gatewayv1alpha2.HTTPRoute, groups []hostGroup) ([]configs.RouteRule, []routeBackend, error) {
+	var rules []configs.RouteRule
+	var backends []routeBackend
+
+	for _, rule := range route.Spec.Rules {
+		backend, balance, refs, err := ruleBackend(route.Namespace, rule.BackendRefs)
+		if err != nil {
+			return nil, nil, err
+		}
+		backends = append(backends, refs...)
+
+		matches := rule.Matches
+		if len(matches) == 0 {
+			matches = []gatewayv1alpha2.HTTPRouteMatch{{}}
+		}
+
+		for _, group := range groups {
+			filters, redirect, err := ruleFilters(rule.Filters, group.scheme)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			for _, match := range matches {
+				routeRule, err := matchRule(match, group)
+				if err != nil {
+					return nil, nil, err
+				}
+
+				for key, value := range filters {
+					routeRule.Annotations[key] = value
+				}
+				if len(balance) > 0 {
+					routeRule.Annotations[annotations.WeightAnnotation] = balance
+				}
+				routeRule.Path.Backend.Service = backend.DeepCopy()
+				routeRule.Redirect = redirect
+
+				rules = append(rules, routeRule)
+			}
+		}
+	}
+
+	return rules, backends, nil
+}
+
+// matchRule returns route rule for hostnames of group, whose path and annotations are from match
+func matchRule(match gatewayv1alpha2.HTTPRouteMatch, group hostGroup) (configs.RouteRule, error) {
+	rule := configs.RouteRule{
+		Hosts:       group.hostnames,
+		Annotations: make(map[string]string),
+	}
+
+	path, err := matchPath(match.Path)
+	if err != nil {
+		return rule, err
+	}
+	rule.Path = *path
+	if *path.PathType == netv1.PathTypeImplementationSpecific {
+		rule.Annotations[annotations.UseRegexAnnotation] = "true"
+	}
+
+	if match.Method != nil {
+		rule.Annotations[annotations.MethodAnnotation] = string(*match.Method)
+	}
+
+	conditions, err := matchConditions(match)
+	if err != nil {
+		return rule, err
+	}
+	if len(group.condition) > 0 {
+		conditions = append([]string{group.condition}, conditions...)
+	}
+	if len(conditions) > 0 {
+		rule.Annotations[annotations.ConditionAnnotation] = strings.Join(conditions, " && ")
+	}
+
+	return rule, nil
+}
+
+// matchPath converts path match to ingress path, regular expression is converted to ImplementationSpecific path.
+// Default path match is prefix "/".
+func matchPath(match *gatewayv1alpha2.HTTPPathMatch) (*netv1.HTTPIngressPath, error) {
+	pathType := netv1.PathTypePrefix
+	value := "/"
+	if match != nil {
+		if match.Value != nil {
+			value = *match.Value
+		}
+		if match.Type != nil {
+			switch *match.Type {
+			case gatewayv1alpha2.PathMatchExact:
+				pathType = netv1.PathTypeExact
+			case gatewayv1alpha2.PathMatchPathPrefix:
+				pathType = netv1.PathTypePrefix
+			case gatewayv1alpha2.PathMatchRegularExpression:
+				pathType = netv1.PathTypeImplementationSpecific
+			default:
+				return nil, fmt.Errorf("path match type %s is not supported", *match.Type)
+			}
+		}
+	}
+
+	return &netv1.HTTPIngressPath{Path: value, PathType: &pathType}, nil
+}
+
+// matchConditions converts header and query param matches to bfe condition primitives
+func matchConditions(match gatewayv1alpha2.HTTPRouteMatch) ([]string, error) {
+	var conditions []string
+
+	for _, header := range match.Headers {
+		regex := header.Type != nil && *header.Type == gatewayv1alpha2.HeaderMatchRegularExpression
+		primitive, err := valuePrimitive("req_header_value", string(header.Name), header.Value, regex)
+		if err != nil {
+			return nil, fmt.Errorf("header match %s is illegal: %s", header.Name, err)
+		}
+		conditions = append(conditions, primitive)
+	}
+
+	for _, query := range match.QueryParams {
+		regex := query.Type != nil && *query.Type == gatewayv1alpha2.QueryParamMatchRegularExpression
+		primitive, err := valuePrimitive("req_query_value", query.Name, query.Value, regex)
+		if err != nil {
+			return nil, fmt.Errorf("query param match %s is illegal: %s", query.Name, err)
+		}
+		conditions = append(conditions, primitive)
+	}
+
+	return conditions, nil
+}
+
+// valuePrimitive returns primitive matching value of header or query param.
+// Bfe condition does not unescape strings, so exact value which can not be quoted is matched by regular expression.
+func valuePrimitive(primitive, name, value string, regex bool) (string, error) {
+	if strings.ContainsAny(name, `"\`) {
+		return "", fmt.Errorf("name should not contain '\"' or '\\'")
+	}
+
+	if !regex {
+		if !strings.ContainsAny(value, `"\|`) {
+			return fmt.Sprintf(`%s_in("%s", "%s", false)`, primitive, name, value), nil
+		}
+		value = "^" + regexp.QuoteMeta(value) + "$"
+	}
+
+	if strings.Contains(value, "`") {
+		return "", fmt.Errorf("regular expression should not contain '`'")
+	}
+	if _, err := regexp.Compile(value); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s_regmatch(\"%s\", `%s`)", primitive, name, value), nil
+}
+
+// ruleFilters converts filters of rule to annotations and redirect, scheme is used by redirect filter with hostname
+func ruleFilters(filters []gatewayv1alpha2.HTTPRouteFilter, scheme string) (map[string]string, *configs.Redirect, error) {
+	result := make(map[string]string)
+	var redirect *configs.Redirect
+	found := make(map[gatewayv1alpha2.HTTPRouteFilterType]bool)
+
+	for _, filter := range filters {
+		if found[filter.Type] {
+			return nil, nil, fmt.Errorf("filter %s should be specified at most once", filter.Type)
+		}
+		found[filter.Type] = true
+
+		var err error
+		switch filter.Type {
+		case gatewayv1alpha2.HTTPRouteFilterRequestHeaderModifier:
+			if filter.RequestHeaderModifier == nil {
+				return nil, nil, fmt.Errorf("filter %s is empty", filter.Type)
+			}
+			err = headerAnnotations(filter.RequestHeaderModifier, result)
+		case gatewayv1alpha2.HTTPRouteFilterRequestRedirect:
+			if filter.RequestRedirect == nil {
+				return nil, nil, fmt.Errorf("filter %s is empty", filter.Type)
+			}
+			redirect, err = ruleRedirect(filter.RequestRedirect, scheme)
+		default:
+			err = fmt.Errorf("filter %s is not supported", filter.Type)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return result, redirect, nil
+}
+
+// headerAnnotations converts request header modifier to annotations header.request.*
+func headerAnnotations(filter *gatewayv1alpha2.HTTPRequestHeaderFilter, result map[string]string) error {
+	for key, headers := range map[string][]gatewayv1alpha2.HTTPHeader{
+		annotations.RequestHeaderSetAnnotation: filter.Set,
+		annotations.RequestHeaderAddAnnotation: filter.Add,
+	} {
+		if len(headers) == 0 {
+			continue
+		}
+		values := make(map[string]string)
+		for _, header := range headers {
+			values[string(header.Name)] = header.Value
+		}
+		value, err := json.Marshal(values)
+		if err != nil {
+			return err
+		}
+		result[key] = string(value)
+	}
+
+	if len(filter.Remove) > 0 {
+		result[annotations.RequestHeaderDeleteAnnotation] = strings.Join(filter.Remove, ",")
+	}
+
+	return nil
+}
+
+// ruleRedirect converts request redirect to redirect of route rule.
+// Redirect to other hostname needs scheme, which is scheme of listeners if not specified by filter.
+func ruleRedirect(filter *gatewayv1alpha2.HTTPRequestRedirectFilter, scheme string) (*configs.Redirect, error) {
+	redirect := &configs.Redirect{}
+	if filter.Scheme != nil {
+		scheme = *filter.Scheme
+	}
+
+	switch {
+	case filter.Hostname != nil:
+		if len(scheme) == 0 {
+			return nil, fmt.Errorf("scheme of redirect should be specified, as route is attached to both HTTP and HTTPS listeners")
+		}
+		redirect.URLPrefix = scheme + "://" + string(*filter.Hostname)
+		if filter.Port != nil && !defaultPort(scheme, int32(*filter.Port)) {
+			redirect.URLPrefix += ":" + strconv.Itoa(int(*filter.Port))
+		}
+
+	case filter.Port != nil:
+		return nil, fmt.Errorf("redirect with port but without hostname is not supported")
+
+	case filter.Scheme != nil:
+		redirect.Scheme = *filter.Scheme
+
+	default:
+		return nil, fmt.Errorf("redirect should specify scheme or hostname")
+	}
+
+	if filter.StatusCode != nil {
+		redirect.StatusCode = *filter.StatusCode
+	}
+
+	return redirect, nil
+}
+
+func defaultPort(scheme string, port int32) bool {
+	return (scheme == "http" && port == 80) || (scheme == "https" && port == 443)
+}
+
+// ruleBackend converts backendRefs of rule to ingress backend.
+// Multiple backendRefs are converted to a virtual backend with balance annotation, they should have the same port.
+func ruleBackend(namespace string, refs []gatewayv1alpha2.HTTPBackendRef) (*netv1.IngressServiceBackend, string, []routeBackend, error) {
+	var backends []routeBackend
+	weights := make(map[string]int)
+	var port int32
+	sum := 0
+
+	for _, ref := range refs {
+		if err := checkBackendRef(namespace, &ref.BackendObjectReference); err != nil {
+			return nil, "", nil, err
+		}
+		if len(ref.Filters) > 0 {
+			return nil, "", nil, fmt.Errorf("filters of backendRef are not supported")
+		}
+
+		backend := routeBackend{name: string(ref.Name), port: int32(*ref.Port)}
+		if len(backends) > 0 && backend.port != port {
+			return nil, "", nil, fmt.Errorf("backendRefs of a rule should have the same port")
+		}
+		port = backend.port
+		backends = append(backends, backend)
+
+		weight := 1
+		if ref.Weight != nil {
+			weight = int(*ref.Weight)
+		}
+		weights[backend.name] += weight
+		sum += weight
+	}
+
+	if sum == 0 {
+		return &netv1.IngressServiceBackend{Name: noBackend, Port: netv1.ServiceBackendPort{Number: 80}}, "", backends, nil
+	}
+
+	if len(weights) == 1 {
+		return &netv1.IngressServiceBackend{Name: backends[0].name, Port: netv1.ServiceBackendPort{Number: port}}, "", backends, nil
+	}
+
+	balance, err := json.Marshal(annotations.Balance{weightedBackend: weights})
+	if err != nil {
+		return nil, "", nil, err
+	}
+	return &netv1.IngressServiceBackend{Name: weightedBackend, Port: netv1.ServiceBackendPort{Number: port}}, string(balance), backends, nil
+}
+
+// checkBackendRef checks backendRef is a service in namespace of route, with port specified
+func checkBackendRef(namespace string, ref *gatewayv1alpha2.BackendObjectReference) error {
+	if (ref.Group != nil && len(*ref.Group) > 0) || (ref.Kind != nil && *ref.Kind != "Service") {
+		return &refError{reason: routeReasonInvalidKind, msg: fmt.Sprintf("backendRef %s is not a Service", ref.Name)}
+	}
+	if ref.Namespace != nil && string(*ref.Namespace) != namespace {
+		return &refError{reason: routeReasonRefNotPermitted, msg: fmt.Sprintf("backendRef %s/%s is not in namespace of route", *ref.Namespace, ref.Name)}
+	}
+	if ref.Port == nil {
+		return &refError{reason: routeReasonBackendNotFound, msg: fmt.Sprintf("port of backendRef %s is not specified", ref.Name)}
+	}
+	return nil
+}
@@ -0,0 +1,326 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gateway
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	netv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+
+	"github.com/bfenetworks/ingress-bfe/internal/bfeConfig/annotations"
+	"github.com/bfenetworks/ingress-bfe/internal/bfeConfig/configs"
+)
+
+func hostname(h string) *gatewayv1alpha2.Hostname {
+	host := gatewayv1alpha2.Hostname(h)
+	return &host
+}
+
+func Test_intersectHostnames(t *testing.T) {
+	tests := []struct {
+		name     string
+		listener *gatewayv1alpha2.Hostname
+		route    []gatewayv1alpha2.Hostname
+		want     []string
+	}{
+		{
+			name: "any host",
+			want: []string{""},
+		},
+		{
+			name:     "listener host",
+			listener: hostname("foo.com"),
+			want:     []string{"foo.com"},
+		},
+		{
+			name:  "route hosts",
+			route: []gatewayv1alpha2.Hostname{"foo.com", "*.bar.com"},
+			want:  []string{"foo.com", "*.bar.com"},
+		},
+		{
+			name:     "wildcard listener",
+			listener: hostname("*.foo.com"),
+			route:    []gatewayv1alpha2.Hostname{"a.foo.com", "foo.com", "a.bar.com", "*.a.foo.com"},
+			want:     []string{"a.foo.com", "*.a.foo.com"},
+		},
+		{
+			name:     "wildcard route",
+			listener: hostname("a.foo.com"),
+			route:    []gatewayv1alpha2.Hostname{"*.foo.com", "*.bar.com"},
+			want:     []string{"a.foo.com"},
+		},
+		{
+			name:     "no match",
+			listener: hostname("foo.com"),
+			route:    []gatewayv1alpha2.Hostname{"bar.com"},
+			want:     nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := intersectHostnames(tt.listener, tt.route); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("intersectHostnames() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_newHostGroups(t *testing.T) {
+	groups := newHostGroups([]string{"foo.com", "bar.com"}, []string{"bar.com", "foo.com", "foo.com"})
+	if len(groups) != 1 || len(groups[0].condition) > 0 || !reflect.DeepEqual(groups[0].hostnames, []string{"bar.com", "foo.com"}) {
+		t.Errorf("newHostGroups() = %v, want one group without protocol condition", groups)
+	}
+
+	groups = newHostGroups([]string{"foo.com", ""}, []string{"foo.com"})
+	want := []hostGroup{
+		{hostnames: []string{""}, condition: httpCondition, scheme: "http"},
+		{hostnames: []string{"foo.com"}, condition: httpsCondition, scheme: "https"},
+	}
+	if !reflect.DeepEqual(groups, want) {
+		t.Errorf("newHostGroups() = %v, want %v", groups, want)
+	}
+
+	if groups := newHostGroups(nil, nil); groups != nil {
+		t.Errorf("newHostGroups() = %v, want nil", groups)
+	}
+}
+
+func Test_routeRules(t *testing.T) {
+	pathType := gatewayv1alpha2.PathMatchPathPrefix
+	regexType := gatewayv1alpha2.QueryParamMatchRegularExpression
+	method := gatewayv1alpha2.HTTPMethodGet
+	port := gatewayv1alpha2.PortNumber(8080)
+	weight := int32(3)
+
+	route := &gatewayv1alpha2.HTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "route"},
+		Spec: gatewayv1alpha2.HTTPRouteSpec{
+			Rules: []gatewayv1alpha2.HTTPRouteRule{
+				{
+					Matches: []gatewayv1alpha2.HTTPRouteMatch{
+						{
+							Path:        &gatewayv1alpha2.HTTPPathMatch{Type: &pathType, Value: stringPtr("/foo")},
+							Headers:     []gatewayv1alpha2.HTTPHeaderMatch{{Name: "X-Env", Value: "canary"}},
+							QueryParams: []gatewayv1alpha2.HTTPQueryParamMatch{{Type: &regexType, Name: "id", Value: "^[0-9]+$"}},
+							Method:      &method,
+						},
+					},
+					Filters: []gatewayv1alpha2.HTTPRouteFilter{
+						{
+							Type: gatewayv1alpha2.HTTPRouteFilterRequestHeaderModifier,
+							RequestHeaderModifier: &gatewayv1alpha2.HTTPRequestHeaderFilter{
+								Set:    []gatewayv1alpha2.HTTPHeader{{Name: "X-Route", Value: "route"}},
+								Remove: []string{"X-Debug"},
+							},
+						},
+					},
+					BackendRefs: []gatewayv1alpha2.HTTPBackendRef{
+						{BackendRef: gatewayv1alpha2.BackendRef{BackendObjectReference: gatewayv1alpha2.BackendObjectReference{Name: "svc1", Port: &port}}},
+						{BackendRef: gatewayv1alpha2.BackendRef{BackendObjectReference: gatewayv1alpha2.BackendObjectReference{Name: "svc2", Port: &port}, Weight: &weight}},
+					},
+				},
+				{
+					BackendRefs: []gatewayv1alpha2.HTTPBackendRef{
+						{BackendRef: gatewayv1alpha2.BackendRef{BackendObjectReference: gatewayv1alpha2.BackendObjectReference{Name: "svc1", Port: &port}}},
+					},
+				},
+			},
+		},
+	}
+
+	groups := newHostGroups([]string{"foo.com"}, []string{"bar.com"})
+	rules, backends, err := routeRules(route, groups)
+	if err != nil {
+		t.Fatalf("routeRules() error = %v", err)
+	}
+	if len(rules) != 4 || len(backends) != 3 {
+		t.Fatalf("routeRules() returns %d rules and %d backends, want 4 and 3", len(rules), len(backends))
+	}
+
+	rule := rules[0]
+	if !reflect.DeepEqual(rule.Hosts, []string{"foo.com"}) || rule.Redirect != nil {
+		t.Errorf("rule = %+v, want rule of host foo.com", rule)
+	}
+	path := rule.Path
+	if path.Path != "/foo" || *path.PathType != netv1.PathTypePrefix || path.Backend.Service.Name != weightedBackend || path.Backend.Service.Port.Number != 8080 {
+		t.Errorf("rule path = %v", path)
+	}
+
+	want := map[string]string{
+		annotations.MethodAnnotation:              "GET",
+		annotations.ConditionAnnotation:           "!req_proto_secure() && req_header_value_in(\"X-Env\", \"canary\", false) && req_query_value_regmatch(\"id\", `^[0-9]+$`)",
+		annotations.WeightAnnotation:              `{"_weighted":{"svc1":1,"svc2":3}}`,
+		annotations.RequestHeaderSetAnnotation:    `{"X-Route":"route"}`,
+		annotations.RequestHeaderDeleteAnnotation: "X-Debug",
+	}
+	if !reflect.DeepEqual(rule.Annotations, want) {
+		t.Errorf("rule annotations = %v, want %v", rule.Annotations, want)
+	}
+	if _, err := annotations.GetRouteExpression(rule.Annotations); err != nil {
+		t.Errorf("route expression is illegal: %v", err)
+	}
+	if _, err := annotations.GetBalance(rule.Annotations); err != nil {
+		t.Errorf("balance is illegal: %v", err)
+	}
+
+	rule = rules[3]
+	path = rule.Path
+	if !reflect.DeepEqual(rule.Hosts, []string{"bar.com"}) ||
+		path.Path != "/" || path.Backend.Service.Name != "svc1" || len(rule.Annotations) != 1 {
+		t.Errorf("rule of default match = %+v", rule)
+	}
+
+	// backendRef in other namespace
+	namespace := gatewayv1alpha2.Namespace("other")
+	route.Spec.Rules[1].BackendRefs[0].Namespace = &namespace
+	var refErr *refError
+	if _, _, err := routeRules(route, groups); !errors.As(err, &refErr) || refErr.reason != routeReasonRefNotPermitted {
+		t.Errorf("routeRules() error = %v, want RefNotPermitted", err)
+	}
+}
+
+func Test_ruleBackend(t *testing.T) {
+	port := gatewayv1alpha2.PortNumber(80)
+	zero := int32(0)
+
+	backend, balance, _, err := ruleBackend("ns", nil)
+	if err != nil || backend.Name != noBackend || len(balance) > 0 {
+		t.Errorf("ruleBackend() of no backendRefs = %v, %s, %v", backend, balance, err)
+	}
+
+	refs := []gatewayv1alpha2.HTTPBackendRef{
+		{BackendRef: gatewayv1alpha2.BackendRef{BackendObjectReference: gatewayv1alpha2.BackendObjectReference{Name: "svc", Port: &port}, Weight: &zero}},
+	}
+	if backend, _, _, _ := ruleBackend("ns", refs); backend.Name != noBackend {
+		t.Errorf("ruleBackend() of weight 0 = %v, want %s", backend, noBackend)
+	}
+
+	other := gatewayv1alpha2.PortNumber(8080)
+	refs = append(refs, gatewayv1alpha2.HTTPBackendRef{
+		BackendRef: gatewayv1alpha2.BackendRef{BackendObjectReference: gatewayv1alpha2.BackendObjectReference{Name: "svc2", Port: &other}},
+	})
+	if _, _, _, err := ruleBackend("ns", refs); err == nil {
+		t.Errorf("ruleBackend() should fail for different ports")
+	}
+
+	kind := gatewayv1alpha2.Kind("Bucket")
+	refs = []gatewayv1alpha2.HTTPBackendRef{
+		{BackendRef: gatewayv1alpha2.BackendRef{BackendObjectReference: gatewayv1alpha2.BackendObjectReference{Kind: &kind, Name: "bucket", Port: &port}}},
+	}
+	var refErr *refError
+	if _, _, _, err := ruleBackend("ns", refs); !errors.As(err, &refErr) || refErr.reason != routeReasonInvalidKind {
+		t.Errorf("ruleBackend() error = %v, want InvalidKind", err)
+	}
+}
+
+func Test_ruleRedirect(t *testing.T) {
+	port := gatewayv1alpha2.PortNumber(8443)
+	defaultPort := gatewayv1alpha2.PortNumber(443)
+	code := 301
+
+	tests := []struct {
+		name    string
+		filter  gatewayv1alpha2.HTTPRequestRedirectFilter
+		scheme  string
+		want    *configs.Redirect
+		wantErr bool
+	}{
+		{
+			name:   "scheme",
+			filter: gatewayv1alpha2.HTTPRequestRedirectFilter{Scheme: stringPtr("https"), StatusCode: &code},
+			want:   &configs.Redirect{Scheme: "https", StatusCode: 301},
+		},
+		{
+			name:   "hostname with scheme of listener",
+			filter: gatewayv1alpha2.HTTPRequestRedirectFilter{Hostname: hostname("foo.com"), Port: &port},
+			scheme: "https",
+			want:   &configs.Redirect{URLPrefix: "https://foo.com:8443"},
+		},
+		{
+			name:   "hostname with default port",
+			filter: gatewayv1alpha2.HTTPRequestRedirectFilter{Scheme: stringPtr("https"), Hostname: hostname("foo.com"), Port: &defaultPort},
+			want:   &configs.Redirect{URLPrefix: "https://foo.com"},
+		},
+		{
+			name:    "hostname without scheme",
+			filter:  gatewayv1alpha2.HTTPRequestRedirectFilter{Hostname: hostname("foo.com")},
+			wantErr: true,
+		},
+		{
+			name:    "port only",
+			filter:  gatewayv1alpha2.HTTPRequestRedirectFilter{Port: &port},
+			scheme:  "http",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ruleRedirect(&tt.filter, tt.scheme)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ruleRedirect() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ruleRedirect() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_valuePrimitive(t *testing.T) {
+	got, err := valuePrimitive("req_header_value", "X-Env", `a"b`, false)
+	if err != nil || got != "req_header_value_regmatch(\"X-Env\", `^a\"b$`)" {
+		t.Errorf("valuePrimitive() = %s, %v", got, err)
+	}
+
+	if _, err := valuePrimitive("req_header_value", "X-Env", "a`b", true); err == nil {
+		t.Errorf("valuePrimitive() should reject backquote")
+	}
+	if _, err := valuePrimitive("req_header_value", "X-Env", "(", true); err == nil {
+		t.Errorf("valuePrimitive() should reject illegal regular expression")
+	}
+}
+
+func Test_routeAllowed(t *testing.T) {
+	gateway := &gatewayv1alpha2.Gateway{ObjectMeta: metav1.ObjectMeta{Namespace: "gw"}}
+	listener := &gatewayv1alpha2.Listener{Name: "http", Protocol: gatewayv1alpha2.HTTPProtocolType}
+
+	if !routeAllowed(gateway, listener, "gw", nil) || routeAllowed(gateway, listener, "ns", nil) {
+		t.Errorf("routeAllowed() should allow routes in namespace of gateway by default")
+	}
+
+	from := gatewayv1alpha2.NamespacesFromSelector
+	listener.AllowedRoutes = &gatewayv1alpha2.AllowedRoutes{
+		Namespaces: &gatewayv1alpha2.RouteNamespaces{
+			From:     &from,
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"gateway": "bfe"}},
+		},
+	}
+	if !routeAllowed(gateway, listener, "ns", map[string]string{"gateway": "bfe"}) || routeAllowed(gateway, listener, "gw", nil) {
+		t.Errorf("routeAllowed() should allow routes in namespaces selected by labels")
+	}
+
+	listener.AllowedRoutes.Kinds = []gatewayv1alpha2.RouteGroupKind{{Kind: "TCPRoute"}}
+	if routeAllowed(gateway, listener, "ns", map[string]string{"gateway": "bfe"}) {
+		t.Errorf("routeAllowed() should check route kinds")
+	}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
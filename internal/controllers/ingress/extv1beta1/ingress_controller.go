@@ -24,20 +24,23 @@ import (
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	"github.com/bfenetworks/ingress-bfe/internal/bfeConfig"
 	"github.com/bfenetworks/ingress-bfe/internal/bfeConfig/annotations"
 	"github.com/bfenetworks/ingress-bfe/internal/controllers/event"
 	"github.com/bfenetworks/ingress-bfe/internal/controllers/filter"
 	controllerV1 "github.com/bfenetworks/ingress-bfe/internal/controllers/ingress/netv1"
+	"github.com/bfenetworks/ingress-bfe/internal/controllers/status"
 )
 
-func AddIngressController(mgr manager.Manager, cb *bfeConfig.ConfigBuilder) error {
-	reconciler := newIngressReconciler(mgr, cb)
+func AddIngressController(mgr manager.Manager, cb *bfeConfig.ConfigBuilder, publisher *status.Publisher) error {
+	reconciler := newIngressReconciler(mgr, cb, publisher)
 	if err := reconciler.setupWithManager(mgr); err != nil {
 		return fmt.Errorf("unable to create service controller")
 	}
@@ -48,15 +51,17 @@ func AddIngressController(mgr manager.Manager, cb *bfeConfig.ConfigBuilder) erro
 // IngressReconciler reconciles a extv1beta1 Ingress object
 type IngressReconciler struct {
 	BfeConfigBuilder *bfeConfig.ConfigBuilder
+	StatusPublisher  *status.Publisher
 
 	client.Client
 	Scheme   *runtime.Scheme
 	recorder record.EventRecorder
 }
 
-func newIngressReconciler(mgr manager.Manager, cb *bfeConfig.ConfigBuilder) *IngressReconciler {
+func newIngressReconciler(mgr manager.Manager, cb *bfeConfig.ConfigBuilder, publisher *status.Publisher) *IngressReconciler {
 	return &IngressReconciler{
 		BfeConfigBuilder: cb,
+		StatusPublisher:  publisher,
 		Client:           mgr.GetClient(),
 		Scheme:           mgr.GetScheme(),
 		recorder:         mgr.GetEventRecorderFor("bfe-ingress-controller"),
@@ -72,11 +77,15 @@ func (r *IngressReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 	err := r.Get(ctx, req.NamespacedName, ingressExtV1beta1)
 	if err != nil {
 		r.BfeConfigBuilder.DeleteIngress(req.Namespace, req.Name)
+		r.StatusPublisher.Forget(req.Namespace, req.Name)
 		log.V(1).Info("reconcile: ingress delete")
 		return reconcile.Result{}, nil
 	}
 
 	if !filter.IngressClassFilter(ctx, r, ingressExtV1beta1.Annotations, ingressExtV1beta1.Spec.IngressClassName) {
+		// ingress class may be changed, remove ingress if it was accepted before
+		r.BfeConfigBuilder.DeleteIngress(req.Namespace, req.Name)
+		r.StatusPublisher.Reject(ctx, ingressExtV1beta1)
 		return reconcile.Result{}, nil
 	}
 
@@ -86,12 +95,17 @@ func (r *IngressReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 	convert(ingressExtV1beta1, ingressV1)
 
 	err = controllerV1.ReconcileV1Ingress(ctx, r.Client, r.BfeConfigBuilder, ingressV1)
-	setStatus(ctx, r.Client, err, ingressExtV1beta1)
+	r.StatusPublisher.Accept(ctx, ingressExtV1beta1)
 
-	if err != nil {
-		r.recorder.Event(ingressExtV1beta1, corev1.EventTypeWarning, event.SyncFailed, err.Error())
-	} else {
-		r.recorder.Event(ingressExtV1beta1, corev1.EventTypeNormal, event.SyncSucceed, "Synced")
+	// only leader writes annotations and events
+	if r.StatusPublisher.Elected() {
+		setStatus(ctx, r.Client, err, ingressExtV1beta1)
+
+		if err != nil {
+			r.recorder.Event(ingressExtV1beta1, corev1.EventTypeWarning, event.SyncFailed, err.Error())
+		} else {
+			r.recorder.Event(ingressExtV1beta1, corev1.EventTypeNormal, event.SyncSucceed, "Synced")
+		}
 	}
 
 	return reconcile.Result{}, err
@@ -101,6 +115,8 @@ func (r *IngressReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 func (r *IngressReconciler) setupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&extv1beta1.Ingress{}, builder.WithPredicates(filter.NamespaceFilter())).
+		Watches(&source.Channel{Source: r.StatusPublisher.Resync()}, &handler.EnqueueRequestForObject{}).
+		Watches(r.BfeConfigBuilder.RequeueSource(), &handler.EnqueueRequestForObject{}).
 		Complete(r)
 }
 
@@ -18,27 +18,33 @@ import (
 	"strings"
 
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	netv1 "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	"github.com/bfenetworks/ingress-bfe/internal/bfeConfig"
 	"github.com/bfenetworks/ingress-bfe/internal/bfeConfig/annotations"
 	"github.com/bfenetworks/ingress-bfe/internal/bfeConfig/util"
+	"github.com/bfenetworks/ingress-bfe/internal/controllers/endpoint"
 	"github.com/bfenetworks/ingress-bfe/internal/controllers/event"
 	"github.com/bfenetworks/ingress-bfe/internal/controllers/filter"
+	"github.com/bfenetworks/ingress-bfe/internal/controllers/status"
 	"github.com/bfenetworks/ingress-bfe/internal/option"
 )
 
-func AddIngressController(mgr manager.Manager, cb *bfeConfig.ConfigBuilder) error {
-	reconciler := newIngressReconciler(mgr, cb)
+func AddIngressController(mgr manager.Manager, cb *bfeConfig.ConfigBuilder, publisher *status.Publisher) error {
+	reconciler := newIngressReconciler(mgr, cb, publisher)
 	if err := reconciler.setupWithManager(mgr); err != nil {
 		return fmt.Errorf("unable to create ingress controller")
 	}
@@ -49,15 +55,17 @@ func AddIngressController(mgr manager.Manager, cb *bfeConfig.ConfigBuilder) erro
 // IngressReconciler reconciles a netv1 Ingress object
 type IngressReconciler struct {
 	BfeConfigBuilder *bfeConfig.ConfigBuilder
+	StatusPublisher  *status.Publisher
 
 	client.Client
 	Scheme   *runtime.Scheme
 	recorder record.EventRecorder
 }
 
-func newIngressReconciler(mgr manager.Manager, cb *bfeConfig.ConfigBuilder) *IngressReconciler {
+func newIngressReconciler(mgr manager.Manager, cb *bfeConfig.ConfigBuilder, publisher *status.Publisher) *IngressReconciler {
 	return &IngressReconciler{
 		BfeConfigBuilder: cb,
+		StatusPublisher:  publisher,
 		Client:           mgr.GetClient(),
 		Scheme:           mgr.GetScheme(),
 		recorder:         mgr.GetEventRecorderFor("bfe-ingress-controller"),
@@ -73,23 +81,32 @@ func (r *IngressReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 	err := r.Get(ctx, req.NamespacedName, ingress)
 	if err != nil {
 		r.BfeConfigBuilder.DeleteIngress(req.Namespace, req.Name)
+		r.StatusPublisher.Forget(req.Namespace, req.Name)
 		log.V(1).Info("reconcile: ingress delete")
 		return reconcile.Result{}, nil
 	}
 
 	if !filter.IngressClassFilter(ctx, r, ingress.Annotations, ingress.Spec.IngressClassName) {
+		// ingress class may be changed, remove ingress if it was accepted before
+		r.BfeConfigBuilder.DeleteIngress(req.Namespace, req.Name)
+		r.StatusPublisher.Reject(ctx, ingress)
 		return reconcile.Result{}, nil
 	}
 
 	log.V(1).Info("reconcile: ingress object", "ingress", ingress)
 
 	err = ReconcileV1Ingress(ctx, r.Client, r.BfeConfigBuilder, ingress)
-	setStatus(ctx, r.Client, err, ingress)
+	r.StatusPublisher.Accept(ctx, ingress)
 
-	if err != nil {
-		r.recorder.Event(ingress, corev1.EventTypeWarning, event.SyncFailed, err.Error())
-	} else {
-		r.recorder.Event(ingress, corev1.EventTypeNormal, event.SyncSucceed, "Synced")
+	// only leader writes annotations and events
+	if r.StatusPublisher.Elected() {
+		setStatus(ctx, r.Client, err, ingress)
+
+		if err != nil {
+			r.recorder.Event(ingress, corev1.EventTypeWarning, event.SyncFailed, err.Error())
+		} else {
+			r.recorder.Event(ingress, corev1.EventTypeNormal, event.SyncSucceed, "Synced")
+		}
 	}
 
 	return reconcile.Result{}, err
@@ -99,6 +116,8 @@ func (r *IngressReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 func (r *IngressReconciler) setupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&netv1.Ingress{}, builder.WithPredicates(filter.NamespaceFilter())).
+		Watches(&source.Channel{Source: r.StatusPublisher.Resync()}, &handler.EnqueueRequestForObject{}).
+		Watches(r.BfeConfigBuilder.RequeueSource(), &handler.EnqueueRequestForObject{}).
 		Complete(r)
 }
 
@@ -138,7 +157,16 @@ func ReconcileV1Ingress(ctx context.Context, r client.Client, configBuilder *bfe
 		return err
 	}
 
-	if err = configBuilder.UpdateIngress(ingress, service, endpoints, secrets); err != nil {
+	configMaps, err := getIngressConfigMaps(ctx, r, ingress)
+	if err != nil {
+		configBuilder.DeleteIngress(ingress.Namespace, ingress.Name)
+		return err
+	}
+
+	weights := getEndpointWeights(ctx, r, endpoints)
+	probes := GetServiceProbes(ctx, r, endpoints)
+
+	if err = configBuilder.UpdateIngress(ingress, service, endpoints, weights, probes, secrets, configMaps); err != nil {
 		configBuilder.DeleteIngress(ingress.Namespace, ingress.Name)
 		return err
 	}
@@ -146,9 +174,9 @@ func ReconcileV1Ingress(ctx context.Context, r client.Client, configBuilder *bfe
 	return nil
 }
 
-func getIngressBackends(ctx context.Context, r client.Reader, ingress *netv1.Ingress) (map[string]*corev1.Service, map[string]*corev1.Endpoints, error) {
+func getIngressBackends(ctx context.Context, r client.Reader, ingress *netv1.Ingress) (map[string]*corev1.Service, map[string][]*discoveryv1.EndpointSlice, error) {
 	services := make(map[string]*corev1.Service)
-	endpoints := make(map[string]*corev1.Endpoints)
+	endpoints := make(map[string][]*discoveryv1.EndpointSlice)
 
 	if len(option.Opts.Ingress.DefaultBackend) > 0 {
 		if svc, ep, err := getDefaultBackends(ctx, r, option.Opts.Ingress.DefaultBackend); err == nil {
@@ -195,7 +223,7 @@ func getIngressBackends(ctx context.Context, r client.Reader, ingress *netv1.Ing
 	return services, endpoints, nil
 }
 
-func getDefaultBackends(ctx context.Context, r client.Reader, name string) (*corev1.Service, *corev1.Endpoints, error) {
+func getDefaultBackends(ctx context.Context, r client.Reader, name string) (*corev1.Service, []*discoveryv1.EndpointSlice, error) {
 	// name is in format of "namespace/name"
 	names := strings.Split(name, string(types.Separator))
 	svc := &corev1.Service{}
@@ -218,19 +246,96 @@ func getDefaultBackends(ctx context.Context, r client.Reader, name string) (*cor
 	return svc, ep, nil
 }
 
-func getEndpoint(ctx context.Context, r client.Reader, namespace string, name string) (*corev1.Endpoints, error) {
-	ep := &corev1.Endpoints{}
-	err := r.Get(ctx, client.ObjectKey{
-		Namespace: namespace,
-		Name:      name,
-	}, ep)
+// getEndpoint returns endpoint slices of service
+func getEndpoint(ctx context.Context, r client.Reader, namespace string, name string) ([]*discoveryv1.EndpointSlice, error) {
+	slices, err := endpoint.Get(ctx, r, namespace, name)
 	if err != nil {
 		return nil, err
 	}
-	if len(ep.Subsets) == 0 || len(ep.Subsets[0].Ports) == 0 {
-		return nil, fmt.Errorf("not endpoint found for service, %s/%s", namespace, name)
+	for _, slice := range slices {
+		if len(slice.Endpoints) > 0 && len(slice.Ports) > 0 {
+			return slices, nil
+		}
+	}
+	return nil, fmt.Errorf("not endpoint found for service, %s/%s", namespace, name)
+}
+
+// getEndpointWeights returns weights of endpoints of backend services, keyed by address
+func getEndpointWeights(ctx context.Context, r client.Reader, endpoints map[string][]*discoveryv1.EndpointSlice) map[string]int {
+	weights := make(map[string]int)
+	for _, slices := range endpoints {
+		for addr, weight := range endpoint.Weights(ctx, r, slices) {
+			weights[addr] = weight
+		}
+	}
+	return weights
+}
+
+// GetServiceProbes returns readiness probes of backend services keyed by service and the container port they check,
+// which are used as default health check of backends whose target port is the same.
+// Probes are got from a pod of the service.
+func GetServiceProbes(ctx context.Context, r client.Reader, endpoints map[string][]*discoveryv1.EndpointSlice) map[string]map[int32]*corev1.Probe {
+	probes := make(map[string]map[int32]*corev1.Probe)
+	for name, slices := range endpoints {
+		if portProbes := getEndpointProbes(ctx, r, slices); len(portProbes) > 0 {
+			probes[name] = portProbes
+		}
+	}
+	return probes
+}
+
+func getEndpointProbes(ctx context.Context, r client.Reader, slices []*discoveryv1.EndpointSlice) map[int32]*corev1.Probe {
+	for _, slice := range slices {
+		for _, ep := range slice.Endpoints {
+			if ep.TargetRef == nil || ep.TargetRef.Kind != "Pod" {
+				continue
+			}
+
+			pod := &corev1.Pod{}
+			err := r.Get(ctx, client.ObjectKey{Namespace: slice.Namespace, Name: ep.TargetRef.Name}, pod)
+			if err != nil {
+				log.FromContext(ctx).V(1).Info("fail to get pod of endpoints", "pod", ep.TargetRef.Name, "error", err.Error())
+				continue
+			}
+			return podProbes(pod)
+		}
+	}
+	return nil
+}
+
+// podProbes returns readiness probes of containers, keyed by port checked by probe
+func podProbes(pod *corev1.Pod) map[int32]*corev1.Probe {
+	probes := make(map[int32]*corev1.Probe)
+	for _, container := range pod.Spec.Containers {
+		probe := container.ReadinessProbe
+		if probe == nil {
+			continue
+		}
+
+		var port intstr.IntOrString
+		switch {
+		case probe.HTTPGet != nil:
+			port = probe.HTTPGet.Port
+		case probe.TCPSocket != nil:
+			port = probe.TCPSocket.Port
+		default:
+			continue
+		}
+
+		// resolve named port
+		if port.Type == intstr.String {
+			for _, p := range container.Ports {
+				if p.Name == port.StrVal {
+					port = intstr.FromInt(int(p.ContainerPort))
+				}
+			}
+		}
+
+		if port.Type == intstr.Int && port.IntVal > 0 {
+			probes[port.IntVal] = probe
+		}
 	}
-	return ep, nil
+	return probes
 }
 
 func getService(ctx context.Context, r client.Reader, namespace, name string, port netv1.ServiceBackendPort) (*corev1.Service, error) {
@@ -263,6 +368,19 @@ func getIngressSecret(ctx context.Context, r client.Reader, ingress *netv1.Ingre
 		secrets = append(secrets, secret)
 	}
 
+	// htpasswd data of basic auth
+	auth, err := annotations.GetAuthBasic(ingress.Annotations)
+	if err != nil {
+		return nil, err
+	}
+	if auth != nil {
+		secret, err := getSecret(ctx, r, ingress.Namespace, auth.Secret)
+		if err != nil {
+			return nil, err
+		}
+		secrets = append(secrets, secret)
+	}
+
 	return secrets, nil
 }
 
@@ -279,6 +397,27 @@ func getSecret(ctx context.Context, r client.Reader, namespace, name string) (*c
 	}
 }
 
+// getIngressConfigMaps returns configmaps referred by annotations of ingress
+func getIngressConfigMaps(ctx context.Context, r client.Reader, ingress *netv1.Ingress) ([]*corev1.ConfigMap, error) {
+	configMaps := make([]*corev1.ConfigMap, 0)
+
+	// rules of waf policy
+	waf, err := annotations.GetWaf(ingress.Annotations)
+	if err != nil {
+		return nil, err
+	}
+	if waf != nil && len(waf.Policy) > 0 {
+		configMap := &corev1.ConfigMap{}
+		err := r.Get(ctx, client.ObjectKey{Namespace: ingress.Namespace, Name: waf.Policy}, configMap)
+		if err != nil {
+			return nil, err
+		}
+		configMaps = append(configMaps, configMap)
+	}
+
+	return configMaps, nil
+}
+
 // set defaultBackend in ingress
 func setDefautBackend(ingress *netv1.Ingress, service *corev1.Service) {
 	if len(option.Opts.Ingress.DefaultBackend) == 0 || service == nil || len(service.Spec.Ports) == 0 {
@@ -19,12 +19,14 @@ import (
 	"fmt"
 
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
 	"github.com/bfenetworks/ingress-bfe/internal/bfeConfig"
 	"github.com/bfenetworks/ingress-bfe/internal/controllers/filter"
@@ -64,11 +66,17 @@ func (r *SecretReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 		Namespace: req.Namespace,
 		Name:      req.Name,
 	}, secret)
+	if apierrors.IsNotFound(err) {
+		r.BfeConfigBuilder.DeleteSecret(req.Namespace, req.Name)
+		return ctrl.Result{}, nil
+	}
 	if err != nil {
 		return ctrl.Result{}, nil
 	}
 
-	r.BfeConfigBuilder.UpdateSecret(secret)
+	if err := r.BfeConfigBuilder.UpdateSecret(secret); err != nil {
+		log.Error(err, "fail to update secret", "namespace", req.Namespace, "name", req.Name)
+	}
 
 	return ctrl.Result{}, nil
 }
@@ -76,6 +84,6 @@ func (r *SecretReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 // setupWithManager sets up the controller with the Manager.
 func (r *SecretReconciler) setupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&corev1.Secret{}, builder.WithPredicates(filter.NamespaceFilter())).
+		For(&corev1.Secret{}, builder.WithPredicates(predicate.Or(filter.NamespaceFilter(), filter.DefaultSSLCertificateFilter()))).
 		Complete(r)
 }
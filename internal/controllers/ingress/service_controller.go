@@ -19,6 +19,7 @@ import (
 	"fmt"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -31,6 +32,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	"github.com/bfenetworks/ingress-bfe/internal/bfeConfig"
+	"github.com/bfenetworks/ingress-bfe/internal/controllers/endpoint"
 	"github.com/bfenetworks/ingress-bfe/internal/controllers/filter"
 )
 
@@ -43,7 +45,8 @@ func AddServiceController(mgr manager.Manager, cb *bfeConfig.ConfigBuilder) erro
 	return nil
 }
 
-// ServiceReconciler reconciles a Service/Endpoints object
+// ServiceReconciler reconciles a Service/EndpointSlice object, or Service/Endpoints object for old clusters.
+// Pods are watched for change of their weights.
 type ServiceReconciler struct {
 	BfeConfigBuilder *bfeConfig.ConfigBuilder
 
@@ -72,16 +75,12 @@ func (r *ServiceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 		return ctrl.Result{}, nil
 	}
 
-	ep := &corev1.Endpoints{}
-	err = r.Get(ctx, client.ObjectKey{
-		Namespace: req.Namespace,
-		Name:      req.Name,
-	}, ep)
+	slices, err := endpoint.Get(ctx, r, req.Namespace, req.Name)
 	if err != nil {
 		return ctrl.Result{}, nil
 	}
 
-	r.BfeConfigBuilder.UpdateService(svc, ep)
+	r.BfeConfigBuilder.UpdateService(svc, slices, endpoint.Weights(ctx, r, slices))
 
 	return ctrl.Result{}, nil
 }
@@ -91,16 +90,37 @@ func (r *ServiceReconciler) setupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&corev1.Service{}, builder.WithPredicates(filter.NamespaceFilter())).
 		Watches(
-			&source.Kind{Type: &corev1.Endpoints{}},
+			&source.Kind{Type: endpoint.Object()},
 			handler.EnqueueRequestsFromMapFunc(func(a client.Object) []reconcile.Request {
-				return []reconcile.Request{
-					{NamespacedName: types.NamespacedName{
-						Name:      a.GetName(),
-						Namespace: a.GetNamespace(),
-					}},
+				service, ok := endpoint.ServiceKey(a)
+				if !ok {
+					return nil
 				}
+				return []reconcile.Request{{NamespacedName: service}}
 			}),
 			builder.WithPredicates(filter.NamespaceFilter()),
 		).
+		Watches(
+			&source.Kind{Type: &corev1.Pod{}},
+			handler.EnqueueRequestsFromMapFunc(r.podServices),
+			builder.WithPredicates(filter.NamespaceFilter(), filter.PodWeightFilter()),
+		).
 		Complete(r)
 }
+
+// podServices returns services selecting the pod
+func (r *ServiceReconciler) podServices(obj client.Object) []reconcile.Request {
+	serviceList := &corev1.ServiceList{}
+	if err := r.List(context.Background(), serviceList, client.InNamespace(obj.GetNamespace())); err != nil {
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, svc := range serviceList.Items {
+		if len(svc.Spec.Selector) == 0 || !labels.SelectorFromSet(svc.Spec.Selector).Matches(labels.Set(obj.GetLabels())) {
+			continue
+		}
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: svc.Namespace, Name: svc.Name}})
+	}
+	return requests
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/bfenetworks/ingress-bfe/internal/option"
+)
+
+const (
+	// monitor data of mod_waf in bfe
+	wafMonitor = "mod_waf"
+	// counter of requests hit by waf rules in detect mode
+	wafHitCheckedRule = "HIT_CHECKED_RULE"
+
+	monitorTimeout = time.Second
+)
+
+var (
+	log = ctrl.Log.WithName("metrics")
+)
+
+// bfeCounter reads a counter from monitor data of bfe when metrics are collected.
+// The last value is returned if bfe fails to respond, so the counter never decreases.
+type bfeCounter struct {
+	lock   sync.Mutex
+	module string
+	name   string
+	value  int64
+	client http.Client
+}
+
+func newBfeCounter(module, name string) *bfeCounter {
+	return &bfeCounter{
+		module: module,
+		name:   name,
+		client: http.Client{Timeout: monitorTimeout},
+	}
+}
+
+func (c *bfeCounter) get() float64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	value, err := c.fetch(option.Opts.Ingress.MonitorUrl + c.module)
+	if err != nil {
+		log.V(1).Info("fail to read monitor data of bfe", "module", c.module, "error", err.Error())
+	} else if value >= c.value {
+		c.value = value
+	}
+	return float64(c.value)
+}
+
+func (c *bfeCounter) fetch(url string) (int64, error) {
+	res, err := c.client.Get(url)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("monitor responds with status %d", res.StatusCode)
+	}
+
+	var data struct {
+		CounterData map[string]int64
+	}
+	if err := json.NewDecoder(res.Body).Decode(&data); err != nil {
+		return 0, err
+	}
+	value, ok := data.CounterData[c.name]
+	if !ok {
+		return 0, fmt.Errorf("counter %s not found", c.name)
+	}
+	return value, nil
+}
+
+// RegisterWafMetrics registers counter of requests hit by waf rules in detect mode,
+// which is served by metrics endpoint of controller
+func RegisterWafMetrics() error {
+	counter := newBfeCounter(wafMonitor, wafHitCheckedRule)
+	return metrics.Registry.Register(prometheus.NewCounterFunc(prometheus.CounterOpts{
+		Namespace: "bfe_ingress",
+		Name:      "waf_detected_requests_total",
+		Help:      "Number of requests hit by waf rules in detect mode.",
+	}, counter.get))
+}
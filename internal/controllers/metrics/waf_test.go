@@ -0,0 +1,60 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bfenetworks/ingress-bfe/internal/option"
+)
+
+func TestBfeCounter_get(t *testing.T) {
+	value := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/monitor/mod_waf" || value < 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprintf(w, `{"Prefix":"mod_waf","Kind":"total","CounterData":{"HIT_CHECKED_RULE":%d}}`, value)
+	}))
+	defer server.Close()
+
+	opts := option.NewOptions()
+	opts.Ingress.BfeBinary = ""
+	opts.Ingress.ReloadAddr = server.Listener.Addr().String()
+	if err := option.SetOptions(opts); err != nil {
+		t.Fatal(err)
+	}
+
+	counter := newBfeCounter(wafMonitor, wafHitCheckedRule)
+	for _, tt := range []struct {
+		value int
+		want  float64
+	}{
+		{value: 3, want: 3},
+		{value: 5, want: 5},
+		// last value is kept if bfe fails to respond
+		{value: -1, want: 5},
+		{value: 6, want: 6},
+	} {
+		value = tt.value
+		if got := counter.get(); got != tt.want {
+			t.Errorf("get() = %v, want %v", got, tt.want)
+		}
+	}
+}
@@ -24,15 +24,21 @@ import (
 
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
 
 	"github.com/bfenetworks/ingress-bfe/internal/bfeConfig"
+	"github.com/bfenetworks/ingress-bfe/internal/controllers/endpoint"
+	"github.com/bfenetworks/ingress-bfe/internal/controllers/gateway"
 	"github.com/bfenetworks/ingress-bfe/internal/controllers/ingress"
 	"github.com/bfenetworks/ingress-bfe/internal/controllers/ingress/extv1beta1"
 	"github.com/bfenetworks/ingress-bfe/internal/controllers/ingress/netv1"
 	"github.com/bfenetworks/ingress-bfe/internal/controllers/ingress/netv1beta1"
+	"github.com/bfenetworks/ingress-bfe/internal/controllers/metrics"
+	"github.com/bfenetworks/ingress-bfe/internal/controllers/status"
 	"github.com/bfenetworks/ingress-bfe/internal/option"
 )
 
@@ -47,9 +53,16 @@ func Start(scheme *runtime.Scheme) error {
 	}
 
 	mgr, err := ctrl.NewManager(config, ctrl.Options{
-		Scheme:                 scheme,
-		MetricsBindAddress:     option.Opts.MetricsAddr,
-		HealthProbeBindAddress: option.Opts.HealthProbeAddr,
+		Scheme:                     scheme,
+		MetricsBindAddress:         option.Opts.MetricsAddr,
+		HealthProbeBindAddress:     option.Opts.HealthProbeAddr,
+		LeaderElection:             option.Opts.LeaderElection,
+		LeaderElectionResourceLock: resourcelock.LeasesResourceLock,
+		LeaderElectionNamespace:    option.Opts.LeaderElectionNamespace,
+		LeaderElectionID:           option.Opts.LeaderElectionID,
+		LeaseDuration:              &option.Opts.LeaseDuration,
+		RenewDeadline:              &option.Opts.RenewDeadline,
+		RetryPeriod:                &option.Opts.RetryPeriod,
 	})
 	if err != nil {
 		return fmt.Errorf("unable to start controller manager: %s", err)
@@ -68,8 +81,18 @@ func Start(scheme *runtime.Scheme) error {
 	cb := bfeConfig.NewConfigBuilder()
 	cb.InitReload(ctx)
 
-	// add controller to watch ingress resource
-	if err := addController(cb, mgr); err != nil {
+	if err := metrics.RegisterWafMetrics(); err != nil {
+		return fmt.Errorf("unable to register waf metrics: %s", err)
+	}
+
+	// new publisher to write address of controller to ingress status
+	publisher := status.NewPublisher(mgr)
+	if err := mgr.Add(publisher); err != nil {
+		return fmt.Errorf("unable to add status publisher: %s", err)
+	}
+
+	// add controller to watch ingress resource, controllers run in all replicas to build local bfe config
+	if err := addController(cb, publisher, &replicaManager{mgr}); err != nil {
 		return err
 	}
 
@@ -90,23 +113,37 @@ func Start(scheme *runtime.Scheme) error {
 	return nil
 }
 
-func addController(cb *bfeConfig.ConfigBuilder, mgr manager.Manager) error {
+func addController(cb *bfeConfig.ConfigBuilder, publisher *status.Publisher, mgr manager.Manager) error {
 	client := discovery.NewDiscoveryClientForConfigOrDie(ctrl.GetConfigOrDie())
 	serverVersion, err := client.ServerVersion()
 	if err != nil {
 		return fmt.Errorf("unable to get k8s cluster version: %s", err)
 	}
 
+	// use EndpointSlice if served by cluster, otherwise Endpoints
+	if err := endpoint.Setup(client); err != nil {
+		return err
+	}
+	log.Info("backend discovery", "endpointSlice", endpoint.UseEndpointSlice())
+
+	// zone of controller is used by zone aware routing, cache of manager is not started yet
+	if err := endpoint.SetupZone(context.Background(), mgr.GetAPIReader()); err != nil {
+		return err
+	}
+	if option.Opts.Ingress.ZoneAwareRouting {
+		log.Info("zone aware routing", "zone", option.Opts.Ingress.Zone)
+	}
+
 	if serverVersion.Major >= "1" && serverVersion.Minor >= "19" {
-		if err = netv1.AddIngressController(mgr, cb); err != nil {
+		if err = netv1.AddIngressController(mgr, cb, publisher); err != nil {
 			return fmt.Errorf("unable to create controller Ingress(netwokingv1): %s", err)
 		}
 	} else if serverVersion.Major >= "1" && serverVersion.Minor >= "14" {
-		if err = netv1beta1.AddIngressController(mgr, cb); err != nil {
+		if err = netv1beta1.AddIngressController(mgr, cb, publisher); err != nil {
 			return fmt.Errorf("unable to create controller Ingress(netwokingv1beta1): %s", err)
 		}
 	} else {
-		if err = extv1beta1.AddIngressController(mgr, cb); err != nil {
+		if err = extv1beta1.AddIngressController(mgr, cb, publisher); err != nil {
 			return fmt.Errorf("unable to create controller Ingress(extensionsv1beta1): %s", err)
 		}
 	}
@@ -119,9 +156,53 @@ func addController(cb *bfeConfig.ConfigBuilder, mgr manager.Manager) error {
 		return fmt.Errorf("unable to create controller secret: %s", err)
 	}
 
+	if err := ingress.AddConfigMapController(mgr, cb); err != nil {
+		return fmt.Errorf("unable to create controller configmap: %s", err)
+	}
+
+	// resources of Gateway API are reconciled only if they are installed in cluster
+	if _, err := client.ServerResourcesForGroupVersion(gatewayv1alpha2.GroupVersion.String()); err != nil {
+		log.Info("gateway api is not served by cluster, skip gateway controllers", "groupVersion", gatewayv1alpha2.GroupVersion.String())
+		return nil
+	}
+
+	if err := gateway.AddGatewayClassController(mgr, publisher); err != nil {
+		return fmt.Errorf("unable to create controller GatewayClass: %s", err)
+	}
+
+	if err := gateway.AddGatewayController(mgr, cb, publisher); err != nil {
+		return fmt.Errorf("unable to create controller Gateway: %s", err)
+	}
+
+	if err := gateway.AddHTTPRouteController(mgr, cb, publisher); err != nil {
+		return fmt.Errorf("unable to create controller HTTPRoute: %s", err)
+	}
+
 	return nil
 }
 
+// replicaManager adds runnables which run in every replica, no matter whether it is elected as leader
+type replicaManager struct {
+	manager.Manager
+}
+
+func (m *replicaManager) Add(r manager.Runnable) error {
+	// inject dependencies into runnable, as they are not injected through wrapper
+	if err := m.Manager.SetFields(r); err != nil {
+		return err
+	}
+	return m.Manager.Add(&replicaRunnable{r})
+}
+
+type replicaRunnable struct {
+	manager.Runnable
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable
+func (r *replicaRunnable) NeedLeaderElection() bool {
+	return false
+}
+
 func startBFE(ctx context.Context) error {
 	cmd := exec.Command(option.Opts.Ingress.BfeBinary, "-c", "../conf", "-l", "../log", "-s")
 	cmd.Dir = filepath.Dir(option.Opts.Ingress.BfeBinary)
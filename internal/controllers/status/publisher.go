@@ -0,0 +1,361 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package status
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	extv1beta1 "k8s.io/api/extensions/v1beta1"
+	netv1 "k8s.io/api/networking/v1"
+	netv1beta1 "k8s.io/api/networking/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	"github.com/bfenetworks/ingress-bfe/internal/controllers/endpoint"
+	"github.com/bfenetworks/ingress-bfe/internal/option"
+)
+
+var (
+	log = ctrl.Log.WithName("status")
+)
+
+// Publisher writes address of bfe ingress controller to status.loadBalancer of accepted ingresses.
+// If leader election is enabled, only the leader writes status.
+type Publisher struct {
+	client.Client
+
+	elected <-chan struct{}
+	resync  chan event.GenericEvent
+
+	lock sync.Mutex
+	// accepted ingress -> last accepted object
+	ingresses map[types.NamespacedName]client.Object
+}
+
+func NewPublisher(mgr manager.Manager) *Publisher {
+	return &Publisher{
+		Client:    mgr.GetClient(),
+		elected:   mgr.Elected(),
+		resync:    make(chan event.GenericEvent),
+		ingresses: make(map[types.NamespacedName]client.Object),
+	}
+}
+
+// Elected returns true if this replica is allowed to write status, annotations and events of ingress
+func (p *Publisher) Elected() bool {
+	select {
+	case <-p.elected:
+		return true
+	default:
+		return false
+	}
+}
+
+// Resync returns channel of accepted ingresses, which should be reconciled again after this replica is elected
+func (p *Publisher) Resync() <-chan event.GenericEvent {
+	return p.resync
+}
+
+// enabled returns true if address of controller is configured
+func enabled() bool {
+	return len(option.Opts.Ingress.PublishService) > 0 || len(option.Opts.Ingress.PublishStatusAddress) > 0
+}
+
+// Start implements manager.Runnable, it is started after this replica is elected.
+// All accepted ingresses are reconciled again to write their status, then status is synced periodically.
+func (p *Publisher) Start(ctx context.Context) error {
+	for _, ingress := range p.accepted() {
+		select {
+		case p.resync <- event.GenericEvent{Object: ingress}:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+
+	if !enabled() {
+		return nil
+	}
+
+	tick := time.NewTicker(option.Opts.Ingress.StatusSyncInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			p.sync(ctx)
+		case <-ctx.Done():
+			log.Info("exit status sync")
+			return nil
+		}
+	}
+}
+
+// Accept records ingress as accepted by controller, and updates its status
+func (p *Publisher) Accept(ctx context.Context, ingress client.Object) {
+	p.lock.Lock()
+	p.ingresses[client.ObjectKeyFromObject(ingress)] = ingress.DeepCopyObject().(client.Object)
+	p.lock.Unlock()
+
+	if !enabled() || !p.Elected() {
+		return
+	}
+
+	addresses, err := p.addresses(ctx)
+	if err != nil {
+		log.Error(err, "fail to get ingress address")
+		return
+	}
+	p.update(ctx, ingress, addresses)
+}
+
+// Reject clears status of ingress which is not accepted by controller anymore
+func (p *Publisher) Reject(ctx context.Context, ingress client.Object) {
+	key := client.ObjectKeyFromObject(ingress)
+	p.lock.Lock()
+	_, accepted := p.ingresses[key]
+	delete(p.ingresses, key)
+	p.lock.Unlock()
+
+	if !enabled() || !p.Elected() {
+		return
+	}
+
+	if !accepted {
+		// accepted before controller restarted, if status is written by controller
+		addresses, err := p.addresses(ctx)
+		if err != nil || !equalAddresses(loadBalancerIngress(ingress), addresses) {
+			return
+		}
+	}
+	p.update(ctx, ingress, nil)
+}
+
+// Forget removes deleted ingress
+func (p *Publisher) Forget(namespace, name string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	delete(p.ingresses, types.NamespacedName{Namespace: namespace, Name: name})
+}
+
+func (p *Publisher) sync(ctx context.Context) {
+	addresses, err := p.addresses(ctx)
+	if err != nil {
+		log.Error(err, "fail to get ingress address")
+		return
+	}
+
+	for _, ingress := range p.accepted() {
+		key := client.ObjectKeyFromObject(ingress)
+		if err := p.Get(ctx, key, ingress); err != nil {
+			if apierrors.IsNotFound(err) {
+				p.Forget(key.Namespace, key.Name)
+			}
+			continue
+		}
+		p.update(ctx, ingress, addresses)
+	}
+}
+
+// accepted returns copy of all accepted ingresses
+func (p *Publisher) accepted() []client.Object {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	ingresses := make([]client.Object, 0, len(p.ingresses))
+	for _, ingress := range p.ingresses {
+		ingresses = append(ingresses, ingress.DeepCopyObject().(client.Object))
+	}
+	return ingresses
+}
+
+func (p *Publisher) update(ctx context.Context, ingress client.Object, addresses []corev1.LoadBalancerIngress) {
+	if equalAddresses(loadBalancerIngress(ingress), addresses) {
+		return
+	}
+
+	patch := client.MergeFrom(ingress.DeepCopyObject().(client.Object))
+	setLoadBalancerIngress(ingress, addresses)
+	if err := p.Status().Patch(ctx, ingress, patch); err != nil {
+		log.Error(err, "fail to update status", "namespace", ingress.GetNamespace(), "name", ingress.GetName())
+	}
+}
+
+// Addresses returns address of controller, nil if neither publish-status-address nor publish-service is configured
+func (p *Publisher) Addresses(ctx context.Context) ([]corev1.LoadBalancerIngress, error) {
+	if !enabled() {
+		return nil, nil
+	}
+	return p.addresses(ctx)
+}
+
+// addresses returns address of controller, which is from publish-status-address or publish-service
+func (p *Publisher) addresses(ctx context.Context) ([]corev1.LoadBalancerIngress, error) {
+	if len(option.Opts.Ingress.PublishStatusAddress) > 0 {
+		return parseAddresses(option.Opts.Ingress.PublishStatusAddress), nil
+	}
+
+	names := strings.Split(option.Opts.Ingress.PublishService, string(types.Separator))
+	svc := &corev1.Service{}
+	if err := p.Get(ctx, client.ObjectKey{Namespace: names[0], Name: names[1]}, svc); err != nil {
+		return nil, err
+	}
+
+	switch svc.Spec.Type {
+	case corev1.ServiceTypeLoadBalancer:
+		var addresses []corev1.LoadBalancerIngress
+		for _, lb := range svc.Status.LoadBalancer.Ingress {
+			addresses = append(addresses, corev1.LoadBalancerIngress{IP: lb.IP, Hostname: lb.Hostname})
+		}
+		return sortAddresses(addresses), nil
+
+	case corev1.ServiceTypeExternalName:
+		return parseAddresses(svc.Spec.ExternalName), nil
+	}
+
+	if len(svc.Spec.ExternalIPs) > 0 {
+		return parseAddresses(strings.Join(svc.Spec.ExternalIPs, ",")), nil
+	}
+
+	if svc.Spec.Type == corev1.ServiceTypeNodePort {
+		return p.nodeAddresses(ctx, svc)
+	}
+
+	if len(svc.Spec.ClusterIP) > 0 && svc.Spec.ClusterIP != corev1.ClusterIPNone {
+		return parseAddresses(svc.Spec.ClusterIP), nil
+	}
+
+	return nil, fmt.Errorf("no address found for service %s", option.Opts.Ingress.PublishService)
+}
+
+// nodeAddresses returns addresses of nodes where pods of NodePort service running
+func (p *Publisher) nodeAddresses(ctx context.Context, svc *corev1.Service) ([]corev1.LoadBalancerIngress, error) {
+	slices, err := endpoint.Get(ctx, p, svc.Namespace, svc.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]bool)
+	var addresses []corev1.LoadBalancerIngress
+	for _, slice := range slices {
+		for _, ep := range slice.Endpoints {
+			if ep.Conditions.Ready != nil && !*ep.Conditions.Ready {
+				continue
+			}
+			if ep.NodeName == nil || found[*ep.NodeName] {
+				continue
+			}
+			found[*ep.NodeName] = true
+
+			node := &corev1.Node{}
+			if err := p.Get(ctx, client.ObjectKey{Name: *ep.NodeName}, node); err != nil {
+				return nil, err
+			}
+			if ip := nodeIP(node); len(ip) > 0 {
+				addresses = append(addresses, corev1.LoadBalancerIngress{IP: ip})
+			}
+		}
+	}
+
+	return sortAddresses(addresses), nil
+}
+
+// nodeIP returns external ip of node, or internal ip if external ip not exist
+func nodeIP(node *corev1.Node) string {
+	internalIP := ""
+	for _, addr := range node.Status.Addresses {
+		if addr.Type == corev1.NodeExternalIP && len(addr.Address) > 0 {
+			return addr.Address
+		}
+		if addr.Type == corev1.NodeInternalIP && len(internalIP) == 0 {
+			internalIP = addr.Address
+		}
+	}
+	return internalIP
+}
+
+// parseAddresses parses addresses delimited by ',', either ip or hostname
+func parseAddresses(value string) []corev1.LoadBalancerIngress {
+	var addresses []corev1.LoadBalancerIngress
+	for _, addr := range strings.Split(value, ",") {
+		addr = strings.TrimSpace(addr)
+		if len(addr) == 0 {
+			continue
+		}
+		if net.ParseIP(addr) != nil {
+			addresses = append(addresses, corev1.LoadBalancerIngress{IP: addr})
+		} else {
+			addresses = append(addresses, corev1.LoadBalancerIngress{Hostname: addr})
+		}
+	}
+	return sortAddresses(addresses)
+}
+
+func sortAddresses(addresses []corev1.LoadBalancerIngress) []corev1.LoadBalancerIngress {
+	sort.SliceStable(addresses, func(i, j int) bool {
+		if addresses[i].IP != addresses[j].IP {
+			return addresses[i].IP < addresses[j].IP
+		}
+		return addresses[i].Hostname < addresses[j].Hostname
+	})
+	return addresses
+}
+
+func equalAddresses(addresses1, addresses2 []corev1.LoadBalancerIngress) bool {
+	if len(addresses1) != len(addresses2) {
+		return false
+	}
+
+	addresses1 = sortAddresses(append([]corev1.LoadBalancerIngress{}, addresses1...))
+	for i := range addresses1 {
+		if addresses1[i].IP != addresses2[i].IP || addresses1[i].Hostname != addresses2[i].Hostname {
+			return false
+		}
+	}
+	return true
+}
+
+func loadBalancerIngress(ingress client.Object) []corev1.LoadBalancerIngress {
+	switch ingress := ingress.(type) {
+	case *netv1.Ingress:
+		return ingress.Status.LoadBalancer.Ingress
+	case *netv1beta1.Ingress:
+		return ingress.Status.LoadBalancer.Ingress
+	case *extv1beta1.Ingress:
+		return ingress.Status.LoadBalancer.Ingress
+	}
+	return nil
+}
+
+func setLoadBalancerIngress(ingress client.Object, addresses []corev1.LoadBalancerIngress) {
+	switch ingress := ingress.(type) {
+	case *netv1.Ingress:
+		ingress.Status.LoadBalancer.Ingress = addresses
+	case *netv1beta1.Ingress:
+		ingress.Status.LoadBalancer.Ingress = addresses
+	case *extv1beta1.Ingress:
+		ingress.Status.LoadBalancer.Ingress = addresses
+	}
+}
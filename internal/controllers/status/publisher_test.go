@@ -0,0 +1,81 @@
+// Copyright (c) 2021 The BFE Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package status
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func Test_parseAddresses(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  []corev1.LoadBalancerIngress
+	}{
+		{
+			name:  "empty",
+			value: "",
+			want:  nil,
+		},
+		{
+			name:  "ip and hostname",
+			value: "lb.example.com, 10.0.0.2,10.0.0.1",
+			want: []corev1.LoadBalancerIngress{
+				{Hostname: "lb.example.com"},
+				{IP: "10.0.0.1"},
+				{IP: "10.0.0.2"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseAddresses(tt.value); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseAddresses() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_equalAddresses(t *testing.T) {
+	addresses := parseAddresses("10.0.0.1,10.0.0.2")
+
+	if !equalAddresses([]corev1.LoadBalancerIngress{{IP: "10.0.0.2"}, {IP: "10.0.0.1"}}, addresses) {
+		t.Errorf("equalAddresses() should ignore order")
+	}
+	if equalAddresses([]corev1.LoadBalancerIngress{{IP: "10.0.0.1"}}, addresses) {
+		t.Errorf("equalAddresses() should compare length")
+	}
+	if !equalAddresses(nil, nil) {
+		t.Errorf("equalAddresses() should be true for empty addresses")
+	}
+}
+
+func Test_nodeIP(t *testing.T) {
+	node := &corev1.Node{}
+	node.Status.Addresses = []corev1.NodeAddress{
+		{Type: corev1.NodeInternalIP, Address: "192.168.0.1"},
+	}
+	if got := nodeIP(node); got != "192.168.0.1" {
+		t.Errorf("nodeIP() = %s, want internal ip", got)
+	}
+
+	node.Status.Addresses = append(node.Status.Addresses, corev1.NodeAddress{Type: corev1.NodeExternalIP, Address: "1.1.1.1"})
+	if got := nodeIP(node); got != "1.1.1.1" {
+		t.Errorf("nodeIP() = %s, want external ip", got)
+	}
+}
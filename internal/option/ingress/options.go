@@ -16,6 +16,7 @@ package ingress
 
 import (
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
 	"strings"
@@ -27,11 +28,12 @@ import (
 const (
 	enableIngress = true
 
-	configPath      = "/bfe/conf/"
-	bfeBinary       = "/bfe/bin/bfe"
-	reloadAddr      = "localhost:8421"
-	reloadInterval  = 3 * time.Second
-	reloadUrlPrefix = "http://%s/reload/"
+	configPath       = "/bfe/conf/"
+	bfeBinary        = "/bfe/bin/bfe"
+	reloadAddr       = "localhost:8421"
+	reloadInterval   = 3 * time.Second
+	reloadUrlPrefix  = "http://%s/reload/"
+	monitorUrlPrefix = "http://%s/monitor/"
 
 	filePerm os.FileMode = 0744
 
@@ -43,6 +45,12 @@ const (
 
 	// default backend
 	defaultBackend = ""
+
+	// interval of syncing ingress status
+	statusSyncInterval = 30 * time.Second
+
+	// terminating endpoints are removed at once by default
+	drainTimeout = 0
 )
 
 type Options struct {
@@ -51,11 +59,27 @@ type Options struct {
 	ControllerName string
 	ReloadAddr     string
 	ReloadUrl      string
+	MonitorUrl     string
 	BfeBinary      string
 	ConfigPath     string
 	FilePerm       os.FileMode
 	ReloadInterval time.Duration
 	DefaultBackend string
+
+	DefaultSSLCertificate string
+
+	PublishService       string
+	PublishStatusAddress string
+	StatusSyncInterval   time.Duration
+
+	DrainTimeout     time.Duration
+	NotReadyFallback bool
+
+	ZoneAwareRouting bool
+	Zone             string
+
+	TrustedProxies   string
+	TrustedProxyList []*net.IPNet
 }
 
 func NewOptions() *Options {
@@ -69,6 +93,9 @@ func NewOptions() *Options {
 		FilePerm:       filePerm,
 		ReloadInterval: reloadInterval,
 		DefaultBackend: defaultBackend,
+
+		StatusSyncInterval: statusSyncInterval,
+		DrainTimeout:       drainTimeout,
 	}
 }
 
@@ -83,6 +110,18 @@ func (opts *Options) Check() error {
 			return fmt.Errorf("invalid command line argument default-backend: %s", opts.DefaultBackend)
 		}
 	}
+	if len(opts.DefaultSSLCertificate) > 0 {
+		names := strings.Split(opts.DefaultSSLCertificate, string(types.Separator))
+		if len(names) != 2 {
+			return fmt.Errorf("invalid command line argument default-ssl-certificate: %s", opts.DefaultSSLCertificate)
+		}
+	}
+	if len(opts.PublishService) > 0 {
+		names := strings.Split(opts.PublishService, string(types.Separator))
+		if len(names) != 2 {
+			return fmt.Errorf("invalid command line argument publish-service: %s", opts.PublishService)
+		}
+	}
 	if len(opts.BfeBinary) > 0 {
 		opts.ConfigPath = filepath.Dir(filepath.Dir(opts.BfeBinary)) + "/conf"
 	}
@@ -91,6 +130,22 @@ func (opts *Options) Check() error {
 		opts.ConfigPath = opts.ConfigPath + "/"
 	}
 
+	if opts.DrainTimeout < 0 {
+		return fmt.Errorf("invalid command line argument drain-timeout: %s", opts.DrainTimeout)
+	}
+
+	opts.TrustedProxyList = nil
+	if len(strings.TrimSpace(opts.TrustedProxies)) > 0 {
+		for _, cidr := range strings.Split(opts.TrustedProxies, ",") {
+			_, ipNet, err := net.ParseCIDR(strings.TrimSpace(cidr))
+			if err != nil {
+				return fmt.Errorf("invalid command line argument trusted-proxies: %s", opts.TrustedProxies)
+			}
+			opts.TrustedProxyList = append(opts.TrustedProxyList, ipNet)
+		}
+	}
+
 	opts.ReloadUrl = fmt.Sprintf(reloadUrlPrefix, opts.ReloadAddr)
+	opts.MonitorUrl = fmt.Sprintf(monitorUrlPrefix, opts.ReloadAddr)
 	return nil
 }
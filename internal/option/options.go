@@ -15,7 +15,9 @@
 package option
 
 import (
+	"fmt"
 	"strings"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 
@@ -26,6 +28,11 @@ const (
 	ClusterName            = "default"
 	MetricsBindAddress     = ":9080"
 	HealthProbeBindAddress = ":9081"
+
+	LeaderElectionID = "bfe-ingress-controller-leader"
+	LeaseDuration    = 15 * time.Second
+	RenewDeadline    = 10 * time.Second
+	RetryPeriod      = 2 * time.Second
 )
 
 type Options struct {
@@ -36,6 +43,13 @@ type Options struct {
 	MetricsAddr     string
 	HealthProbeAddr string
 
+	LeaderElection          bool
+	LeaderElectionNamespace string
+	LeaderElectionID        string
+	LeaseDuration           time.Duration
+	RenewDeadline           time.Duration
+	RetryPeriod             time.Duration
+
 	Ingress *ingress.Options
 }
 
@@ -49,11 +63,21 @@ func NewOptions() *Options {
 		Namespaces:      corev1.NamespaceAll,
 		MetricsAddr:     MetricsBindAddress,
 		HealthProbeAddr: HealthProbeBindAddress,
-		Ingress:         ingress.NewOptions(),
+
+		LeaderElectionID: LeaderElectionID,
+		LeaseDuration:    LeaseDuration,
+		RenewDeadline:    RenewDeadline,
+		RetryPeriod:      RetryPeriod,
+
+		Ingress: ingress.NewOptions(),
 	}
 }
 
 func SetOptions(option *Options) error {
+	if option.LeaderElection && option.RenewDeadline >= option.LeaseDuration {
+		return fmt.Errorf("leader-election-renew-deadline should be less than leader-election-lease-duration")
+	}
+
 	if err := option.Ingress.Check(); err != nil {
 		return err
 	}